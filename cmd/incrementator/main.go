@@ -0,0 +1,208 @@
+// Программа incrementator - RPC сервер работы со счетчиком
+package main
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/server"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/sqlite"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/wal"
+)
+
+// AppSettings структура хранения настроек веб-сервиса
+type AppSettings struct {
+	DB          string          `json:"db"`           // имя базы данных
+	Addr        string          `json:"addr"`         // адрес прослушивания RPC сервера
+	TableName   string          `json:"table_name"`   // имя таблицы для хранения состояния счетчика
+	TablePrefix string          `json:"table_prefix"` // префикс имен таблиц
+	LogFilePath string          `json:"log_file"`     // путь к вайлу логов
+	Counter     CounterSettings `json:"counter"`      // настройки новых счетчиков
+	// Persistence режим сохранения счетчиков: state или events
+	Persistence string `json:"persistence"`
+	// SnapshotInterval количество событий журнала между снимками состояния счетчиков в режиме events
+	SnapshotInterval int `json:"snapshot_interval"`
+	// Backend хранилище состояния счетчиков: sqlite или wal
+	Backend string `json:"backend"`
+	// Durability политика сброса записей журнала на диск для хранилища wal: always, interval или none
+	Durability string `json:"durability"`
+}
+
+// Load загрузка настроек веб-сервиса
+// settingsPath - путь к файлу настроек в формате JSON
+// Поля, отсутствующие в файле, сохраняют текущие значения
+// Неизвестные поля и значения недопустимого типа не прерывают загрузку остальных полей,
+// а перечисляются в возвращаемой ошибке *ConfigError
+// Возвращает ошибку, если не удалось прочитать или разобрать файл
+func (s *AppSettings) Load(settingsPath string) error {
+	data, err := os.ReadFile(settingsPath)
+	if err != nil {
+		return err
+	}
+	e := new(ConfigError)
+	err = decodeFields("", data, s.fields(), e)
+	if err != nil {
+		return fmt.Errorf("ошибка разбора файла настроек %s: %w", settingsPath, err)
+	}
+	if len(e.Fields) != 0 {
+		return e
+	}
+	return nil
+}
+
+// logFile открытый файл логов, заменяемый при повторном чтении настроек
+var logFile *os.File
+
+// инициализования лога для ошибок
+// Ранее открытый файл логов закрывается после переключения логирования на новый файл
+func initLog(filePath string) (err error) {
+	var f *os.File
+	if _, err = os.Stat(filePath); err != nil {
+		if os.IsNotExist(err) {
+			dir, _ := filepath.Split(filePath)
+			if dir != "" {
+				err = os.MkdirAll(dir, os.ModePerm)
+				if err != nil {
+					return fmt.Errorf("не удалось инициализировать логирование ошибок: %w", err)
+				}
+			}
+		}
+	}
+	f, err = os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("не удалось инициализировать логирование ошибок: %w", err)
+	}
+	// сопоставляем созданный файл, как приемник логирования
+	log.SetOutput(f)
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = f
+	return nil
+}
+
+// shutdownTimeout время ожидания завершения выполняемых RPC вызовов при остановке сервиса
+// Должно быть меньше времени, которое Docker дает контейнеру на остановку до SIGKILL (10 секунд)
+const shutdownTimeout = 5 * time.Second
+
+// serve ожидание завершения контекста ctx или ошибки RPC сервера srv
+// и последующая корректная остановка сервиса: прекращение приема подключений,
+// ожидание выполняемых RPC вызовов не дольше timeout, сохранение последнего
+// состояния счетчиков inc и закрытие хранилища st
+// Последнее состояние сохраняется и хранилище закрывается даже при ошибке остановки сервера
+func serve(ctx context.Context, srv *server.Server, inc *server.RPCIncrementator, st io.Closer, timeout time.Duration) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Wait()
+	}()
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Print("Получен сигнал остановки сервера")
+	case err = <-served:
+		if err != nil {
+			err = fmt.Errorf("ошибка работы сервера: %w", err)
+		}
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if e := srv.Shutdown(shutdownCtx); e != nil {
+		err = errors.Join(err, fmt.Errorf("ошибка остановки сервера: %w", e))
+	}
+	if e := inc.Flush(); e != nil {
+		err = errors.Join(err, fmt.Errorf("ошибка сохранения состояния счетчиков: %w", e))
+	}
+	if e := st.Close(); e != nil {
+		err = errors.Join(err, fmt.Errorf("ошибка закрытия хранилища: %w", e))
+	}
+	return err
+}
+
+// openStore открытие хранилища состояния счетчиков, выбранного в настройках
+func openStore(settings *AppSettings) (storage.Store, error) {
+	if settings.Backend == BackendWAL {
+		opts := wal.DefaultOptions()
+		opts.Durability, _ = wal.ParseDurability(settings.Durability)
+		return wal.Open(settings.DB, opts)
+	}
+	return sqlite.OpenWithPrefix(settings.DB, settings.TablePrefix, settings.TableName)
+}
+
+func main() {
+	// восстановление счетчиков по журналу событий выполняется отдельной командой
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		err := runReplay(os.Args[2:], os.Stdout, os.Stderr)
+		if err != nil && err != flag.ErrHelp {
+			log.Fatalf("Ошибка восстановления счетчиков: %v", err)
+		}
+		return
+	}
+	// Читаем настройки из аргументов командной строки, переменных окружения и файла настроек
+	settings, err := loadSettings(os.Args[1:], os.Getenv, os.Stderr)
+	if err == flag.ErrHelp {
+		return
+	}
+	// перечень недопустимых настроек выводится построчно
+	if err != nil {
+		log.Fatalf("Ошибка инициализации сервера: %v", err)
+	}
+	// инициализируем файл логов
+	err = initLog(settings.LogFilePath)
+	if err != nil {
+		log.Fatalf("Ошибка инициализации сервера: %q", err.Error())
+	}
+	// подключаемся к хранилищу состояния счетчиков
+	st, err := openStore(settings)
+	if err != nil {
+		log.Fatalf("Ошибка инициализации сервера: %q", err.Error())
+	}
+	if _, ok := st.(storage.History); !ok {
+		log.Printf("Хранилище %s не ведет историю изменений счетчиков: методы GetHistory и GetStateAsOf недоступны", settings.Backend)
+	}
+	// инициализируем счетчик, настройки новых счетчиков уже проверены
+	defaults, _ := settings.Counter.Config()
+	var inc *server.RPCIncrementator
+	if settings.Persistence == PersistenceEvents {
+		// режим events допускается проверкой настроек только для хранилища с журналом событий
+		inc, err = server.CreateEventSourcedRPCIncrementator(st, st.(storage.EventLog), defaults, settings.SnapshotInterval)
+	} else {
+		inc, err = server.CreatePersistentRPCIncrementatorFromConfig(st, defaults)
+	}
+	if err != nil {
+		log.Fatalf("Ошибка инициализации сервера: %q", err.Error())
+	}
+	r := &reloader{args: os.Args[1:], getenv: os.Getenv, settings: settings, inc: inc}
+	srv, err := server.CreateServer(server.ServerConfig{Addr: settings.Addr, Reload: r.Reload}, inc)
+	if err != nil {
+		log.Fatalf("Ошибка инициализации сервера: %q", err.Error())
+	}
+	// сигналы остановки контейнера и прерывания с терминала
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// сигнал повторного чтения настроек
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go r.watch(ctx, hup)
+	err = srv.Start()
+	if err != nil {
+		log.Fatalf("Ошибка инициализации сервера: %q", err.Error())
+	}
+	err = serve(ctx, srv, inc, st, shutdownTimeout)
+	if err != nil {
+		log.Fatalf("Ошибка остановки сервера: %q", err.Error())
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/server"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/sqlite"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/wal"
+)
+
+const (
+	// имя временной (для тестирования) БД
+	tempDBName string = "test.db"
+	// имя таблицы хранения состояния счетчика во временной (для тестирования) БД
+	tableName string = "incrementator"
+)
+
+// Тестирование создания/загрузки файла логирования приложения
+func TestInitLog(t *testing.T) {
+	logFilePath := "test_errors.log"
+	defer clean(logFilePath)
+	// Тестирование создания файла логирования приложения
+	err := initLog(logFilePath)
+	if err != nil {
+		t.Fatalf("Функция создания/загрузки файла логирования вернула ошибку: %q", err.Error())
+	}
+	// Тестирование загрузки файла логирования приложения
+	err = initLog(logFilePath)
+	if err != nil {
+		t.Fatalf("Функции создания/загрузки файла логирования не удалось использовать уже ранее созданный файл: %q", err.Error())
+	}
+}
+
+// Тестирование загрузки настроек приложения
+func TestLoadSettings(t *testing.T) {
+	tempConfigFile := "test_config.json"
+	defer clean(tempConfigFile)
+	settings := new(AppSettings)
+	// Читаем настройки
+	file, err := os.OpenFile(tempConfigFile, os.O_RDWR|os.O_CREATE, 0755)
+	if err != nil {
+		log.Fatalf("Ошибка при создании временного файла настроек: %q", err.Error())
+	}
+	settings.DB = tempDBName
+	settings.TableName = tableName
+	settings.LogFilePath = tempConfigFile
+	data, err := json.Marshal(settings)
+	if err != nil {
+		log.Fatalf("Ошибка сериализации временного объекта настроек приложения: %q", err.Error())
+	}
+	_, err = io.WriteString(file, string(data))
+	if err != nil {
+		log.Fatalf("Ошибка записи тестовых настроек приложения в тестовый файл: %q", err.Error())
+	}
+	err = settings.Load(tempConfigFile)
+	if err != nil {
+		t.Fatalf("Метод загрузки настроек приложения Load вернул ошибку: %q", err.Error())
+	}
+	if settings.DB == "" {
+		t.Fatal("Метод загрузки настроек приложения Load неверно считал имя базы данных")
+	}
+	if settings.TableName == "" {
+		t.Fatal("Метод загрузки настроек приложения Load  неверно считал имя таблицы")
+	}
+}
+
+// Тестирование корректной остановки сервиса с сохранением последнего состояния счетчиков
+func TestServe(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), tempDBName)
+	st, err := sqlite.Open(dbPath, tableName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inc, err := server.CreatePersistentRPCIncrementator(st)
+	if err != nil {
+		t.Fatalf("функция CreatePersistentRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	srv, err := server.CreateServer(server.ServerConfig{Addr: "127.0.0.1:0"}, inc)
+	if err != nil {
+		t.Fatalf("функция CreateServer вернула ошибку: %q", err.Error())
+	}
+	if err = srv.Start(); err != nil {
+		t.Fatalf("метод Start вернул ошибку: %q", err.Error())
+	}
+	// изменение без вызова обработчиков событий сохраняется только при остановке
+	inc.IObj.IncrementBy(7)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = serve(ctx, srv, inc, st, time.Second); err != nil {
+		t.Fatalf("функция serve вернула ошибку: %q", err.Error())
+	}
+	if _, err = st.List(context.Background()); err == nil {
+		t.Fatal("Хранилище не закрыто при остановке сервиса")
+	}
+	st, err = sqlite.Open(dbPath, tableName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	loaded, err := server.CreatePersistentRPCIncrementator(st)
+	if err != nil {
+		t.Fatalf("функция CreatePersistentRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	if counter := loaded.IObj.GetNumber(); counter != 7 {
+		t.Fatalf("Последнее состояние счетчика не сохранено при остановке, ожидалось: %d, получено: %d", 7, counter)
+	}
+}
+
+// Очитска файловой системы и освобождение ресурсов после тестирования
+func clean(files ...string) {
+	for _, file := range files {
+		err := os.Remove(file)
+		if err != nil {
+			log.Printf("ошибка при очистке: %q", err.Error())
+		}
+	}
+}
+
+// Тестирование открытия хранилища, выбранного в настройках
+func TestOpenStore(t *testing.T) {
+	settings := DefaultSettings()
+	settings.DB = filepath.Join(t.TempDir(), "counters.wal")
+	settings.Backend, settings.Durability = BackendWAL, "none"
+	st, err := openStore(settings)
+	if err != nil {
+		t.Fatalf("функция openStore вернула ошибку: %q", err.Error())
+	}
+	if _, ok := st.(*wal.Store); !ok {
+		t.Fatalf("Открыто хранилище %T, ожидалось *wal.Store", st)
+	}
+	st.Close()
+	settings.DB = filepath.Join(t.TempDir(), tempDBName)
+	settings.Backend = BackendSQLite
+	st, err = openStore(settings)
+	if err != nil {
+		t.Fatalf("функция openStore вернула ошибку: %q", err.Error())
+	}
+	defer st.Close()
+	if _, ok := st.(storage.EventLog); !ok {
+		t.Fatalf("Хранилище %T не реализует журнал событий", st)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/SergeyASidorenko/ResourceCounter/server"
+)
+
+// reloader повторное чтение настроек веб-сервиса и применение их изменений без перезапуска
+// Без перезапуска применяются путь к файлу логов и настройки новых счетчиков,
+// а изменения базы данных, адреса прослушивания, имени таблицы, префикса имен таблиц
+// и режима сохранения счетчиков вступают в силу после перезапуска
+type reloader struct {
+	mtx      sync.Mutex               // мьютекс для блокировки одновременного чтения настроек
+	args     []string                 // аргументы командной строки, с которыми запущен сервис
+	getenv   func(string) string      // функция чтения переменных окружения
+	settings *AppSettings             // действующие настройки
+	inc      *server.RPCIncrementator // объект RPC сервера, к которому применяются настройки счетчиков
+}
+
+// Reload метод повторно читает настройки из всех источников в том же порядке, что и при запуске,
+// применяет изменения, не требующие перезапуска, и возвращает перечень измененных настроек
+// В случае недопустимых настроек возвращает ошибку, а действующие настройки не изменяются
+// Вызов метода потокобезопасен
+func (r *reloader) Reload() (server.ReloadResult, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	var result server.ReloadResult
+	next, err := loadSettings(r.args, r.getenv, io.Discard)
+	if err != nil {
+		log.Printf("Ошибка повторного чтения настроек, действующие настройки не изменены: %v", err)
+		return result, err
+	}
+	for _, f := range []struct{ name, current, next string }{
+		{"db", r.settings.DB, next.DB},
+		{"addr", r.settings.Addr, next.Addr},
+		{"table_name", r.settings.TableName, next.TableName},
+		{"table_prefix", r.settings.TablePrefix, next.TablePrefix},
+		{"persistence", r.settings.Persistence, next.Persistence},
+		{"snapshot_interval", strconv.Itoa(r.settings.SnapshotInterval), strconv.Itoa(next.SnapshotInterval)},
+		{"backend", r.settings.Backend, next.Backend},
+		{"durability", r.settings.Durability, next.Durability},
+	} {
+		if f.current != f.next {
+			result.RestartRequired = append(result.RestartRequired, f.name)
+		}
+	}
+	if next.LogFilePath != r.settings.LogFilePath {
+		err = initLog(next.LogFilePath)
+		if err != nil {
+			log.Printf("Ошибка повторного чтения настроек, действующие настройки не изменены: %v", err)
+			return server.ReloadResult{}, err
+		}
+		r.settings.LogFilePath = next.LogFilePath
+		result.Applied = append(result.Applied, "log_file")
+	}
+	if !reflect.DeepEqual(next.Counter, r.settings.Counter) {
+		// настройки счетчиков уже проверены при чтении
+		c, _ := next.Counter.Config()
+		err = r.inc.SetDefaults(c)
+		if err != nil {
+			return result, err
+		}
+		r.settings.Counter = next.Counter
+		result.Applied = append(result.Applied, "counter")
+	}
+	log.Printf("Настройки перечитаны, применены: %v, требуют перезапуска: %v", result.Applied, result.RestartRequired)
+	return result, nil
+}
+
+// watch метод повторно читает настройки при получении каждого сигнала из signals
+// до завершения контекста ctx
+func (r *reloader) watch(ctx context.Context, signals <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			r.Reload()
+		}
+	}
+}
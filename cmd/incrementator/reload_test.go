@@ -0,0 +1,71 @@
+package main
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SergeyASidorenko/ResourceCounter/server"
+)
+
+// Тестирование повторного чтения настроек с применением изменений без перезапуска
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	settingsPath := filepath.Join(dir, "settings.json")
+	write := func(data string) {
+		if err := os.WriteFile(settingsPath, []byte(data), 0600); err != nil {
+			t.Fatalf("Ошибка записи временного файла настроек: %q", err.Error())
+		}
+	}
+	defer log.SetOutput(os.Stderr)
+	write(`{"log_file": "` + filepath.Join(dir, "first.log") + `"}`)
+	args := []string{"-config", settingsPath}
+	getenv := func(string) string { return "" }
+	settings, err := loadSettings(args, getenv, nil)
+	if err != nil {
+		t.Fatalf("функция loadSettings вернула ошибку: %q", err.Error())
+	}
+	if err = initLog(settings.LogFilePath); err != nil {
+		t.Fatalf("Функция создания/загрузки файла логирования вернула ошибку: %q", err.Error())
+	}
+	inc := server.CreateRPCIncrementator()
+	r := &reloader{args: args, getenv: getenv, settings: settings, inc: inc}
+	// без изменений настроек ничего не применяется
+	result, err := r.Reload()
+	if err != nil || len(result.Applied) != 0 || len(result.RestartRequired) != 0 {
+		t.Fatalf("Неверный результат повторного чтения неизмененных настроек: %+v, ошибка: %v", result, err)
+	}
+	write(`{"log_file": "` + filepath.Join(dir, "second.log") + `", "table_name": "other", "counter": {"max_value": 50}}`)
+	result, err = r.Reload()
+	if err != nil {
+		t.Fatalf("метод Reload вернул ошибку: %q", err.Error())
+	}
+	if strings.Join(result.Applied, ",") != "log_file,counter" || strings.Join(result.RestartRequired, ",") != "table_name" {
+		t.Fatalf("Неверный результат повторного чтения настроек: %+v", result)
+	}
+	if v := inc.GetDefaults().MaxValue; v != 50 {
+		t.Fatalf("Настройки новых счетчиков не применены, максимальное значение: %d", v)
+	}
+	if r.settings.TableName != DefaultTableName {
+		t.Fatalf("Имя таблицы изменено без перезапуска: %q", r.settings.TableName)
+	}
+	log.Print("after reload")
+	data, _ := os.ReadFile(filepath.Join(dir, "second.log"))
+	if !strings.Contains(string(data), "after reload") {
+		t.Fatalf("Логирование не переключено на новый файл: %q", data)
+	}
+	// недопустимые настройки не применяются
+	write(`{"counter": {"max_value": -1}}`)
+	if _, err = r.Reload(); err == nil {
+		t.Fatal("метод Reload не вернул ошибку при недопустимых настройках")
+	}
+	if v := inc.GetDefaults().MaxValue; v != 50 || r.settings.LogFilePath != filepath.Join(dir, "second.log") {
+		t.Fatalf("Недопустимые настройки применены: максимальное значение %d, файл логов %q", v, r.settings.LogFilePath)
+	}
+}
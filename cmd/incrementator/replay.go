@@ -0,0 +1,84 @@
+package main
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/server"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/sqlite"
+)
+
+// runReplay команда восстановления состояния счетчиков по журналу событий в новую базу данных:
+//
+//	incrementator replay -from <база данных с журналом> -to <новая база данных> [-table имя] [-table-prefix префикс]
+//
+// Все события журнала применяются заново без учета снимка состояния и переносятся в новую базу данных
+// вместе со снимком и итоговым состоянием счетчиков, поэтому она может использоваться в любом режиме сохранения
+// Новая база данных не должна существовать и удаляется, если восстановление не удалось
+// Исходная база данных должна существовать и иметь текущую версию схемы; она открывается только для чтения
+// Счетчики произвольной точности и история изменений переносятся в новую базу данных без изменений
+// Количество перенесенных событий и счетчиков произвольной точности выводится в stdout, описание флагов - в stderr
+func runReplay(args []string, stdout, stderr io.Writer) (err error) {
+	var from, to, tableName, tablePrefix string
+	fs := flag.NewFlagSet("incrementator replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&from, "from", "", "путь к файлу базы данных с журналом событий")
+	fs.StringVar(&to, "to", "", "путь к файлу новой базы данных")
+	fs.StringVar(&tableName, "table", DefaultTableName, "имя таблицы для хранения состояния счетчика")
+	fs.StringVar(&tablePrefix, "table-prefix", "", "префикс имен таблиц")
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if from == "" || to == "" {
+		fs.Usage()
+		return errors.New("не заданы базы данных -from и -to")
+	}
+	switch _, err = os.Stat(to); {
+	case err == nil:
+		return fmt.Errorf("база данных %s уже существует", to)
+	case !os.IsNotExist(err):
+		return err
+	}
+	// исходная база данных открывается только для чтения, поэтому не создается и не изменяется
+	if _, err = os.Stat(from); err != nil {
+		return err
+	}
+	src, err := sqlite.OpenReadOnly(from, tablePrefix, tableName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	// база данных создается при открытии, поэтому удаляется и в случае ошибки открытия или создания таблиц
+	defer func() {
+		if err != nil {
+			os.Remove(to)
+		}
+	}()
+	dst, err := sqlite.OpenWithPrefix(to, tablePrefix, tableName)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	n, err := server.ReplayEvents(ctx, src, dst)
+	var big map[string]counter.BigState
+	if err == nil {
+		big, err = dst.ListBig(ctx)
+	}
+	err = errors.Join(err, dst.Close())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Перенесено событий: %d\n", n)
+	fmt.Fprintf(stdout, "Перенесено счетчиков произвольной точности: %d\n", len(big))
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/server"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/sqlite"
+)
+
+// Тестирование команды восстановления счетчиков по журналу событий в новую базу данных
+func TestRunReplay(t *testing.T) {
+	dir := t.TempDir()
+	from, to := filepath.Join(dir, "from.db"), filepath.Join(dir, "to.db")
+	st, err := sqlite.Open(from, DefaultTableName)
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	inc, err := server.CreateEventSourcedRPCIncrementator(st, st, counter.DefaultConfig(), server.DefaultSnapshotInterval)
+	if err != nil {
+		t.Fatalf("функция CreateEventSourcedRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	var reply int64
+	if err = inc.CreateCounter(&server.CounterRequest{Name: "requests"}, &reply); err != nil {
+		t.Fatalf("CreateCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	for k := 0; k < 3; k++ {
+		if err = inc.IncrementCounter("requests", &reply); err != nil {
+			t.Fatalf("IncrementCounter: метод возвратил ошибку: %q", err.Error())
+		}
+	}
+	if err = inc.CreateBigCounter(&server.BigCounterRequest{Name: "bytes"}, new(counter.BigState)); err != nil {
+		t.Fatalf("CreateBigCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	st.Close()
+	var stdout bytes.Buffer
+	if err = runReplay([]string{"-from", from, "-to", to}, &stdout, io.Discard); err != nil {
+		t.Fatalf("функция runReplay вернула ошибку: %q", err.Error())
+	}
+	if !strings.Contains(stdout.String(), "Перенесено событий: 5") || !strings.Contains(stdout.String(), "Перенесено счетчиков произвольной точности: 1") {
+		t.Fatalf("Неверный вывод команды: %q", stdout.String())
+	}
+	restored, err := sqlite.Open(to, DefaultTableName)
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	defer restored.Close()
+	if s, err := restored.Load(context.Background(), "requests"); err != nil || s.Value != 3 {
+		t.Fatalf("Неверное восстановленное состояние счетчика: %+v, ошибка: %v", s, err)
+	}
+	if _, err := restored.LoadBig(context.Background(), "bytes"); err != nil {
+		t.Fatalf("Счетчик произвольной точности не перенесен: %v", err)
+	}
+	// существующая база данных не используется для восстановления и не изменяется
+	if err = runReplay([]string{"-from", from, "-to", to}, io.Discard, io.Discard); err == nil {
+		t.Fatal("функция runReplay не вернула ошибку для существующей базы данных")
+	}
+	if _, err = os.Stat(to); err != nil {
+		t.Fatalf("Существующая база данных удалена: %v", err)
+	}
+	if err = runReplay([]string{"-from", from}, io.Discard, io.Discard); err == nil {
+		t.Fatal("функция runReplay не вернула ошибку при незаданной базе данных -to")
+	}
+	// ошибка проверки существования базы данных возвращается как есть
+	err = runReplay([]string{"-from", from, "-to", filepath.Join(from, "to.db")}, io.Discard, io.Discard)
+	if !errors.Is(err, syscall.ENOTDIR) {
+		t.Fatalf("функция runReplay не вернула ошибку проверки базы данных -to, получено: %v", err)
+	}
+	// несуществующая исходная база данных не создается
+	missing := filepath.Join(dir, "missing.db")
+	if err = runReplay([]string{"-from", missing, "-to", filepath.Join(dir, "new.db")}, io.Discard, io.Discard); !os.IsNotExist(err) {
+		t.Fatalf("функция runReplay не вернула ошибку для несуществующей базы данных -from, получено: %v", err)
+	}
+	if _, err = os.Stat(missing); !os.IsNotExist(err) {
+		t.Fatalf("Несуществующая база данных -from создана: %v", err)
+	}
+	// база данных, созданная неудавшимся восстановлением, удаляется
+	empty, failed := filepath.Join(dir, "empty.db"), filepath.Join(dir, "failed.db")
+	if st, err = sqlite.Open(empty, DefaultTableName); err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	st.Close()
+	if err = runReplay([]string{"-from", empty, "-to", failed}, io.Discard, io.Discard); err == nil {
+		t.Fatal("функция runReplay не вернула ошибку для пустого журнала событий")
+	}
+	if _, err = os.Stat(failed); !os.IsNotExist(err) {
+		t.Fatalf("База данных неудавшегося восстановления не удалена: %v", err)
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/server"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/sqlite"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/wal"
+)
+
+// Значения настроек веб-сервиса по умолчанию
+const (
+	DefaultSettingsPath = "config/settings.json" // путь к файлу настроек
+	DefaultDB           = "incrementator.db"     // путь к файлу базы данных хранилища sqlite
+	DefaultWALPath      = "incrementator.wal"    // путь к файлу журнала хранилища wal
+	DefaultTableName    = "incrementor"          // имя таблицы для хранения состояния счетчика
+	DefaultLogFilePath  = "logs/errors.log"      // путь к файлу логов
+	DefaultPersistence  = PersistenceState       // режим сохранения счетчиков
+	DefaultBackend      = BackendSQLite          // хранилище состояния счетчиков
+)
+
+// Хранилища состояния счетчиков
+const (
+	BackendSQLite = "sqlite" // база данных SQLite
+	BackendWAL    = "wal"    // журнал записей в файле, не требующий cgo
+)
+
+// Режимы сохранения счетчиков
+const (
+	PersistenceState  = "state"  // сохранение состояния счетчиков при каждом изменении
+	PersistenceEvents = "events" // журнал событий, из которого состояние восстанавливается при запуске
+)
+
+// Переменные окружения с настройками веб-сервиса
+const (
+	EnvSettingsPath     = "INCREMENTATOR_CONFIG"            // путь к файлу настроек
+	EnvDB               = "INCREMENTATOR_DB"                // путь к файлу базы данных
+	EnvAddr             = "INCREMENTATOR_ADDR"              // адрес прослушивания RPC сервера
+	EnvTableName        = "INCREMENTATOR_TABLE_NAME"        // имя таблицы для хранения состояния счетчика
+	EnvTablePrefix      = "INCREMENTATOR_TABLE_PREFIX"      // префикс имен таблиц
+	EnvLogFilePath      = "INCREMENTATOR_LOG_FILE"          // путь к файлу логов
+	EnvPersistence      = "INCREMENTATOR_PERSISTENCE"       // режим сохранения счетчиков
+	EnvSnapshotInterval = "INCREMENTATOR_SNAPSHOT_INTERVAL" // количество событий журнала между снимками состояния счетчиков
+	EnvBackend          = "INCREMENTATOR_BACKEND"           // хранилище состояния счетчиков
+	EnvDurability       = "INCREMENTATOR_DURABILITY"        // политика сброса записей журнала на диск
+)
+
+// DefaultSettings функция возвращает настройки веб-сервиса по умолчанию
+func DefaultSettings() *AppSettings {
+	return &AppSettings{
+		DB:               DefaultDB,
+		Addr:             server.DefaultAddr,
+		TableName:        DefaultTableName,
+		LogFilePath:      DefaultLogFilePath,
+		Persistence:      DefaultPersistence,
+		SnapshotInterval: server.DefaultSnapshotInterval,
+		Backend:          DefaultBackend,
+		Durability:       wal.DefaultOptions().Durability.String(),
+	}
+}
+
+// loadSettings загрузка настроек веб-сервиса из всех источников
+// Каждая настройка берется из первого источника, в котором она задана непустым значением:
+//  1. аргументы командной строки args (без имени программы);
+//  2. переменные окружения, значения которых возвращает функция getenv;
+//  3. файл настроек, путь к которому задается флагом -config или переменной
+//     окружения INCREMENTATOR_CONFIG, по умолчанию config/settings.json;
+//  4. значения по умолчанию.
+//
+// Отсутствие файла настроек по умолчанию не является ошибкой,
+// а отсутствие явно указанного файла - является
+// Описание флагов выводится в output при ошибке разбора аргументов и флаге -h
+// Недопустимые поля файла настроек и итоговые недопустимые настройки
+// перечисляются в одной ошибке *ConfigError
+func loadSettings(args []string, getenv func(string) string, output io.Writer) (*AppSettings, error) {
+	var flags AppSettings
+	var settingsPath string
+	fs := flag.NewFlagSet("incrementator", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&settingsPath, "config", "", "путь к файлу настроек в формате JSON (по умолчанию "+DefaultSettingsPath+", переменная окружения "+EnvSettingsPath+")")
+	fs.StringVar(&flags.DB, "db", "", "путь к файлу базы данных (по умолчанию "+DefaultDB+", для хранилища wal - "+DefaultWALPath+", переменная окружения "+EnvDB+")")
+	fs.StringVar(&flags.Addr, "addr", "", "адрес прослушивания RPC сервера (переменная окружения "+EnvAddr+")")
+	fs.StringVar(&flags.TableName, "table", "", "имя таблицы для хранения состояния счетчика (переменная окружения "+EnvTableName+")")
+	fs.StringVar(&flags.TablePrefix, "table-prefix", "", "префикс имен таблиц, позволяющий нескольким экземплярам сервиса использовать один файл базы данных (переменная окружения "+EnvTablePrefix+")")
+	fs.StringVar(&flags.LogFilePath, "log", "", "путь к файлу логов (переменная окружения "+EnvLogFilePath+")")
+	fs.StringVar(&flags.Persistence, "persistence", "", "режим сохранения счетчиков: state или events (по умолчанию "+DefaultPersistence+", переменная окружения "+EnvPersistence+")")
+	fs.IntVar(&flags.SnapshotInterval, "snapshot-interval", 0, "количество событий журнала между снимками состояния счетчиков в режиме events (по умолчанию "+strconv.Itoa(server.DefaultSnapshotInterval)+", переменная окружения "+EnvSnapshotInterval+")")
+	fs.StringVar(&flags.Backend, "backend", "", "хранилище состояния счетчиков: sqlite или wal, не ведущее историю изменений и журнал событий (по умолчанию "+DefaultBackend+", переменная окружения "+EnvBackend+")")
+	fs.StringVar(&flags.Durability, "durability", "", "политика сброса записей журнала на диск для хранилища wal: always, interval или none (по умолчанию "+wal.DefaultOptions().Durability.String()+", переменная окружения "+EnvDurability+")")
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	explicit := true
+	if settingsPath == "" {
+		settingsPath = getenv(EnvSettingsPath)
+	}
+	if settingsPath == "" {
+		settingsPath, explicit = DefaultSettingsPath, false
+	}
+	settings := DefaultSettings()
+	// путь к файлу по умолчанию зависит от хранилища, поэтому задается после выбора хранилища,
+	// а пустой путь, явно заданный в файле настроек, остается недопустимым
+	settings.DB = dbNotSet
+	// ошибки отдельных полей файла настроек выводятся вместе с ошибками проверки
+	e := new(ConfigError)
+	err = settings.Load(settingsPath)
+	if !errors.As(err, &e) && err != nil && (explicit || !os.IsNotExist(err)) {
+		return nil, err
+	}
+	env := &AppSettings{
+		DB:          getenv(EnvDB),
+		Addr:        getenv(EnvAddr),
+		TableName:   getenv(EnvTableName),
+		TablePrefix: getenv(EnvTablePrefix),
+		LogFilePath: getenv(EnvLogFilePath),
+		Persistence: getenv(EnvPersistence),
+		Backend:     getenv(EnvBackend),
+		Durability:  getenv(EnvDurability),
+	}
+	if value := getenv(EnvSnapshotInterval); value != "" {
+		env.SnapshotInterval, err = strconv.Atoi(value)
+		if err != nil {
+			e.add("snapshot_interval", "недопустимое значение переменной окружения %s: %q", EnvSnapshotInterval, value)
+		}
+	}
+	settings.merge(env)
+	settings.merge(&flags)
+	if settings.DB == dbNotSet {
+		settings.DB = defaultDB(settings.Backend)
+	}
+	var invalid *ConfigError
+	if errors.As(settings.Validate(), &invalid) {
+		e.Fields = append(e.Fields, invalid.Fields...)
+	}
+	if len(e.Fields) != 0 {
+		return nil, e
+	}
+	return settings, nil
+}
+
+// dbNotSet значение пути к файлу базы данных, не заданного ни в одном источнике настроек
+const dbNotSet = "\x00"
+
+// defaultDB функция возвращает путь к файлу базы данных по умолчанию для хранилища backend,
+// поэтому хранилища sqlite и wal по умолчанию не используют один файл
+func defaultDB(backend string) string {
+	if backend == BackendWAL {
+		return DefaultWALPath
+	}
+	return DefaultDB
+}
+
+// merge метод заменяет настройки непустыми значениями настроек s
+func (settings *AppSettings) merge(s *AppSettings) {
+	for _, f := range []struct{ dest, value *string }{
+		{&settings.DB, &s.DB},
+		{&settings.Addr, &s.Addr},
+		{&settings.TableName, &s.TableName},
+		{&settings.TablePrefix, &s.TablePrefix},
+		{&settings.LogFilePath, &s.LogFilePath},
+		{&settings.Persistence, &s.Persistence},
+		{&settings.Backend, &s.Backend},
+		{&settings.Durability, &s.Durability},
+	} {
+		if *f.value != "" {
+			*f.dest = *f.value
+		}
+	}
+	if s.SnapshotInterval != 0 {
+		settings.SnapshotInterval = s.SnapshotInterval
+	}
+}
+
+// CounterSettings настройки, с которыми создаются счетчик по умолчанию, отсутствующий в базе данных,
+// и новые именованные счетчики
+// Незаданные поля принимают значения по умолчанию пакета counter
+type CounterSettings struct {
+	Value      *int64 `json:"value"`       // исходное значение
+	Step       *int64 `json:"step"`        // шаг
+	MinValue   *int64 `json:"min_value"`   // минимальное значение
+	MaxValue   *int64 `json:"max_value"`   // максимальное значение
+	ResetValue *int64 `json:"reset_value"` // значение сброса
+	Overflow   string `json:"overflow"`    // политика переполнения: wrap, saturate, reject или carry
+}
+
+// counterFields имена полей конфигурации счетчика в файле настроек
+var counterFields = map[string]string{
+	"Value":      "value",
+	"Step":       "step",
+	"MinValue":   "min_value",
+	"MaxValue":   "max_value",
+	"ResetValue": "reset_value",
+	"Overflow":   "overflow",
+}
+
+// Config метод возвращает конфигурацию счетчика с заданными настройками
+// В случае недопустимых настроек возвращает ошибку *ConfigError
+func (c *CounterSettings) Config() (counter.Config, error) {
+	conf := counter.DefaultConfig()
+	for _, f := range []struct{ dest, value *int64 }{
+		{&conf.Value, c.Value},
+		{&conf.Step, c.Step},
+		{&conf.MinValue, c.MinValue},
+		{&conf.MaxValue, c.MaxValue},
+		{&conf.ResetValue, c.ResetValue},
+	} {
+		if f.value != nil {
+			*f.dest = *f.value
+		}
+	}
+	e := new(ConfigError)
+	if c.Overflow != "" {
+		p, ok := parseOverflowPolicy(c.Overflow)
+		if ok {
+			conf.Overflow = p
+		} else {
+			e.add("counter.overflow", "неизвестная политика переполнения %q, допустимые значения: wrap, saturate, reject, carry", c.Overflow)
+		}
+	}
+	var invalid *counter.SettingsError
+	if errors.As(conf.Validate(), &invalid) {
+		for _, f := range invalid.Fields {
+			e.add("counter."+counterFields[f.Field], "%s", f.Message)
+		}
+	}
+	if len(e.Fields) != 0 {
+		return conf, e
+	}
+	return conf, nil
+}
+
+// parseOverflowPolicy поиск политики переполнения по ее имени
+func parseOverflowPolicy(name string) (counter.OverflowPolicy, bool) {
+	for p := counter.OverflowWrap; p.Valid(); p++ {
+		if p.String() == name {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// ConfigError ошибка проверки настроек веб-сервиса, перечисляющая все недопустимые поля
+// Поля указываются по именам в файле настроек, поля настроек счетчиков - в виде counter.<имя поля>
+type ConfigError struct {
+	Fields []counter.FieldError // недопустимые поля в порядке их проверки
+}
+
+// Error метод возвращает текстовое описание ошибки, в котором каждое поле указано с новой строки
+func (e *ConfigError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for k, f := range e.Fields {
+		fields[k] = "\n\t" + f.Field + ": " + f.Message
+	}
+	return "недопустимые настройки сервиса:" + strings.Join(fields, "")
+}
+
+// add метод добавляет в ошибку недопустимое поле настроек
+func (e *ConfigError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, counter.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// fields метод возвращает указатели на поля настроек по их именам в файле настроек
+// Вложенным объектам соответствуют вложенные таблицы полей
+func (settings *AppSettings) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"db":                &settings.DB,
+		"addr":              &settings.Addr,
+		"table_name":        &settings.TableName,
+		"table_prefix":      &settings.TablePrefix,
+		"log_file":          &settings.LogFilePath,
+		"persistence":       &settings.Persistence,
+		"snapshot_interval": &settings.SnapshotInterval,
+		"backend":           &settings.Backend,
+		"durability":        &settings.Durability,
+		"counter": map[string]interface{}{
+			"value":       &settings.Counter.Value,
+			"step":        &settings.Counter.Step,
+			"min_value":   &settings.Counter.MinValue,
+			"max_value":   &settings.Counter.MaxValue,
+			"reset_value": &settings.Counter.ResetValue,
+			"overflow":    &settings.Counter.Overflow,
+		},
+	}
+}
+
+// decodeFields разбор JSON объекта data в поля fields с именами, дополненными префиксом prefix
+// Неизвестные поля и значения недопустимого типа добавляются в ошибку e,
+// а возвращается только ошибка разбора самого объекта
+func decodeFields(prefix string, data []byte, fields map[string]interface{}, e *ConfigError) error {
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch f := fields[name].(type) {
+		case nil:
+			e.add(prefix+name, "неизвестное поле")
+		case map[string]interface{}:
+			if err = decodeFields(prefix+name+".", raw[name], f, e); err != nil {
+				e.add(prefix+name, "ожидается объект, получено: %s", raw[name])
+			}
+		default:
+			if err = json.Unmarshal(raw[name], f); err != nil {
+				e.add(prefix+name, "недопустимое значение %s", raw[name])
+			}
+		}
+	}
+	return nil
+}
+
+// Validate метод проверяет настройки веб-сервиса целиком
+// Имена таблиц table_name и table_prefix проверяются, только если используется хранилище sqlite
+// Хранилище wal не ведет историю изменений и журнал событий, поэтому режим сохранения events с ним
+// отклоняется, а история изменений недоступна: RPC методы истории возвращают server.ErrHistoryDisabled
+// В случае недопустимых настроек возвращает ошибку *ConfigError со всеми недопустимыми полями
+func (settings *AppSettings) Validate() error {
+	e := new(ConfigError)
+	// хранилище wal не использует таблиц
+	tables := settings.Backend != BackendWAL
+	for _, f := range []struct {
+		name, value string
+		required    bool
+	}{
+		{"db", settings.DB, true},
+		{"addr", settings.Addr, true},
+		{"table_name", settings.TableName, tables},
+		{"log_file", settings.LogFilePath, true},
+	} {
+		if f.required && f.value == "" {
+			e.add(f.name, "обязательное поле не задано")
+		}
+	}
+	if settings.Addr != "" {
+		_, port, err := net.SplitHostPort(settings.Addr)
+		if err == nil {
+			_, err = net.LookupPort("tcp", port)
+		}
+		if err != nil {
+			e.add("addr", "недопустимый адрес прослушивания %q: %s", settings.Addr, err)
+		}
+	}
+	if tables {
+		// имя таблицы проверяется вместе с префиксом, только если префикс допустим
+		if err := sqlite.ValidateTablePrefix(settings.TablePrefix); err != nil {
+			e.add("table_prefix", "%s", err)
+		} else if settings.TableName != "" {
+			if err = sqlite.ValidateTableName(settings.TablePrefix + settings.TableName); err != nil {
+				e.add("table_name", "%s", err)
+			}
+		}
+	}
+	if settings.Persistence != PersistenceState && settings.Persistence != PersistenceEvents {
+		e.add("persistence", "неизвестный режим сохранения счетчиков %q, допустимые значения: %s, %s", settings.Persistence, PersistenceState, PersistenceEvents)
+	}
+	switch settings.Backend {
+	case BackendSQLite:
+	case BackendWAL:
+		// журнал записей не хранит журнал событий
+		if settings.Persistence == PersistenceEvents {
+			e.add("persistence", "режим сохранения %s не поддерживается хранилищем %s", PersistenceEvents, BackendWAL)
+		}
+	default:
+		e.add("backend", "неизвестное хранилище состояния счетчиков %q, допустимые значения: %s, %s", settings.Backend, BackendSQLite, BackendWAL)
+	}
+	if _, err := wal.ParseDurability(settings.Durability); err != nil {
+		e.add("durability", "%s", err)
+	}
+	if settings.SnapshotInterval <= 0 {
+		e.add("snapshot_interval", "количество событий между снимками состояния счетчиков должно быть больше нуля, получено: %d", settings.SnapshotInterval)
+	}
+	if settings.LogFilePath != "" {
+		if err := checkWritable(settings.LogFilePath); err != nil {
+			e.add("log_file", "файл логов недоступен для записи: %s", err)
+		}
+	}
+	var invalid *ConfigError
+	if _, err := settings.Counter.Config(); errors.As(err, &invalid) {
+		e.Fields = append(e.Fields, invalid.Fields...)
+	}
+	if len(e.Fields) != 0 {
+		return e
+	}
+	return nil
+}
+
+// checkWritable проверка возможности записи в файл filePath
+// Отсутствующий файл и недостающие каталоги создаются функцией initLog, поэтому
+// в этом случае проверяется возможность записи в ближайший существующий каталог
+// Проверка не оставляет изменений в файловой системе
+func checkWritable(filePath string) error {
+	info, err := os.Stat(filePath)
+	if err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("%s является каталогом", filePath)
+		}
+		f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	dir := filepath.Dir(filePath)
+	for {
+		info, err = os.Stat(dir)
+		if err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if !os.IsNotExist(err) || parent == dir {
+			return err
+		}
+		dir = parent
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s не является каталогом", dir)
+	}
+	f, err := os.CreateTemp(dir, ".incrementator-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
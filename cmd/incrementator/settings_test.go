@@ -0,0 +1,214 @@
+package main
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+)
+
+// Тестирование порядка применения источников настроек приложения
+func TestLoadSettingsPrecedence(t *testing.T) {
+	settingsPath := filepath.Join(t.TempDir(), "settings.json")
+	err := os.WriteFile(settingsPath, []byte(`{"db": "file.db", "addr": ":9000", "table_name": "file_table"}`), 0600)
+	if err != nil {
+		t.Fatalf("Ошибка записи временного файла настроек: %q", err.Error())
+	}
+	env := map[string]string{
+		EnvSettingsPath: settingsPath,
+		EnvAddr:         ":9001",
+		EnvTableName:    "env_table",
+		EnvPersistence:  PersistenceEvents,
+	}
+	getenv := func(key string) string { return env[key] }
+	settings, err := loadSettings([]string{"-table", "flag_table", "-snapshot-interval", "50", "-durability", "interval"}, getenv, io.Discard)
+	if err != nil {
+		t.Fatalf("функция loadSettings вернула ошибку: %q", err.Error())
+	}
+	expected := AppSettings{DB: "file.db", Addr: ":9001", TableName: "flag_table", LogFilePath: DefaultLogFilePath,
+		Persistence: PersistenceEvents, SnapshotInterval: 50, Backend: BackendSQLite, Durability: "interval"}
+	if *settings != expected {
+		t.Fatalf("Неверные настройки приложения.\nОжидалось: %+v, получено: %+v", expected, *settings)
+	}
+	// путь к файлу настроек, переданный аргументом, имеет приоритет над переменной окружения
+	env[EnvSettingsPath] = filepath.Join(t.TempDir(), "missing.json")
+	settings, err = loadSettings([]string{"-config", settingsPath}, getenv, io.Discard)
+	if err != nil {
+		t.Fatalf("функция loadSettings вернула ошибку: %q", err.Error())
+	}
+	if settings.DB != "file.db" {
+		t.Fatalf("Файл настроек, переданный аргументом, не прочитан: %+v", *settings)
+	}
+}
+
+// Тестирование загрузки настроек приложения при отсутствии файла настроек
+func TestLoadSettingsMissingFile(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(t.TempDir())
+	getenv := func(string) string { return "" }
+	// файл настроек по умолчанию не обязателен
+	settings, err := loadSettings(nil, getenv, io.Discard)
+	if err != nil {
+		t.Fatalf("функция loadSettings вернула ошибку при отсутствии файла настроек по умолчанию: %q", err.Error())
+	}
+	if *settings != *DefaultSettings() {
+		t.Fatalf("Неверные настройки приложения по умолчанию: %+v", *settings)
+	}
+	// явно указанный файл настроек обязателен
+	if _, err = loadSettings([]string{"-config", "missing.json"}, getenv, io.Discard); !os.IsNotExist(err) {
+		t.Fatalf("функция loadSettings не вернула ошибку при отсутствии явно указанного файла настроек, получено: %v", err)
+	}
+	if _, err = loadSettings([]string{"-h"}, getenv, io.Discard); err != flag.ErrHelp {
+		t.Fatalf("функция loadSettings не вернула flag.ErrHelp, получено: %v", err)
+	}
+}
+
+// Тестирование проверки настроек приложения с перечислением всех недопустимых полей
+func TestLoadSettingsValidation(t *testing.T) {
+	dir := t.TempDir()
+	notDir := filepath.Join(dir, "file")
+	if err := os.WriteFile(notDir, nil, 0600); err != nil {
+		t.Fatalf("Ошибка создания временного файла: %q", err.Error())
+	}
+	settingsPath := filepath.Join(dir, "settings.json")
+	data := `{
+		"db": "",
+		"addr": "8080",
+		"table_name": "incrementor; DROP TABLE incrementor",
+		"log_file": "` + filepath.Join(notDir, "errors.log") + `",
+		"log": "logs/errors.log",
+		"counter": {"step": "1", "min_value": 10, "max_value": 5, "overflow": "clamp", "mode": 1}
+	}`
+	if err := os.WriteFile(settingsPath, []byte(data), 0600); err != nil {
+		t.Fatalf("Ошибка записи временного файла настроек: %q", err.Error())
+	}
+	getenv := func(string) string { return "" }
+	_, err := loadSettings([]string{"-config", settingsPath}, getenv, io.Discard)
+	var e *ConfigError
+	if !errors.As(err, &e) {
+		t.Fatalf("функция loadSettings не вернула ошибку *ConfigError, получено: %v", err)
+	}
+	expected := []string{"counter.mode", "counter.step", "log", "db", "addr", "table_name", "log_file", "counter.overflow", "counter.max_value"}
+	fields := make([]string, len(e.Fields))
+	for k, f := range e.Fields {
+		fields[k] = f.Field
+	}
+	if strings.Join(fields, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Неверный перечень недопустимых полей.\nОжидалось: %v, получено: %v\n%s", expected, fields, e)
+	}
+	// недопустимое значение, заданное аргументом, также обнаруживается
+	_, err = loadSettings([]string{"-config", filepath.Join(dir, "missing.json"), "-table", "1table"}, getenv, io.Discard)
+	if !os.IsNotExist(err) {
+		t.Fatalf("функция loadSettings не вернула ошибку отсутствия файла настроек, получено: %v", err)
+	}
+	_, err = loadSettings([]string{"-table", "1table", "-log", filepath.Join(dir, "errors.log")}, getenv, io.Discard)
+	if !errors.As(err, &e) || len(e.Fields) != 1 || e.Fields[0].Field != "table_name" {
+		t.Fatalf("функция loadSettings не обнаружила недопустимое имя таблицы, получено: %v", err)
+	}
+	// имя таблицы проверяется вместе с префиксом, который проверяется отдельно
+	_, err = loadSettings([]string{"-table-prefix", "1x", "-log", filepath.Join(dir, "errors.log")}, getenv, io.Discard)
+	if !errors.As(err, &e) || len(e.Fields) != 1 || e.Fields[0].Field != "table_prefix" {
+		t.Fatalf("функция loadSettings не обнаружила недопустимый префикс имен таблиц, получено: %v", err)
+	}
+	// режим сохранения и интервал снимков проверяются во всех источниках
+	env := map[string]string{EnvPersistence: "journal", EnvSnapshotInterval: "often"}
+	_, err = loadSettings([]string{"-log", filepath.Join(dir, "errors.log")}, func(key string) string { return env[key] }, io.Discard)
+	if !errors.As(err, &e) || len(e.Fields) != 2 || e.Fields[0].Field != "snapshot_interval" || e.Fields[1].Field != "persistence" {
+		t.Fatalf("функция loadSettings не обнаружила недопустимые переменные окружения, получено: %v", err)
+	}
+	_, err = loadSettings([]string{"-snapshot-interval", "-1", "-log", filepath.Join(dir, "errors.log")}, getenv, io.Discard)
+	if !errors.As(err, &e) || len(e.Fields) != 1 || e.Fields[0].Field != "snapshot_interval" {
+		t.Fatalf("функция loadSettings не обнаружила недопустимый интервал снимков, получено: %v", err)
+	}
+	// хранилище и политика сброса записей проверяются, режим events требует хранилища sqlite
+	env = map[string]string{EnvBackend: "bolt", EnvDurability: "fsync"}
+	_, err = loadSettings([]string{"-log", filepath.Join(dir, "errors.log")}, func(key string) string { return env[key] }, io.Discard)
+	if !errors.As(err, &e) || len(e.Fields) != 2 || e.Fields[0].Field != "backend" || e.Fields[1].Field != "durability" {
+		t.Fatalf("функция loadSettings не обнаружила недопустимое хранилище, получено: %v", err)
+	}
+	_, err = loadSettings([]string{"-backend", BackendWAL, "-persistence", PersistenceEvents, "-log", filepath.Join(dir, "errors.log")}, getenv, io.Discard)
+	if !errors.As(err, &e) || len(e.Fields) != 1 || e.Fields[0].Field != "persistence" {
+		t.Fatalf("функция loadSettings не обнаружила режим events для хранилища wal, получено: %v", err)
+	}
+	// имена таблиц не используются хранилищем wal и не проверяются
+	settings := DefaultSettings()
+	settings.Backend, settings.TableName, settings.TablePrefix = BackendWAL, "", "1x"
+	settings.LogFilePath = filepath.Join(dir, "errors.log")
+	if err = settings.Validate(); err != nil {
+		t.Fatalf("метод Validate вернул ошибку проверки имен таблиц для хранилища wal: %v", err)
+	}
+	settings.Backend = BackendSQLite
+	if err = settings.Validate(); !errors.As(err, &e) || len(e.Fields) != 2 || e.Fields[0].Field != "table_name" || e.Fields[1].Field != "table_prefix" {
+		t.Fatalf("метод Validate не обнаружил недопустимые имена таблиц для хранилища sqlite, получено: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Fatalf("Проверка настроек изменила файловую систему: %v", entries)
+	}
+}
+
+// Тестирование пути к файлу базы данных по умолчанию для каждого хранилища
+func TestDefaultDB(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(t.TempDir())
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+	for _, test := range []struct {
+		args []string
+		db   string
+	}{
+		{nil, DefaultDB},
+		{[]string{"-backend", BackendSQLite}, DefaultDB},
+		{[]string{"-backend", BackendWAL}, DefaultWALPath},
+		{[]string{"-backend", BackendWAL, "-db", "counters.db"}, "counters.db"},
+	} {
+		settings, err := loadSettings(test.args, getenv, io.Discard)
+		if err != nil {
+			t.Fatalf("функция loadSettings вернула ошибку: %q", err.Error())
+		}
+		if settings.DB != test.db {
+			t.Fatalf("Неверный путь к файлу базы данных для аргументов %q: %q, ожидалось %q", test.args, settings.DB, test.db)
+		}
+	}
+	// путь, заданный в файле настроек, используется любым хранилищем
+	if err := os.WriteFile("settings.json", []byte(`{"db": "counters.db"}`), 0600); err != nil {
+		t.Fatalf("Ошибка записи файла настроек: %q", err.Error())
+	}
+	env[EnvSettingsPath], env[EnvBackend] = "settings.json", BackendWAL
+	if settings, err := loadSettings(nil, getenv, io.Discard); err != nil || settings.DB != "counters.db" {
+		t.Fatalf("Путь к файлу базы данных из файла настроек не использован: %+v, ошибка: %v", settings, err)
+	}
+}
+
+// Тестирование конфигурации новых счетчиков, заданной в файле настроек
+func TestCounterSettings(t *testing.T) {
+	settings := DefaultSettings()
+	settingsPath := filepath.Join(t.TempDir(), "settings.json")
+	data := `{"counter": {"value": 5, "max_value": 100, "overflow": "saturate"}}`
+	if err := os.WriteFile(settingsPath, []byte(data), 0600); err != nil {
+		t.Fatalf("Ошибка записи временного файла настроек: %q", err.Error())
+	}
+	if err := settings.Load(settingsPath); err != nil {
+		t.Fatalf("Метод загрузки настроек приложения Load вернул ошибку: %q", err.Error())
+	}
+	c, err := settings.Counter.Config()
+	if err != nil {
+		t.Fatalf("метод Config вернул ошибку: %q", err.Error())
+	}
+	expected := counter.DefaultConfig()
+	expected.Value, expected.MaxValue, expected.Overflow = 5, 100, counter.OverflowSaturate
+	if c.Value != expected.Value || c.Step != expected.Step || c.MinValue != expected.MinValue ||
+		c.MaxValue != expected.MaxValue || c.ResetValue != expected.ResetValue || c.Overflow != expected.Overflow {
+		t.Fatalf("Неверная конфигурация счетчика.\nОжидалось: %+v, получено: %+v", expected, c)
+	}
+}
@@ -0,0 +1,502 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// DefaultBigOverflowPolicy политика переполнения счетчика произвольной точности по умолчанию
+// Верхняя граница такого счетчика по умолчанию отсутствует, поэтому политика определяет
+// только поведение при уменьшении счетчика ниже минимального значения
+const DefaultBigOverflowPolicy OverflowPolicy = OverflowReject
+
+// BigIncrementResult результат изменения счетчика произвольной точности,
+// вычисленный атомарно вместе с самим изменением
+type BigIncrementResult struct {
+	Previous *big.Int // значение счетчика до изменения
+	Value    *big.Int // значение счетчика после изменения
+	Wrapped  bool     // признак перехода счетчика через границу диапазона по политике OverflowWrap или OverflowCarry
+	Wraps    uint64   // количество переходов счетчика через границу диапазона
+}
+
+// BigState согласованный снимок состояния счетчика произвольной точности
+// Отсутствующая (nil) граница диапазона означает, что счетчик не ограничен в этом направлении
+type BigState struct {
+	Value      *big.Int       // значение счетчика
+	Step       *big.Int       // шаг инкрементации
+	MinValue   *big.Int       // минимальное значение счетчика
+	MaxValue   *big.Int       // максимальное значение счетчика
+	ResetValue *big.Int       // значение сброса для политики OverflowWrap
+	Overflow   OverflowPolicy // политика переполнения
+	Wraps      uint64         // общее количество переходов счетчика через границу диапазона
+	Modified   time.Time      // время последнего изменения, нулевое, если счетчик не изменялся
+	Version    uint64         // номер версии состояния
+}
+
+// BigSettings желаемые настройки счетчика произвольной точности, передаваемые клиентами по RPC протоколу
+// Отсутствующие (nil) настройки не изменяются
+type BigSettings struct {
+	Step     *big.Int // шаг инкрементации
+	MaxValue *big.Int // максимальное значение счетчика
+	MinValue *big.Int // минимальное значение счетчика
+	// Overflow политика поведения счетчика при выходе за границы диапазона
+	Overflow *OverflowPolicy
+	// ResetValue значение, в которое устанавливается счетчик при превышении максимального значения по политике OverflowWrap
+	ResetValue *big.Int
+	NoMinValue bool // снять нижнюю границу диапазона
+	NoMaxValue bool // снять верхнюю границу диапазона
+}
+
+// BigOverflowError ошибка выхода значения счетчика произвольной точности за границы диапазона при политике OverflowReject
+type BigOverflowError struct {
+	Value *big.Int // значение счетчика до изменения
+	Delta *big.Int // величина отклоненного изменения за один шаг
+	Steps uint64   // количество шагов отклоненного изменения
+	Min   *big.Int // минимальное значение счетчика, nil при отсутствии нижней границы
+	Max   *big.Int // максимальное значение счетчика, nil при отсутствии верхней границы
+}
+
+// Error метод возвращает текстовое описание ошибки
+func (e *BigOverflowError) Error() string {
+	bounds := fmt.Sprintf("[%s, %s]", bigBound(e.Min, "-∞"), bigBound(e.Max, "+∞"))
+	if e.Steps > 1 {
+		return fmt.Sprintf("изменение счетчика %s на %s (шагов: %d) выходит за границы диапазона %s", e.Value, e.Delta, e.Steps, bounds)
+	}
+	return fmt.Sprintf("изменение счетчика %s на %s выходит за границы диапазона %s", e.Value, e.Delta, bounds)
+}
+
+// bigBound текстовое представление границы диапазона, none - для отсутствующей границы
+func bigBound(x *big.Int, none string) string {
+	if x == nil {
+		return none
+	}
+	return x.String()
+}
+
+// bigLimits границы диапазона счетчика произвольной точности и политика обработки выхода за них
+// Значения границ не изменяются после создания, поэтому разделяются между снимками состояния
+type bigLimits struct {
+	minValue   *big.Int       // минимальное значение счетчика, nil при отсутствии нижней границы
+	maxValue   *big.Int       // максимальное значение счетчика, nil при отсутствии верхней границы
+	resetValue *big.Int       // значение сброса для политики OverflowWrap
+	overflow   OverflowPolicy // политика поведения счетчика при выходе за границы диапазона
+}
+
+// normalize метод приводит значение счетчика к диапазону согласно политике переполнения
+// Повторяет поведение limits.apply с нулевым изменением
+func (l bigLimits) normalize(counter *big.Int) (*big.Int, error) {
+	above := l.maxValue != nil && counter.Cmp(l.maxValue) > 0
+	below := l.minValue != nil && counter.Cmp(l.minValue) < 0
+	if !above && !below {
+		return counter, nil
+	}
+	switch l.overflow {
+	case OverflowSaturate:
+		if above {
+			return l.maxValue, nil
+		}
+		return l.minValue, nil
+	case OverflowReject:
+		return counter, &BigOverflowError{Value: counter, Delta: new(big.Int), Steps: 1, Min: l.minValue, Max: l.maxValue}
+	case OverflowCarry:
+		value, _ := l.carry(counter, new(big.Int))
+		return value, nil
+	}
+	if above {
+		return l.resetTarget(), nil
+	}
+	return l.maxValue, nil
+}
+
+// applySteps метод вычисляет новое значение счетчика после n последовательных изменений
+// на величину step с учетом границ диапазона и политики переполнения
+// Повторяет логику limits.applySteps в длинной арифметике
+// Возвращает также количество переходов счетчика через границу диапазона
+func (l bigLimits) applySteps(counter, step *big.Int, n uint64) (*big.Int, uint64, error) {
+	if n == 0 || step.Sign() == 0 {
+		return counter, 0, nil
+	}
+	steps := new(big.Int).SetUint64(n)
+	total := new(big.Int).Mul(steps, step)
+	total.Add(total, counter)
+	abs := new(big.Int).Abs(step)
+	// граница в направлении изменения и расстояние до нее
+	bound := l.maxValue
+	if step.Sign() < 0 {
+		bound = l.minValue
+	}
+	if bound == nil {
+		return total, 0, nil
+	}
+	distance := new(big.Int).Sub(bound, counter)
+	distance.Abs(distance)
+	// количество шагов, которые счетчик может сделать, не выходя за границу диапазона
+	room := new(big.Int)
+	inRange := counter.Cmp(bound) <= 0
+	if step.Sign() < 0 {
+		inRange = counter.Cmp(bound) >= 0
+	}
+	if inRange {
+		room.Quo(distance, abs)
+	}
+	if steps.Cmp(room) <= 0 {
+		return total, 0, nil
+	}
+	switch l.overflow {
+	case OverflowSaturate:
+		return bound, 0, nil
+	case OverflowReject:
+		return counter, 0, &BigOverflowError{Value: counter, Delta: step, Steps: n, Min: l.minValue, Max: l.maxValue}
+	case OverflowCarry:
+		value, cycles := l.carry(counter, new(big.Int).Mul(steps, step))
+		// шаг, не меньший размера диапазона, переходит через границу на каждом изменении,
+		// иначе каждый переход приходится на отдельный шаг
+		wraps := n
+		if cycles.Abs(cycles).Cmp(steps) < 0 {
+			wraps = cycles.Uint64()
+		}
+		return value, wraps, nil
+	}
+	// после первого перехода через границу счетчик начинает цикл
+	// от значения сброса (или от максимального значения при уменьшении),
+	// длина цикла - количество шагов до следующего перехода
+	remaining := new(big.Int).Sub(steps, room)
+	remaining.Sub(remaining, big.NewInt(1))
+	start := l.resetTarget()
+	span := new(big.Int)
+	if step.Sign() > 0 {
+		span.Sub(l.maxValue, start)
+	} else {
+		start = l.maxValue
+		span.Sub(l.maxValue, l.minValue)
+	}
+	cycle := span.Quo(span, abs)
+	cycle.Add(cycle, big.NewInt(1))
+	cycles, offset := new(big.Int).QuoRem(remaining, cycle, new(big.Int))
+	value := offset.Mul(offset, step)
+	value.Add(value, start)
+	return value, 1 + cycles.Uint64(), nil
+}
+
+// carry метод вычисляет значение счетчика по политике OverflowCarry после его изменения на величину delta
+// Возвращает также количество полных циклов диапазона, отрицательное при уменьшении счетчика
+func (l bigLimits) carry(counter, delta *big.Int) (*big.Int, *big.Int) {
+	total := new(big.Int).Add(counter, delta)
+	total.Sub(total, l.minValue)
+	size := new(big.Int).Sub(l.maxValue, l.minValue)
+	size.Add(size, big.NewInt(1))
+	cycles, offset := new(big.Int).DivMod(total, size, new(big.Int))
+	return offset.Add(offset, l.minValue), cycles
+}
+
+// resetTarget метод возвращает значение сброса счетчика
+// Если значение сброса оказалось вне диапазона после изменения границ, используется минимальное значение,
+// а при отсутствии нижней границы - максимальное
+func (l bigLimits) resetTarget() *big.Int {
+	if (l.minValue != nil && l.resetValue.Cmp(l.minValue) < 0) || (l.maxValue != nil && l.resetValue.Cmp(l.maxValue) > 0) {
+		if l.minValue != nil {
+			return l.minValue
+		}
+		return l.maxValue
+	}
+	return l.resetValue
+}
+
+// bigState согласованное состояние счетчика произвольной точности
+// Значения типа *big.Int в состоянии не изменяются после фиксации, а каждое изменение
+// создает новые значения, поэтому снимки состояния разделяют их без копирования
+type bigState struct {
+	counter   *big.Int // внутренний счетчик
+	step      *big.Int // шаг инкрементации
+	bigLimits          // границы диапазона и политика переполнения
+	wraps     uint64   // общее количество переходов счетчика через границу диапазона
+	modified  int64    // время последнего изменения в наносекундах от начала эпохи Unix
+	version   uint64   // номер версии состояния, увеличивается при каждом изменении
+}
+
+// BigIncrementator счетчик произвольной точности, значение, шаг и границы которого
+// не ограничены разрядностью машинных целых
+// Используется для подсчета величин, не помещающихся в int64, например объема переданных данных
+// Каждое изменение применяется к копии состояния счетчика и фиксируется целиком под одним мьютексом
+// Вызов методов потокобезопасен
+type BigIncrementator struct {
+	mtx   sync.RWMutex // мьютекс чтения/записи для блокировки одновременного доступа к состоянию счетчика
+	state bigState     // текущее состояние счетчика
+}
+
+// CreateBigIncrementator функция создает новый объет типа BigIncrementator и возвращает указатель на него.
+// Счетчик создается с нулевым значением, минимальным значением DefaultMinValue, без верхней границы
+// и с политикой переполнения DefaultBigOverflowPolicy
+func CreateBigIncrementator() *BigIncrementator {
+	return &BigIncrementator{state: bigState{
+		counter: big.NewInt(DefaultValue),
+		step:    big.NewInt(DefaultStep),
+		bigLimits: bigLimits{
+			minValue:   big.NewInt(DefaultMinValue),
+			resetValue: big.NewInt(DefaultResetValue),
+			overflow:   DefaultBigOverflowPolicy,
+		},
+	}}
+}
+
+// CreateUint64Incrementator функция создает счетчик произвольной точности с диапазоном значений uint64
+// и политикой переполнения OverflowCarry, то есть с арифметикой по модулю 2^64,
+// и возвращает указатель на него.
+// Переполнение при этом не теряется, а обнаруживается по признаку Wrapped результата изменения
+func CreateUint64Incrementator() *BigIncrementator {
+	i := CreateBigIncrementator()
+	i.state.maxValue = new(big.Int).SetUint64(math.MaxUint64)
+	i.state.resetValue = new(big.Int)
+	i.state.overflow = OverflowCarry
+	return i
+}
+
+// CreateBigIncrementatorFromState функция восстанавливает счетчик произвольной точности
+// из снимка состояния s, например загруженного из хранилища, и возвращает указатель на него.
+// Состояние принимается без проверки, значения копируются и не разделяются с s
+func CreateBigIncrementatorFromState(s BigState) *BigIncrementator {
+	st := bigState{
+		counter: bigCopy(s.Value),
+		step:    bigCopy(s.Step),
+		bigLimits: bigLimits{
+			minValue:   bigCopy(s.MinValue),
+			maxValue:   bigCopy(s.MaxValue),
+			resetValue: bigCopy(s.ResetValue),
+			overflow:   s.Overflow,
+		},
+		wraps:   s.Wraps,
+		version: s.Version,
+	}
+	if !s.Modified.IsZero() {
+		st.modified = s.Modified.UnixNano()
+	}
+	return &BigIncrementator{state: st}
+}
+
+// GetNumber метод возвращает текущее значение счетчика
+// Вызов метода потокобезопасен
+func (i *BigIncrementator) GetNumber() *big.Int {
+	i.mtx.RLock()
+	defer i.mtx.RUnlock()
+	return new(big.Int).Set(i.state.counter)
+}
+
+// GetState метод возвращает согласованный снимок состояния счетчика
+// Вызов метода потокобезопасен
+func (i *BigIncrementator) GetState() BigState {
+	i.mtx.RLock()
+	s := i.state
+	i.mtx.RUnlock()
+	return s.export()
+}
+
+// Increment метод увеличивает значение счетчика на величину шага и возвращает
+// значения счетчика до и после изменения, полученные в той же критической секции
+// Вызов метода потокобезопасен
+func (i *BigIncrementator) Increment() (BigIncrementResult, error) {
+	return i.add(1, 1)
+}
+
+// IncrementBy метод атомарно увеличивает значение счетчика на n шагов
+// Переходы через границу диапазона обрабатываются так же, как в методе Incrementator.IncrementBy
+// Вызов метода потокобезопасен
+func (i *BigIncrementator) IncrementBy(n uint64) (BigIncrementResult, error) {
+	return i.add(1, n)
+}
+
+// Decrement метод уменьшает значение счетчика на величину шага и возвращает
+// значения счетчика до и после изменения, полученные в той же критической секции
+// Вызов метода потокобезопасен
+func (i *BigIncrementator) Decrement() (BigIncrementResult, error) {
+	return i.add(-1, 1)
+}
+
+// DecrementBy метод атомарно уменьшает значение счетчика на n шагов
+// Вызов метода потокобезопасен
+func (i *BigIncrementator) DecrementBy(n uint64) (BigIncrementResult, error) {
+	return i.add(-1, n)
+}
+
+// Configure метод атомарно применяет к счетчику настройки s
+// Настройки проверяются целиком так же, как в методе Incrementator.Configure,
+// и при обнаружении ошибок возвращается ошибка типа *SettingsError
+// Вызов метода потокобезопасен
+func (i *BigIncrementator) Configure(s *BigSettings) error {
+	return i.ConfigureWith(s, nil)
+}
+
+// ConfigureWith метод атомарно применяет к счетчику настройки s так же, как метод Configure
+// Функция persist, если она задана, вызывается со снимком нового состояния до его фиксации,
+// и ее ошибка отменяет изменение
+// Вызов метода потокобезопасен
+func (i *BigIncrementator) ConfigureWith(s *BigSettings, persist func(s BigState) error) error {
+	if s == nil {
+		return nil
+	}
+	return i.commit(s.apply, persist)
+}
+
+// commit изменение состояния счетчика функцией change с вызовом функции persist
+// для нового состояния до его фиксации
+// Функция change изменяет копию текущего состояния, которая фиксируется целиком
+// и с увеличением номера версии, только если функция не вернула ошибку
+func (i *BigIncrementator) commit(change func(s *bigState) error, persist func(s BigState) error) error {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	s := i.state
+	if err := change(&s); err != nil {
+		return err
+	}
+	s.version++
+	s.modified = time.Now().UnixNano()
+	if persist != nil {
+		if err := persist(s.export()); err != nil {
+			return err
+		}
+	}
+	i.state = s
+	return nil
+}
+
+// add изменение значения счетчика на n шагов в направлении direction (1 или -1)
+func (i *BigIncrementator) add(direction int64, n uint64) (r BigIncrementResult, err error) {
+	err = i.commit(func(s *bigState) error {
+		delta := s.step
+		if direction < 0 {
+			delta = new(big.Int).Neg(s.step)
+		}
+		value, wraps, err := s.applySteps(s.counter, delta, n)
+		if err != nil {
+			return err
+		}
+		r = BigIncrementResult{
+			Previous: new(big.Int).Set(s.counter),
+			Value:    new(big.Int).Set(value),
+			Wrapped:  wraps > 0,
+			Wraps:    wraps,
+		}
+		s.counter = value
+		s.wraps += wraps
+		return nil
+	}, nil)
+	if err != nil {
+		return BigIncrementResult{}, err
+	}
+	return r, nil
+}
+
+// export метод возвращает снимок состояния s счетчика в виде BigState
+// Значения копируются, чтобы вызывающий код не мог изменить состояние счетчика
+func (s bigState) export() BigState {
+	st := BigState{
+		Value:      bigCopy(s.counter),
+		Step:       bigCopy(s.step),
+		MinValue:   bigCopy(s.minValue),
+		MaxValue:   bigCopy(s.maxValue),
+		ResetValue: bigCopy(s.resetValue),
+		Overflow:   s.overflow,
+		Wraps:      s.wraps,
+		Version:    s.version,
+	}
+	if s.modified != 0 {
+		st.Modified = time.Unix(0, s.modified)
+	}
+	return st
+}
+
+// bigCopy функция возвращает копию значения x или nil, если значение отсутствует
+func bigCopy(x *big.Int) *big.Int {
+	if x == nil {
+		return nil
+	}
+	return new(big.Int).Set(x)
+}
+
+// ErrBoundsRequired ошибка использования политики переполнения, требующей границ диапазона, которые не заданы
+var ErrBoundsRequired = errors.New("политика переполнения требует обеих границ диапазона")
+
+// apply метод проверяет настройки целиком и применяет их к копии состояния счетчика st
+// Правила проверки совпадают с Settings.apply, дополнительно политики OverflowWrap
+// и OverflowCarry требуют верхней границы, а OverflowCarry - также нижней
+func (s *BigSettings) apply(st *bigState) error {
+	e := new(SettingsError)
+	next, step := st.bigLimits, st.step
+	if s.Overflow != nil {
+		if !s.Overflow.Valid() {
+			e.add("Overflow", "%s: %s", ErrInvalidOverflowPolicy, *s.Overflow)
+		}
+		next.overflow = *s.Overflow
+	}
+	if s.MinValue != nil && s.NoMinValue {
+		e.add("MinValue", "минимальное значение задано одновременно со снятием нижней границы")
+	}
+	if s.MaxValue != nil && s.NoMaxValue {
+		e.add("MaxValue", "максимальное значение задано одновременно со снятием верхней границы")
+	}
+	switch {
+	case s.NoMinValue:
+		next.minValue = nil
+	case s.MinValue != nil:
+		next.minValue = bigCopy(s.MinValue)
+	}
+	switch {
+	case s.NoMaxValue:
+		next.maxValue = nil
+	case s.MaxValue != nil:
+		next.maxValue = bigCopy(s.MaxValue)
+	}
+	bounded := next.minValue != nil && next.maxValue != nil
+	validRange := !bounded || next.minValue.Cmp(next.maxValue) <= 0
+	if !validRange {
+		if s.MinValue != nil {
+			e.add("MinValue", "минимальное значение %s превышает максимальное значение %s", next.minValue, next.maxValue)
+		}
+		if s.MaxValue != nil {
+			e.add("MaxValue", "максимальное значение %s меньше минимального значения %s", next.maxValue, next.minValue)
+		}
+	}
+	if next.overflow == OverflowCarry && !bounded || next.overflow == OverflowWrap && next.minValue != nil && next.maxValue == nil {
+		e.add("Overflow", "%s: %s", ErrBoundsRequired, next.overflow)
+	}
+	if s.ResetValue != nil {
+		next.resetValue = bigCopy(s.ResetValue)
+		if validRange && ((next.minValue != nil && next.resetValue.Cmp(next.minValue) < 0) || (next.maxValue != nil && next.resetValue.Cmp(next.maxValue) > 0)) {
+			e.add("ResetValue", "значение сброса %s выходит за границы диапазона [%s, %s]", next.resetValue, bigBound(next.minValue, "-∞"), bigBound(next.maxValue, "+∞"))
+		}
+	}
+	if s.Step != nil {
+		step = bigCopy(s.Step)
+		if step.Sign() < 0 {
+			e.add("Step", "недопустимое значение шага счетчика %s", step)
+		}
+	}
+	changed := s.Step != nil || s.MinValue != nil || s.MaxValue != nil || s.NoMinValue || s.NoMaxValue
+	if changed && bounded && validRange && step.Cmp(new(big.Int).Sub(next.maxValue, next.minValue)) > 0 {
+		e.add("Step", "шаг счетчика %s превышает размер диапазона [%s, %s]", step, next.minValue, next.maxValue)
+	}
+	counter := st.counter
+	if len(e.Fields) == 0 {
+		var err error
+		counter, err = next.normalize(st.counter)
+		if err != nil {
+			field := "MaxValue"
+			if next.minValue != nil && st.counter.Cmp(next.minValue) < 0 {
+				field = "MinValue"
+			}
+			e.add(field, "%s", err)
+		}
+	}
+	if len(e.Fields) != 0 {
+		return e
+	}
+	st.bigLimits, st.step, st.counter = next, step, counter
+	return nil
+}
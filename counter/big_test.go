@@ -0,0 +1,172 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// Тестирование счетчика произвольной точности без верхней границы
+func TestBigIncrementator(t *testing.T) {
+	incObj := CreateBigIncrementator()
+	step := new(big.Int).Lsh(big.NewInt(1), 62)
+	if err := incObj.Configure(&BigSettings{Step: step}); err != nil {
+		t.Fatalf("функция Configure вернула ошибку: %q", err.Error())
+	}
+	r, err := incObj.IncrementBy(8)
+	if err != nil {
+		t.Fatalf("функция IncrementBy вернула ошибку: %q", err.Error())
+	}
+	expected := new(big.Int).Lsh(big.NewInt(1), 65)
+	if r.Previous.Sign() != 0 || r.Value.Cmp(expected) != 0 || r.Wrapped {
+		t.Fatalf("функция IncrementBy отработала некорректно: %+v", r)
+	}
+	// результат не разделяет значения с состоянием счетчика
+	r.Value.SetInt64(0)
+	if incObj.GetNumber().Cmp(expected) != 0 {
+		t.Fatal("изменение результата IncrementBy изменило значение счетчика")
+	}
+	var overflowErr *BigOverflowError
+	if _, err = incObj.DecrementBy(9); !errors.As(err, &overflowErr) {
+		t.Fatalf("функция DecrementBy не вернула ошибку при уменьшении ниже минимального значения, получено: %v", err)
+	}
+	if st := incObj.GetState(); st.Value.Cmp(expected) != 0 || st.Version != 2 || st.Modified.IsZero() {
+		t.Fatalf("Неверное состояние счетчика после отклоненного изменения: %+v", st)
+	}
+}
+
+// Тестирование счетчика с диапазоном значений uint64
+func TestUint64Incrementator(t *testing.T) {
+	incObj := CreateUint64Incrementator()
+	half := new(big.Int).Lsh(big.NewInt(1), 63)
+	incObj.Configure(&BigSettings{Step: half})
+	r, _ := incObj.IncrementBy(3)
+	if r.Value.Cmp(half) != 0 || !r.Wrapped || r.Wraps != 1 {
+		t.Fatalf("функция IncrementBy не обнаружила переполнение uint64: %+v", r)
+	}
+	r, _ = incObj.DecrementBy(2)
+	if r.Value.Cmp(half) != 0 || r.Wraps != 1 {
+		t.Fatalf("функция DecrementBy не обнаружила переполнение uint64: %+v", r)
+	}
+	if st := incObj.GetState(); st.Wraps != 2 || st.MaxValue.Uint64() != math.MaxUint64 {
+		t.Fatalf("Неверное состояние счетчика uint64: %+v", st)
+	}
+}
+
+// Тестирование проверки настроек счетчика произвольной точности
+func TestBigSettings(t *testing.T) {
+	incObj := CreateBigIncrementator()
+	carry := OverflowCarry
+	err := incObj.Configure(&BigSettings{Overflow: &carry, MaxValue: big.NewInt(10), NoMaxValue: true})
+	expected := []string{"MaxValue", "Overflow"}
+	if fields := settingsFields(t, err); !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("функция Configure вернула неверный список недопустимых полей.\nОжидалось: %v, получено: %v", expected, fields)
+	}
+	if err = incObj.Configure(&BigSettings{Overflow: &carry, MaxValue: big.NewInt(10)}); err != nil {
+		t.Fatalf("функция Configure вернула ошибку: %q", err.Error())
+	}
+	r, _ := incObj.IncrementBy(25)
+	if r.Value.Int64() != 3 || r.Wraps != 2 {
+		t.Fatalf("функция IncrementBy отработала некорректно по политике OverflowCarry: %+v", r)
+	}
+	saturate := OverflowSaturate
+	if err = incObj.Configure(&BigSettings{Overflow: &saturate, NoMaxValue: true, NoMinValue: true}); err != nil {
+		t.Fatalf("функция Configure вернула ошибку при снятии границ: %q", err.Error())
+	}
+	r, _ = incObj.DecrementBy(5)
+	if r.Value.Int64() != -2 {
+		t.Fatalf("функция DecrementBy отработала некорректно без нижней границы: %+v", r)
+	}
+}
+
+// randomLimits случайные границы диапазона int64, в том числе на краях диапазона типа
+func randomLimits(rnd *rand.Rand) limits {
+	policies := []OverflowPolicy{OverflowWrap, OverflowSaturate, OverflowReject, OverflowCarry}
+	l := limits{overflow: policies[rnd.Intn(len(policies))]}
+	switch rnd.Intn(3) {
+	case 0:
+		l.minValue = math.MinInt64 + rnd.Int63n(10)
+	case 1:
+		l.minValue = rnd.Int63n(20) - 10
+	default:
+		l.minValue = math.MaxInt64 - rnd.Int63n(1000)
+	}
+	// разность границ вычисляется в uint64, так как может не поместиться в int64
+	room := uint64(math.MaxInt64 - l.minValue)
+	span := rnd.Uint64()
+	if room != math.MaxUint64 {
+		span %= room + 1
+	}
+	if rnd.Intn(2) == 0 {
+		span %= 100
+	}
+	l.maxValue = int64(uint64(l.minValue) + span)
+	l.resetValue = int64(uint64(l.minValue) + randomOffset(rnd, span))
+	return l
+}
+
+// randomOffset случайное смещение от 0 до span включительно
+func randomOffset(rnd *rand.Rand, span uint64) uint64 {
+	if span == math.MaxUint64 {
+		return rnd.Uint64()
+	}
+	return rnd.Uint64() % (span + 1)
+}
+
+// toBig границы диапазона int64 в длинной арифметике
+func (l limits) toBig() bigLimits {
+	return bigLimits{
+		minValue:   big.NewInt(l.minValue),
+		maxValue:   big.NewInt(l.maxValue),
+		resetValue: big.NewInt(l.resetValue),
+		overflow:   l.overflow,
+	}
+}
+
+// Тестирование отсутствия переполнения int64 при изменении счетчика на краях диапазона типа
+// Результат сравнивается с вычислением в длинной арифметике
+func TestApplyStepsExtremes(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	steps := []int64{1, -1, 7, -7, math.MaxInt64, math.MinInt64 + 1, math.MinInt64}
+	for k := 0; k < 20000; k++ {
+		l := randomLimits(rnd)
+		counter := int64(uint64(l.minValue) + randomOffset(rnd, uint64(l.maxValue-l.minValue)))
+		step := steps[rnd.Intn(len(steps))]
+		if rnd.Intn(2) == 0 {
+			step = rnd.Int63() >> uint(rnd.Intn(63))
+			if rnd.Intn(2) == 0 {
+				step = -step
+			}
+		}
+		n := rnd.Int63() >> uint(rnd.Intn(63))
+		value, wraps, err := l.applySteps(counter, step, n)
+		expected, expectedWraps, expectedErr := l.toBig().applySteps(big.NewInt(counter), big.NewInt(step), uint64(n))
+		if (err != nil) != (expectedErr != nil) || !expected.IsInt64() || value != expected.Int64() || uint64(wraps) != expectedWraps {
+			t.Fatalf("функция applySteps отработала некорректно для %+v, счетчик %d, шаг %d, шагов %d.\n"+
+				"Ожидалось: %s (переходов %d, ошибка %v), получено: %d (переходов %d, ошибка %v)",
+				l, counter, step, n, expected, expectedWraps, expectedErr, value, wraps, err)
+		}
+		if value < l.minValue || value > l.maxValue {
+			t.Fatalf("функция applySteps вернула значение %d вне диапазона [%d, %d]", value, l.minValue, l.maxValue)
+		}
+	}
+}
+
+// Тестирование обнаружения переполнения int64 при изменении распределенного счетчика
+func TestStripedOverflow(t *testing.T) {
+	incObj := CreateStripedIncrementator()
+	incObj.SetStep(math.MaxInt64 / 2)
+	if _, err := incObj.IncrementBy(3); err != ErrIntegerOverflow {
+		t.Fatalf("функция IncrementBy не вернула ошибку переполнения int64, получено: %v", err)
+	}
+	if counter := incObj.GetNumber(); counter != 0 {
+		t.Fatalf("Изменение с переполнением было применено, значение счетчика: %d", counter)
+	}
+}
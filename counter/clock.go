@@ -0,0 +1,66 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// clockResolution период обновления грубых часов
+	clockResolution = time.Millisecond
+	// clockIdleTicks количество периодов обновления без чтения грубых часов,
+	// после которого фоновая горутина останавливается
+	clockIdleTicks = 100
+)
+
+// coarseClock грубые часы, показания которых обновляются фоновой горутиной, пока часы читаются
+var coarseClock struct {
+	now     atomic.Int64 // текущее время в наносекундах от начала эпохи Unix
+	read    atomic.Bool  // признак чтения часов с момента последнего обновления
+	running atomic.Bool  // признак работы фоновой горутины
+}
+
+// coarseNow функция возвращает текущее время в наносекундах от начала эпохи Unix
+// с точностью до периода обновления грубых часов
+// Используется для времени последнего изменения в режимах ModeAtomic и ModeStriped,
+// в которых чтение системных часов при каждом изменении дороже самого изменения
+// Фоновая горутина запускается при первом чтении и останавливается, если часы не читаются
+// в течение clockIdleTicks периодов, поэтому неиспользуемые часы не расходуют ресурсы
+func coarseNow() int64 {
+	// признак записывается только при его изменении, чтобы частое чтение часов
+	// из разных горутин не приводило к конкурентной записи в общий участок памяти
+	if !coarseClock.read.Load() {
+		coarseClock.read.Store(true)
+	}
+	if coarseClock.running.Load() {
+		return coarseClock.now.Load()
+	}
+	// показания сохраняются до запуска горутины, поэтому увидевшие ее работу
+	// не прочитают показания, оставшиеся от ее предыдущей остановки
+	now := time.Now().UnixNano()
+	coarseClock.now.Store(now)
+	if coarseClock.running.CompareAndSwap(false, true) {
+		go tickCoarseClock()
+	}
+	return now
+}
+
+// tickCoarseClock обновление показаний грубых часов, пока они читаются
+func tickCoarseClock() {
+	ticker := time.NewTicker(clockResolution)
+	defer ticker.Stop()
+	for idle := 0; idle < clockIdleTicks; {
+		<-ticker.C
+		coarseClock.now.Store(time.Now().UnixNano())
+		if coarseClock.read.Swap(false) {
+			idle = 0
+		} else {
+			idle++
+		}
+	}
+	coarseClock.running.Store(false)
+}
@@ -0,0 +1,34 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"testing"
+	"time"
+)
+
+// Тестирование остановки грубых часов, которые не читаются, и их запуска при следующем чтении
+func TestCoarseClock(t *testing.T) {
+	coarseNow()
+	if !coarseClock.running.Load() {
+		t.Fatal("фоновая горутина грубых часов не запущена при чтении часов")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for coarseClock.running.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("фоновая горутина грубых часов не остановлена, хотя часы не читаются")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// остановленные часы не возвращают показания, оставшиеся от их остановки
+	time.Sleep(10 * clockResolution)
+	before := time.Now().UnixNano()
+	if now := coarseNow(); now < before {
+		t.Fatalf("грубые часы вернули устаревшие показания после остановки: %d, ожидалось не ранее %d", now, before)
+	}
+	if !coarseClock.running.Load() {
+		t.Fatal("фоновая горутина грубых часов не запущена повторно при чтении часов")
+	}
+}
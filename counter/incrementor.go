@@ -0,0 +1,827 @@
+// Пакет counter реализует потокобезопасные счетчики с настраиваемыми границами диапазона,
+// политикой переполнения и режимом синхронизации, а также реестр именованных счетчиков
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Исходные настройки счетчиков, создаваемых функцией CreateIncrementator
+// Переменные общие для всей программы, поэтому их изменение влияет на все вновь создаваемые счетчики
+//
+// Deprecated: используйте CreateIncrementatorWithOptions или CreateIncrementatorFromConfig
+// с конфигурацией отдельного счетчика
+var (
+	// InitValue Исходное значения счетчика для вновь созданного объекта
+	InitValue = DefaultValue
+	// InitStep Исходное значения шага инкрементации счетчика для вновь созданного объекта
+	InitStep = DefaultStep
+	// InitMaxValue Исходное максимального значения счетчика для вновь созданного объекта
+	InitMaxValue = DefaultMaxValue
+	// InitMinValue Исходное минимального значения счетчика для вновь созданного объекта
+	InitMinValue = DefaultMinValue
+	// ResetValue Исходное значение, в которое будет устанавливаться счетчик при превышении максимального значения
+	ResetValue = DefaultResetValue
+	// InitOverflowPolicy Исходная политика переполнения для вновь созданного объекта
+	InitOverflowPolicy = DefaultOverflowPolicy
+)
+
+// Mode режим синхронизации доступа к состоянию счетчика
+type Mode int
+
+const (
+	// ModeMutex состояние счетчика защищено мьютексом
+	ModeMutex Mode = iota
+	// ModeAtomic состояние счетчика хранится в неизменяемом снимке, который заменяется
+	// атомарной операцией CompareAndSwap в цикле, без блокировок, а время последнего
+	// изменения берется из грубых часов с точностью около миллисекунды
+	ModeAtomic
+	// ModeStriped значение счетчика ведется распределенным счетчиком StripedCounter
+	// с гарантиями согласованности, описанными для этого типа; предназначен для подсчета
+	// без границ диапазона при очень высокой конкуренции записи; время последнего изменения,
+	// как и в режиме ModeAtomic, берется из грубых часов
+	ModeStriped
+)
+
+// String метод возвращает имя режима синхронизации
+func (m Mode) String() string {
+	switch m {
+	case ModeMutex:
+		return "mutex"
+	case ModeAtomic:
+		return "atomic"
+	case ModeStriped:
+		return "striped"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// Valid метод проверяет, является ли режим синхронизации известным
+func (m Mode) Valid() bool {
+	return m >= ModeMutex && m <= ModeStriped
+}
+
+// ErrInvalidMode ошибка использования неизвестного режима синхронизации
+var ErrInvalidMode = errors.New("недопустимый режим синхронизации счетчика")
+
+// ErrUnsupportedByMode ошибка вызова операции, недоступной в режиме синхронизации счетчика
+var ErrUnsupportedByMode = errors.New("операция недоступна в режиме синхронизации счетчика")
+
+// ErrValueOutOfRange ошибка присваивания счетчику значения вне границ его диапазона
+var ErrValueOutOfRange = errors.New("значение выходит за границы диапазона счетчика")
+
+// PersistError ошибка сохранения уже примененного изменения счетчика
+// В режимах ModeAtomic и ModeStriped функции сохранения вызываются после фиксации изменения,
+// поэтому их ошибка не отменяет изменение, а сохраненное состояние отстает от состояния
+// счетчика до следующего успешного сохранения
+type PersistError struct {
+	Err error // ошибка функции сохранения
+}
+
+// Error метод возвращает текстовое описание ошибки
+func (e *PersistError) Error() string {
+	return "изменение счетчика применено, но не сохранено: " + e.Err.Error()
+}
+
+// Unwrap метод возвращает ошибку функции сохранения
+func (e *PersistError) Unwrap() error {
+	return e.Err
+}
+
+// IncrementResult результат изменения счетчика, вычисленный атомарно вместе с самим изменением
+type IncrementResult struct {
+	Previous int64 // значение счетчика до изменения
+	Value    int64 // значение счетчика после изменения
+	Wrapped  bool  // признак перехода счетчика через границу диапазона по политике OverflowWrap или OverflowCarry
+	Wraps    int64 // количество переходов счетчика через границу диапазона
+	// State согласованное состояние счетчика после изменения, полученное вместе с самим изменением;
+	// в режиме ModeStriped заполняется, только если задана функция сохранения счетчика
+	State State
+}
+
+// state согласованное состояние счетчика
+// Поля состояния изменяются только вместе, под одной блокировкой,
+// поэтому любой полученный снимок состояния внутренне согласован
+type state struct {
+	counter  int64  // внутренний счетчик
+	step     int64  // шаг инкрементации
+	limits          // границы диапазона и политика переполнения
+	wraps    uint64 // общее количество переходов счетчика через границу диапазона
+	modified int64  // время последнего изменения в наносекундах от начала эпохи Unix
+	version  uint64 // номер версии состояния, увеличивается при каждом изменении
+}
+
+// State согласованный снимок состояния счетчика, все поля которого получены одновременно
+type State struct {
+	Value      int64          // значение счетчика
+	Step       int64          // шаг инкрементации
+	MinValue   int64          // минимальное значение счетчика
+	MaxValue   int64          // максимальное значение счетчика
+	ResetValue int64          // значение сброса для политики OverflowWrap
+	Overflow   OverflowPolicy // политика переполнения
+	Mode       Mode           // режим синхронизации
+	Wraps      uint64         // общее количество переходов счетчика через границу диапазона
+	Modified   time.Time      // время последнего изменения, нулевое, если счетчик не изменялся; строго возрастает с номером версии
+	Version    uint64         // номер версии состояния
+}
+
+// Incrementator тип, позволяющий вести подсчет
+// возникновений определенного события, ресурсов и.т.д
+// Каждое изменение применяется к копии состояния счетчика и фиксируется целиком,
+// а чтение возвращает снимок состояния, поэтому значение счетчика никогда не сочетается
+// с шагом или границами из другой версии состояния
+// В режиме ModeMutex (по умолчанию) состояние защищено одним мьютексом,
+// в режиме ModeAtomic - заменяется атомарно, что избавляет часто изменяемые
+// счетчики от блокировок ценой размещения нового снимка при каждом изменении
+// В режиме ModeStriped мьютекс защищает только настройки счетчика, значение ведется
+// распределенным счетчиком, а операции, требующие линеаризуемого значения, недоступны
+type Incrementator struct {
+	mtx        sync.RWMutex          // мьютекс чтения/записи для блокировки одновременного доступа к состоянию счетчика
+	state                            // текущее состояние счетчика в режиме ModeMutex и настройки счетчика в режиме ModeStriped
+	mode       Mode                  // режим синхронизации, не изменяется после начала использования счетчика
+	shared     atomic.Pointer[state] // текущее состояние счетчика в режиме ModeAtomic
+	striped    *StripedCounter       // значение счетчика в режиме ModeStriped
+	stripeStep atomic.Int64          // шаг счетчика в режиме ModeStriped, читаемый при изменении без блокировки
+	persist    func(s State) error   // функция сохранения состояния счетчика при каждом изменении, не изменяется после создания
+}
+
+// CreateIncrementator функция создает новый объет типа Incrementator и возвращает указатель на него.
+// Настройки счетчика берутся из переменных InitValue, InitStep, InitMinValue,
+// InitMaxValue, ResetValue и InitOverflowPolicy и не проверяются
+func CreateIncrementator() *Incrementator {
+	c := Config{
+		Value:      InitValue,
+		Step:       InitStep,
+		MinValue:   InitMinValue,
+		MaxValue:   InitMaxValue,
+		ResetValue: ResetValue,
+		Overflow:   InitOverflowPolicy,
+	}
+	return c.create()
+}
+
+// CreateAtomicIncrementator функция создает новый объет типа Incrementator в режиме ModeAtomic
+// и возвращает указатель на него.
+func CreateAtomicIncrementator() *Incrementator {
+	i := CreateIncrementator()
+	i.setMode(ModeAtomic)
+	return i
+}
+
+// CreateStripedIncrementator функция создает новый объет типа Incrementator в режиме ModeStriped
+// и возвращает указатель на него.
+func CreateStripedIncrementator() *Incrementator {
+	i := CreateIncrementator()
+	i.setMode(ModeStriped)
+	return i
+}
+
+// CreateIncrementatorFromState функция восстанавливает счетчик из снимка состояния s,
+// например загруженного из хранилища, и возвращает указатель на него.
+// Значение, настройки, режим синхронизации, количество переходов через границу диапазона,
+// время последнего изменения и номер версии счетчика принимаются без проверки
+func CreateIncrementatorFromState(s State) *Incrementator {
+	i := new(Incrementator)
+	i.counter = s.Value
+	i.step = s.Step
+	i.limits = limits{
+		minValue:   s.MinValue,
+		maxValue:   s.MaxValue,
+		resetValue: s.ResetValue,
+		overflow:   s.Overflow,
+	}
+	i.wraps = s.Wraps
+	if !s.Modified.IsZero() {
+		i.modified = s.Modified.UnixNano()
+	}
+	i.version = s.Version
+	i.setMode(s.Mode)
+	return i
+}
+
+// GetState метод возвращает согласованный снимок состояния счетчика
+// Вызов метода потокобезопасен
+func (i *Incrementator) GetState() State {
+	return i.snapshot().export(i.mode)
+}
+
+// Configure метод атомарно применяет к счетчику настройки s
+// Настройки проверяются целиком с учетом уже установленных значений, и при обнаружении
+// ошибок счетчик не изменяется, а возвращается ошибка типа *SettingsError со списком
+// всех недопустимых полей
+// Отсутствующие в s настройки не изменяются
+// Вызов метода потокобезопасен
+func (i *Incrementator) Configure(s *Settings) error {
+	return i.ConfigureWith(s, nil)
+}
+
+// Mode метод возвращает режим синхронизации счетчика
+func (i *Incrementator) Mode() Mode {
+	return i.mode
+}
+
+// GetNumber метод возвращает текущее значение счетчика
+// Вызов метода потокобезопасен
+func (i *Incrementator) GetNumber() int64 {
+	switch i.mode {
+	case ModeAtomic:
+		return i.shared.Load().counter
+	case ModeStriped:
+		return i.striped.GetNumber()
+	}
+	i.mtx.RLock()
+	defer i.mtx.RUnlock()
+	return i.counter
+}
+
+// IncrementNumber метод увеличивает значение счетчика на величину шага
+// Выход за максимальное значение обрабатывается согласно политике переполнения счетчика
+// Вызов метода потокобезопасен
+func (i *Incrementator) IncrementNumber() error {
+	if i.mode == ModeStriped && i.persist == nil {
+		// значение после изменения не требуется, поэтому полосы не суммируются
+		i.striped.Add(i.stripeStep.Load())
+		return nil
+	}
+	// состояние после изменения не требуется, поэтому не формируется
+	_, err := i.add(1, 1, false)
+	return err
+}
+
+// Increment метод увеличивает значение счетчика на величину шага и возвращает
+// значения счетчика до и после изменения, полученные в той же критической секции,
+// поэтому результат может использоваться как источник уникальной последовательности
+// Вызов метода потокобезопасен
+func (i *Incrementator) Increment() (IncrementResult, error) {
+	return i.add(1, 1, true)
+}
+
+// IncrementBy метод атомарно увеличивает значение счетчика на n шагов
+// Каждый переход через границу диапазона обрабатывается согласно политике переполнения,
+// так же как при n последовательных вызовах Increment, а при политике OverflowReject
+// изменение отклоняется целиком
+// В случае, если n меньше нуля, - возвращает ошибку
+// Вызов метода потокобезопасен
+func (i *Incrementator) IncrementBy(n int64) (IncrementResult, error) {
+	if n < 0 {
+		return IncrementResult{}, errors.New("недопустимое количество шагов изменения счетчика")
+	}
+	return i.add(1, n, true)
+}
+
+// DecrementNumber метод уменьшает значение счетчика на величину шага
+// Выход за минимальное значение обрабатывается согласно политике переполнения счетчика
+// Вызов метода потокобезопасен
+func (i *Incrementator) DecrementNumber() error {
+	if i.mode == ModeStriped && i.persist == nil {
+		i.striped.Add(-i.stripeStep.Load())
+		return nil
+	}
+	_, err := i.add(-1, 1, false)
+	return err
+}
+
+// Decrement метод уменьшает значение счетчика на величину шага и возвращает
+// значения счетчика до и после изменения, полученные в той же критической секции
+// Вызов метода потокобезопасен
+func (i *Incrementator) Decrement() (IncrementResult, error) {
+	return i.add(-1, 1, true)
+}
+
+// DecrementBy метод атомарно уменьшает значение счетчика на n шагов
+// Переходы через границу диапазона обрабатываются так же, как в методе IncrementBy
+// В случае, если n меньше нуля, - возвращает ошибку
+// Вызов метода потокобезопасен
+func (i *Incrementator) DecrementBy(n int64) (IncrementResult, error) {
+	if n < 0 {
+		return IncrementResult{}, errors.New("недопустимое количество шагов изменения счетчика")
+	}
+	return i.add(-1, n, true)
+}
+
+// IncrementIf метод увеличивает значение счетчика на величину шага, только если
+// значение после увеличения не превысит limit, что позволяет использовать счетчик
+// для ограничения количества занятых ресурсов
+// Возвращает признак выполнения увеличения
+// Вызов метода потокобезопасен
+func (i *Incrementator) IncrementIf(limit int64) (r IncrementResult, ok bool, err error) {
+	if i.mode == ModeStriped {
+		return r, false, ErrUnsupportedByMode
+	}
+	st, err := i.commit(func(s *state) error {
+		r.Previous, r.Value = s.counter, s.counter
+		// разность limit-s.step не должна выходить за границы int64
+		if limit < math.MinInt64+s.step || s.counter > limit-s.step {
+			return errNotApplied
+		}
+		r, err = s.add(s.step, 1)
+		return err
+	}, nil)
+	if err == errNotApplied {
+		return r, false, nil
+	}
+	if err != nil {
+		return IncrementResult{}, false, err
+	}
+	r.State = st
+	return r, true, nil
+}
+
+// CompareAndSwap метод присваивает счетчику значение newValue, только если
+// его текущее значение равно oldValue
+// Возвращает признак выполнения присваивания
+// В случае, если новое значение выходит за границы диапазона счетчика, - возвращает ошибку
+// Вызов метода потокобезопасен
+func (i *Incrementator) CompareAndSwap(oldValue, newValue int64) (bool, error) {
+	_, ok, err := i.SwapIf(oldValue, newValue)
+	return ok, err
+}
+
+// SwapIf метод присваивает счетчику значение newValue, только если его текущее значение
+// равно oldValue, так же как метод CompareAndSwap, и возвращает результат изменения
+// с состоянием счетчика после него и признак выполнения присваивания
+// Вызов метода потокобезопасен
+func (i *Incrementator) SwapIf(oldValue, newValue int64) (r IncrementResult, ok bool, err error) {
+	if i.mode == ModeStriped {
+		return r, false, ErrUnsupportedByMode
+	}
+	st, err := i.commit(func(s *state) error {
+		if newValue < s.minValue || newValue > s.maxValue {
+			return ErrValueOutOfRange
+		}
+		r.Previous, r.Value = s.counter, s.counter
+		if s.counter != oldValue {
+			return errNotApplied
+		}
+		s.counter, r.Value = newValue, newValue
+		return nil
+	}, nil)
+	if err == errNotApplied {
+		return r, false, nil
+	}
+	if err != nil {
+		return IncrementResult{}, false, err
+	}
+	r.State = st
+	return r, true, nil
+}
+
+// SetValue метод присваивает счетчику значение value и возвращает его предыдущее значение
+// В случае, если значение выходит за границы диапазона счетчика, - возвращает ошибку
+// Вызов метода потокобезопасен
+func (i *Incrementator) SetValue(value int64) (previous int64, err error) {
+	r, err := i.Swap(value)
+	return r.Previous, err
+}
+
+// Swap метод присваивает счетчику значение value так же, как метод SetValue, и возвращает
+// результат изменения с предыдущим значением и состоянием счетчика после изменения
+// Вызов метода потокобезопасен
+func (i *Incrementator) Swap(value int64) (IncrementResult, error) {
+	return i.swap(value, 0)
+}
+
+// SwapAt метод присваивает счетчику значение value так же, как метод Swap, но временем
+// изменения считается at, а не текущее время; нулевое время at соответствует текущему
+// Предназначен для применения изменений, время которых уже записано, например в журнал событий,
+// поэтому повторное применение тех же изменений восстанавливает то же время последнего изменения
+// Вызов метода потокобезопасен
+func (i *Incrementator) SwapAt(value int64, at time.Time) (IncrementResult, error) {
+	return i.swap(value, unixNano(at))
+}
+
+// swap присваивание счетчику значения value со временем изменения at в наносекундах
+// от начала эпохи Unix или текущим временем, если at равно нулю
+func (i *Incrementator) swap(value, at int64) (r IncrementResult, err error) {
+	if i.mode == ModeStriped {
+		return r, ErrUnsupportedByMode
+	}
+	r.State, err = i.commitAt(func(s *state) error {
+		if value < s.minValue || value > s.maxValue {
+			return ErrValueOutOfRange
+		}
+		r.Previous, r.Value, s.counter = s.counter, value, value
+		return nil
+	}, nil, at)
+	if err != nil {
+		return IncrementResult{}, err
+	}
+	return r, nil
+}
+
+// SetMaximumValue метод принимает новое максимальное значения счетчика
+// В случае, если новое значение меньше минимального значения счетчика, - возвращает ошибку
+// Если текущее значение счетчика превышает новое максимальное,
+// оно приводится к диапазону согласно политике переполнения счетчика
+// Вызов метода потокобезопасен
+func (i *Incrementator) SetMaximumValue(maximumValue int64) error {
+	return i.updateLimits(func(l *limits) error {
+		if maximumValue < l.minValue {
+			return errors.New("недопустимое значение максимального значения")
+		}
+		l.maxValue = maximumValue
+		return nil
+	})
+}
+
+// SetMinimumValue метод принимает новое минимальное значения счетчика
+// В случае, если новое значение больше максимального значения счетчика, - возвращает ошибку
+// Если текущее значение счетчика меньше нового минимального,
+// оно приводится к диапазону согласно политике переполнения счетчика
+// Вызов метода потокобезопасен
+func (i *Incrementator) SetMinimumValue(minimumValue int64) error {
+	return i.updateLimits(func(l *limits) error {
+		if minimumValue > l.maxValue {
+			return errors.New("недопустимое значение минимального значения")
+		}
+		l.minValue = minimumValue
+		return nil
+	})
+}
+
+// SetRange метод одновременно принимает новые минимальное и максимальное значения счетчика
+// В случае, если минимальное значение больше максимального, - возвращает ошибку
+// Если текущее значение счетчика выходит за новые границы,
+// оно приводится к диапазону согласно политике переполнения счетчика
+// Вызов метода потокобезопасен
+func (i *Incrementator) SetRange(minimumValue, maximumValue int64) error {
+	if minimumValue > maximumValue {
+		return errors.New("минимальное значение счетчика превышает максимальное")
+	}
+	return i.updateLimits(func(l *limits) error {
+		l.minValue, l.maxValue = minimumValue, maximumValue
+		return nil
+	})
+}
+
+// SetResetValue метод принимает новое значение сброса счетчика для политики OverflowWrap
+// В случае, если значение выходит за границы диапазона счетчика, - возвращает ошибку
+// Вызов метода потокобезопасен
+func (i *Incrementator) SetResetValue(resetValue int64) error {
+	return i.updateLimits(func(l *limits) error {
+		if resetValue < l.minValue || resetValue > l.maxValue {
+			return errors.New("значение сброса выходит за границы диапазона счетчика")
+		}
+		l.resetValue = resetValue
+		return nil
+	})
+}
+
+// SetOverflowPolicy метод принимает новую политику переполнения счетчика
+// В случае, если политика неизвестна, - возвращает ошибку
+// Вызов метода потокобезопасен
+func (i *Incrementator) SetOverflowPolicy(policy OverflowPolicy) error {
+	if !policy.Valid() {
+		return ErrInvalidOverflowPolicy
+	}
+	return i.updateLimits(func(l *limits) error {
+		l.overflow = policy
+		return nil
+	})
+}
+
+// SetStep метод принимает новое значения шага приращения счетчика
+// В случае, если новое значение меньше нуля, - возвращает ошибку
+// Вызов метода потокобезопасен
+func (i *Incrementator) SetStep(step int64) error {
+	if step < 0 {
+		return errors.New("недопустимое значение шага счетчика")
+	}
+	return i.update(func(s *state) error {
+		s.step = step
+		return nil
+	})
+}
+
+// errNotApplied внутренний признак невыполненного условия условной операции,
+// отменяющий изменение состояния счетчика
+var errNotApplied = errors.New("условие изменения счетчика не выполнено")
+
+// setMode установка режима синхронизации счетчика
+// Вызывается до начала конкурентного использования счетчика, в том числе
+// после загрузки его состояния из хранилища
+func (i *Incrementator) setMode(mode Mode) {
+	i.mode = mode
+	switch mode {
+	case ModeAtomic:
+		s := i.state
+		i.shared.Store(&s)
+	case ModeStriped:
+		i.striped = CreateStripedCounter()
+		// исходное значение не является изменением счетчика и не увеличивает номер версии
+		i.striped.reset(i.counter)
+		i.stripeStep.Store(i.step)
+	}
+}
+
+// snapshot метод возвращает согласованный снимок состояния счетчика
+// Вызов метода потокобезопасен
+// В режиме ModeStriped значение счетчика в снимке имеет гарантии согласованности StripedCounter,
+// а номер версии учитывает количество примененных изменений
+func (i *Incrementator) snapshot() state {
+	if i.mode == ModeAtomic {
+		return *i.shared.Load()
+	}
+	i.mtx.RLock()
+	s := i.state
+	i.mtx.RUnlock()
+	return i.withStripes(s)
+}
+
+// withStripes метод дополняет настройки счетчика s значением, количеством изменений
+// и временем последнего изменения распределенного счетчика в режиме ModeStriped
+// В остальных режимах возвращает s без изменений
+func (i *Incrementator) withStripes(s state) state {
+	if i.mode != ModeStriped {
+		return s
+	}
+	// количество изменений считывается до значения, чтобы номер версии
+	// не опережал учтенные в снимке изменения
+	s.version += i.striped.Ops()
+	s.counter = i.striped.GetNumber()
+	if modified := i.striped.Modified(); modified > s.modified {
+		s.modified = modified
+	}
+	return s
+}
+
+// export метод возвращает снимок состояния s счетчика в режиме mode в виде State
+func (s state) export(mode Mode) State {
+	st := State{
+		Value:      s.counter,
+		Step:       s.step,
+		MinValue:   s.minValue,
+		MaxValue:   s.maxValue,
+		ResetValue: s.resetValue,
+		Overflow:   s.overflow,
+		Mode:       mode,
+		Wraps:      s.wraps,
+		Version:    s.version,
+	}
+	if s.modified != 0 {
+		st.Modified = time.Unix(0, s.modified)
+	}
+	return st
+}
+
+// ConfigureWith метод атомарно применяет к счетчику настройки s так же, как метод Configure
+// Функция persist, если она задана, вызывается со снимком нового состояния до его фиксации,
+// и ее ошибка отменяет изменение, поэтому сохраненное состояние не расходится с состоянием в памяти
+// В режиме ModeAtomic функция persist вызывается после фиксации изменения, и ее ошибка
+// возвращается в виде *PersistError без отмены изменения
+// Вызов метода потокобезопасен
+func (i *Incrementator) ConfigureWith(s *Settings, persist func(s State) error) error {
+	return i.ConfigureAt(s, time.Time{}, persist)
+}
+
+// ConfigureAt метод применяет к счетчику настройки s так же, как метод ConfigureWith, но временем
+// изменения считается at, а не текущее время; нулевое время at соответствует текущему
+// Вызов метода потокобезопасен
+func (i *Incrementator) ConfigureAt(s *Settings, at time.Time, persist func(s State) error) error {
+	if s == nil {
+		return nil
+	}
+	_, err := i.commitAt(func(st *state) error {
+		return s.apply(st, i.mode)
+	}, persist, unixNano(at))
+	return err
+}
+
+// update изменение состояния счетчика функцией change
+// Функция change изменяет копию текущего состояния, которая фиксируется целиком
+// и с увеличением номера версии, только если функция не вернула ошибку
+// В режиме ModeAtomic функция change может быть вызвана повторно, если состояние
+// было изменено конкурентно, поэтому она не должна накапливать побочные эффекты
+func (i *Incrementator) update(change func(s *state) error) error {
+	_, err := i.commit(change, nil)
+	return err
+}
+
+// commit изменение состояния счетчика функцией change, как в методе update,
+// с вызовом функции сохранения счетчика и функции persist для нового состояния до его фиксации
+// В режиме ModeAtomic попытка изменения может проиграть конкурентному изменению, поэтому
+// функции сохранения вызываются только для зафиксированного состояния, после его фиксации
+// Возвращает зафиксированное состояние счетчика
+func (i *Incrementator) commit(change func(s *state) error, persist func(s State) error) (State, error) {
+	return i.commitAt(change, persist, 0)
+}
+
+// commitAt изменение состояния счетчика, как в методе commit, со временем изменения at
+// в наносекундах от начала эпохи Unix или текущим временем, если at равно нулю
+func (i *Incrementator) commitAt(change func(s *state) error, persist func(s State) error, at int64) (State, error) {
+	if i.mode == ModeAtomic {
+		// снимок публикуется только при успешной замене, поэтому повторные попытки используют его же
+		s := new(state)
+		for {
+			current := i.shared.Load()
+			*s = *current
+			if err := change(s); err != nil {
+				return State{}, err
+			}
+			s.touch(changeTime(at, coarseNow))
+			if i.shared.CompareAndSwap(current, s) {
+				return s.export(i.mode), i.saveCommitted(*s, persist)
+			}
+		}
+	}
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	s := i.state
+	if err := change(&s); err != nil {
+		return State{}, err
+	}
+	s.touch(changeTime(at, wallNow))
+	committed := i.withStripes(s)
+	if err := i.save(committed, persist); err != nil {
+		return State{}, err
+	}
+	i.state = s
+	if i.mode == ModeStriped {
+		i.stripeStep.Store(s.step)
+	}
+	return committed.export(i.mode), nil
+}
+
+// save вызов функции сохранения счетчика и функции persist, если они заданы, для состояния s
+func (i *Incrementator) save(s state, persist func(s State) error) error {
+	if i.persist == nil && persist == nil {
+		return nil
+	}
+	st := s.export(i.mode)
+	if i.persist != nil {
+		if err := i.persist(st); err != nil {
+			return err
+		}
+	}
+	if persist != nil {
+		return persist(st)
+	}
+	return nil
+}
+
+// saveCommitted вызов функций сохранения для уже зафиксированного состояния s
+// Ошибка сохранения не отменяет изменение и возвращается в виде *PersistError
+func (i *Incrementator) saveCommitted(s state, persist func(s State) error) error {
+	if err := i.save(s, persist); err != nil {
+		return &PersistError{Err: err}
+	}
+	return nil
+}
+
+// updateLimits изменение границ диапазона и политики переполнения счетчика
+// Функция change изменяет копию текущих настроек и может отклонить изменение, вернув ошибку
+// Если текущее значение счетчика выходит за новые границы, оно приводится к диапазону
+// согласно новой политике переполнения, а при политике OverflowReject изменение отклоняется
+// В режиме ModeStriped границы диапазона не применяются, поэтому их изменение недоступно
+func (i *Incrementator) updateLimits(change func(l *limits) error) error {
+	if i.mode == ModeStriped {
+		return ErrUnsupportedByMode
+	}
+	return i.update(func(s *state) (err error) {
+		if err = change(&s.limits); err != nil {
+			return
+		}
+		s.counter, _, err = s.limits.apply(s.counter, 0)
+		return
+	})
+}
+
+// add изменение значения счетчика на n шагов в направлении direction (1 или -1)
+// Повторяет логику метода update без замыкания, так как находится на самом частом пути вызова
+// Состояние после изменения включается в результат, только если withState истинно
+// В режиме ModeStriped значения до и после изменения вычисляются по сумме полос
+// после изменения и имеют гарантии согласованности StripedCounter
+func (i *Incrementator) add(direction, n int64, withState bool) (IncrementResult, error) {
+	return i.addAt(direction, n, withState, 0)
+}
+
+// addAt изменение значения счетчика, как в методе add, со временем изменения at
+// в наносекундах от начала эпохи Unix или текущим временем, если at равно нулю
+func (i *Incrementator) addAt(direction, n int64, withState bool, at int64) (IncrementResult, error) {
+	if i.mode == ModeStriped {
+		delta, ok := mulInt64(n, i.stripeStep.Load())
+		if !ok {
+			return IncrementResult{}, ErrIntegerOverflow
+		}
+		delta *= direction
+		i.striped.add(delta, changeTime(at, coarseNow))
+		if i.persist == nil {
+			value := i.striped.GetNumber()
+			return IncrementResult{Previous: value - delta, Value: value}, nil
+		}
+		st := i.GetState()
+		r := IncrementResult{Previous: st.Value - delta, Value: st.Value, State: st}
+		// изменение полосы не откатывается, поэтому состояние сохраняется после его применения
+		if err := i.persist(st); err != nil {
+			return r, &PersistError{Err: err}
+		}
+		return r, nil
+	}
+	if i.mode == ModeAtomic {
+		s := new(state)
+		for {
+			current := i.shared.Load()
+			*s = *current
+			r, err := s.add(direction*s.step, n)
+			if err != nil {
+				return r, err
+			}
+			s.touch(changeTime(at, coarseNow))
+			if i.shared.CompareAndSwap(current, s) {
+				if withState {
+					r.State = s.export(i.mode)
+				}
+				if i.persist != nil {
+					return r, i.saveCommitted(*s, nil)
+				}
+				return r, nil
+			}
+		}
+	}
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	s := i.state
+	r, err := s.add(direction*s.step, n)
+	if err != nil {
+		return r, err
+	}
+	s.touch(changeTime(at, wallNow))
+	if err = i.save(s, nil); err != nil {
+		return IncrementResult{}, err
+	}
+	i.state = s
+	if withState {
+		r.State = s.export(i.mode)
+	}
+	return r, nil
+}
+
+// AddAt метод атомарно изменяет значение счетчика на steps шагов: увеличивает при
+// положительном steps и уменьшает при отрицательном так же, как методы IncrementBy и DecrementBy,
+// но временем изменения считается at, а не текущее время; нулевое время at соответствует текущему
+// Предназначен для применения изменений, время которых уже записано, например в журнал событий,
+// поэтому повторное применение тех же изменений восстанавливает то же время последнего изменения
+// Вызов метода потокобезопасен
+func (i *Incrementator) AddAt(steps int64, at time.Time) (IncrementResult, error) {
+	direction, n := int64(1), steps
+	if steps < 0 {
+		direction, n = -1, -steps
+	}
+	if n < 0 {
+		return IncrementResult{}, errors.New("недопустимое количество шагов изменения счетчика")
+	}
+	return i.addAt(direction, n, true, unixNano(at))
+}
+
+// unixNano функция возвращает время at в наносекундах от начала эпохи Unix или нуль для нулевого времени
+func unixNano(at time.Time) int64 {
+	if at.IsZero() {
+		return 0
+	}
+	return at.UnixNano()
+}
+
+// changeTime функция возвращает время изменения в наносекундах от начала эпохи Unix:
+// заданное время at или, если оно равно нулю, показания часов clock
+func changeTime(at int64, clock func() int64) int64 {
+	if at != 0 {
+		return at
+	}
+	return clock()
+}
+
+// wallNow функция возвращает показания системных часов в наносекундах от начала эпохи Unix
+func wallNow() int64 {
+	return time.Now().UnixNano()
+}
+
+// touch метод увеличивает номер версии состояния и устанавливает время последнего изменения now,
+// но не раньше следующей наносекунды после предыдущего изменения, поэтому время изменений
+// счетчика строго возрастает вместе с номером версии даже при отставании часов
+func (s *state) touch(now int64) {
+	s.version++
+	s.modified = max(now, s.modified+1)
+}
+
+// add метод изменяет значение счетчика в состоянии на n шагов величиной delta
+// с учетом политики переполнения
+func (s *state) add(delta, n int64) (r IncrementResult, err error) {
+	r.Previous = s.counter
+	r.Value, r.Wraps, err = s.limits.applySteps(s.counter, delta, n)
+	if err != nil {
+		return IncrementResult{}, err
+	}
+	r.Wrapped = r.Wraps > 0
+	s.counter = r.Value
+	s.wraps += uint64(r.Wraps)
+	return
+}
@@ -0,0 +1,835 @@
+package counter
+
+// Package main Пакет с реализацией тестового задания
+// Реализован тип потокобезопасного счетчика с интерфейсом использования
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Тестирование функции создания счетчика
+func TestCreateIncrementator(t *testing.T) {
+	incObj := CreateIncrementator()
+	expectedValue := int64(0)
+	expectedMaxValue := int64(1000)
+	expectedStepValue := int64(1)
+	counter := incObj.counter
+	if counter != expectedValue {
+		t.Fatalf(`функция CreateIncrementator создает объект типа Incrementator с некорректным значением счетчика.\n
+		Ожидалось: %d, получено: %d`, expectedValue, counter)
+	}
+	if incObj.maxValue != expectedMaxValue {
+		t.Fatalf(`функция CreateIncrementator создает объект типа Incrementator с некорректным максимальным значением.\n
+		Ожидалось: %d, получено: %d`, expectedMaxValue, incObj.maxValue)
+	}
+	if incObj.step != expectedStepValue {
+		t.Fatalf(`функция CreateIncrementator создает объект типа Incrementator с некорректным шагом инкрементации.\n
+		Ожидалось: %d, получено: %d`, expectedStepValue, incObj.step)
+	}
+}
+
+// Тестирование метода установки значения шага счетчика
+func TestStepValue(t *testing.T) {
+	expectedStepValue := int64(5)
+	incObj := CreateIncrementator()
+	incObj.SetStep(expectedStepValue)
+	if incObj.step != expectedStepValue {
+		t.Fatalf(`функция SetStep отработала некорректно.\n
+		Ожидалось значения шага счетчика: %d, получено: %d`, expectedStepValue, incObj.step)
+	}
+}
+
+// Тестирование метода увеличения значения счетчика
+func TestIncrementNumber(t *testing.T) {
+	incObj := CreateIncrementator()
+	expectedCounterValue := int64(2)
+	for i := int64(0); i < expectedCounterValue; i++ {
+		incObj.IncrementNumber()
+	}
+	if incObj.counter != expectedCounterValue {
+		t.Fatalf(`функция IncrementNumber после %d вызовов отработала некорректно.\n
+		Ожидалось значение счетчика: %d, получено: %d`, expectedCounterValue, expectedCounterValue, incObj.counter)
+	}
+	incObj.maxValue = expectedCounterValue
+	incObj.IncrementNumber()
+	if incObj.counter != 1 {
+		t.Fatalf(`функция IncrementNumber после перехода счетчика через максимальное значение отработала некорректно.\n
+		Ожидалось значение счетчика: %d, получено: %d`, 1, incObj.counter)
+	}
+}
+
+// Тестирование метода получения значения счетчика
+func TestGetNumber(t *testing.T) {
+	incObj := CreateIncrementator()
+	expectedCounterValue := int64(5)
+	// вместо простого присваивания полю counter значения expectedCounterValue
+	// использую средства интерфейса данного типа, дабы симитиривать вызовы стороннего кода
+	for i := int64(0); i < expectedCounterValue; i++ {
+		incObj.IncrementNumber()
+	}
+	if incObj.GetNumber() != expectedCounterValue {
+		t.Fatalf(`функция GetNumber отработала некорректно.\n
+		Ожидалось значение счетчика: %d, получено: %d`, expectedCounterValue, incObj.counter)
+	}
+	incObj.maxValue = expectedCounterValue
+	incObj.IncrementNumber()
+	if incObj.GetNumber() != 1 {
+		t.Fatalf(`функция GetNumber после перехода счетчика через максимальное значение отработала некорректно.\n
+		Ожидалось значение счетчика: %d, получено: %d`, 1, incObj.counter)
+	}
+}
+
+// Тестирование метода установки максимального значения счетчика
+func TestSetMaximumValue(t *testing.T) {
+	maxCounterValue := int64(7)
+	incObj := CreateIncrementator()
+	err := incObj.SetMaximumValue(-7)
+	if err == nil {
+		t.Fatal(`функция SetMaximumValue отработала некорректно.\n
+		Передано некорректное значение максимальной величины счетчика, однако функция не вернула ошибку`)
+	}
+	err = incObj.SetMaximumValue(maxCounterValue)
+	if err != nil {
+		t.Fatal(`функция SetMaximumValue отработала некорректно.\n
+		Передано корректное значение максимальной величины счетчика, однако функция вернула ошибку`)
+	}
+	if incObj.maxValue != maxCounterValue {
+		t.Fatalf(`функция SetMaximumValue отработала некорректно.\n
+			Ожидалось максимальное значения счетчика: %d, получено: %d`, maxCounterValue, incObj.maxValue)
+	}
+	// вместо простого присваивания полю counter значения maxCounterValue+1
+	// использую средства интерфейса данного типа, дабы симитиривать вызовы стороннего кода
+	for i := int64(0); i < maxCounterValue; i++ {
+		incObj.IncrementNumber()
+	}
+	err = incObj.SetMaximumValue(maxCounterValue - 1)
+	if err != nil {
+		t.Fatal(`функция SetMaximumValue отработала некорректно.\n
+		После установки максимального значения меньшего текущего значения
+		счетчика функция вернула ошибку, ожидался сброс счетчика`)
+	}
+	counter := incObj.GetNumber()
+	if counter != ResetValue {
+		t.Fatalf(`функция SetMaximumValue отработала некорректно.\n
+		После установки максимального значения меньшего текущего значения
+		счетчика ожидался сброс счетчика в значение сброса %d, получено: %d`, ResetValue, counter)
+	}
+}
+
+// Тестирование работы счетчика в многопоточном режиме
+func TestIncrementInParalell(t *testing.T) {
+	incObj := CreateIncrementator()
+	goroutineAmount := 10
+	var w sync.WaitGroup
+	w.Add(goroutineAmount)
+	// Запускаем определнное количество горутин, каждая из которых вызывает метод увеличения значения счетчика
+	for i := 0; i < goroutineAmount; i++ {
+		go func(w *sync.WaitGroup) {
+			incObj.IncrementNumber()
+			w.Done()
+		}(&w)
+	}
+	w.Wait()
+	// ...проверям, каждой ли горутине удалось успешно вызвать метод
+	counter := incObj.GetNumber()
+	if counter != int64(goroutineAmount) {
+		t.Fatalf(`функция IncrementNumber отработала некорректно в конкурентом режиме.\n
+		Ожидалось значения счетчика: %d, получено: %d`, goroutineAmount, counter)
+	}
+}
+
+// Тестирование многопоточной установки максимального значения
+func TestSetMaximumValueInParalell(t *testing.T) {
+	var w sync.WaitGroup
+	var mtx = sync.Mutex{}
+	ch := make(chan bool)
+	incObj := CreateIncrementator()
+	goroutineAmount := 10
+	// задаем максимальное число счетчика, ожидая что
+	// в многопоточном режиме последующие инкременты начнут отсчет заново
+	maxCounterValue := int64(8)
+	// А здесь - ожидаемое значение счетчика в итоге
+	expectedCounterValue := int64(goroutineAmount) - maxCounterValue
+	w.Add(goroutineAmount)
+	// Запускаем определенное количество горутин, каждая из которых вызывает метод увеличения значения счетчика
+	for i := 0; i < goroutineAmount; i++ {
+		go func() {
+			mtx.Lock()
+			incObj.IncrementNumber()
+			if incObj.GetNumber() == maxCounterValue {
+				ch <- true
+				<-ch
+			}
+			mtx.Unlock()
+			w.Done()
+		}()
+	}
+	go func() {
+		<-ch
+		incObj.SetMaximumValue(maxCounterValue)
+		ch <- true
+	}()
+	w.Wait()
+	counter := incObj.GetNumber()
+	if counter != expectedCounterValue {
+		t.Fatalf(`функция SetMaximumValue отработала некорректно в конкурентом режиме.\n
+		Ожидалось значения счетчика: %d, получено: %d`, expectedCounterValue, counter)
+	}
+}
+
+// Тестирование метода уменьшения значения счетчика
+func TestDecrementNumber(t *testing.T) {
+	incObj := CreateIncrementator()
+	incObj.SetStep(2)
+	for i := 0; i < 3; i++ {
+		incObj.IncrementNumber()
+	}
+	incObj.DecrementNumber()
+	if counter := incObj.GetNumber(); counter != 4 {
+		t.Fatalf(`функция DecrementNumber отработала некорректно.\n
+		Ожидалось значение счетчика: %d, получено: %d`, 4, counter)
+	}
+	// при выходе за минимальное значение счетчику присваивается максимальное значение
+	incObj.SetMaximumValue(10)
+	incObj.DecrementNumber()
+	incObj.DecrementNumber()
+	incObj.DecrementNumber()
+	if counter := incObj.GetNumber(); counter != 10 {
+		t.Fatalf(`функция DecrementNumber после перехода счетчика через минимальное значение отработала некорректно.\n
+		Ожидалось значение счетчика: %d, получено: %d`, 10, counter)
+	}
+}
+
+// Тестирование метода установки минимального значения счетчика
+func TestSetMinimumValue(t *testing.T) {
+	incObj := CreateIncrementator()
+	err := incObj.SetMinimumValue(InitMaxValue + 1)
+	if err == nil {
+		t.Fatal(`функция SetMinimumValue отработала некорректно.\n
+		Передано минимальное значение, превышающее максимальное, однако функция не вернула ошибку`)
+	}
+	err = incObj.SetMinimumValue(-5)
+	if err != nil {
+		t.Fatalf("функция SetMinimumValue вернула ошибку: %q", err.Error())
+	}
+	incObj.DecrementNumber()
+	if counter := incObj.GetNumber(); counter != -1 {
+		t.Fatalf(`функция DecrementNumber с отрицательным минимальным значением отработала некорректно.\n
+		Ожидалось значение счетчика: %d, получено: %d`, -1, counter)
+	}
+	// счетчик, оказавшийся ниже нового минимального значения, приводится к диапазону по политике переполнения
+	err = incObj.SetMinimumValue(3)
+	if err != nil {
+		t.Fatalf("функция SetMinimumValue вернула ошибку: %q", err.Error())
+	}
+	if counter := incObj.GetNumber(); counter != InitMaxValue {
+		t.Fatalf(`функция SetMinimumValue отработала некорректно.\n
+		Ожидалось значение счетчика: %d, получено: %d`, InitMaxValue, counter)
+	}
+	if err = incObj.SetMaximumValue(2); err == nil {
+		t.Fatal(`функция SetMaximumValue не вернула ошибку при установке максимального значения меньше минимального`)
+	}
+	// одновременный сдвиг обеих границ
+	if err = incObj.SetRange(-20, -10); err != nil {
+		t.Fatalf("функция SetRange вернула ошибку: %q", err.Error())
+	}
+	if counter := incObj.GetNumber(); counter != -20 {
+		t.Fatalf(`функция SetRange отработала некорректно.\n
+		Ожидалось значение счетчика: %d, получено: %d`, -20, counter)
+	}
+	if err = incObj.SetRange(1, 0); err == nil {
+		t.Fatal(`функция SetRange не вернула ошибку при минимальном значении больше максимального`)
+	}
+}
+
+// Тестирование политик переполнения счетчика
+func TestOverflowPolicies(t *testing.T) {
+	cases := []struct {
+		policy   OverflowPolicy
+		counter  int64
+		delta    int64
+		expected int64
+		reject   bool
+	}{
+		{OverflowWrap, 8, 3, 2, false},
+		{OverflowWrap, 1, -3, 9, false},
+		{OverflowSaturate, 8, 3, 9, false},
+		{OverflowSaturate, 1, -3, 0, false},
+		{OverflowReject, 8, 3, 8, true},
+		{OverflowReject, 1, -3, 1, true},
+		{OverflowCarry, 8, 3, 1, false},
+		{OverflowCarry, 1, -3, 8, false},
+		{OverflowCarry, 5, 27, 2, false},
+		{OverflowCarry, 5, -27, 8, false},
+	}
+	for _, c := range cases {
+		l := limits{minValue: 0, maxValue: 9, resetValue: 2, overflow: c.policy}
+		counter, _, err := l.apply(c.counter, c.delta)
+		if c.reject {
+			var overflowErr *OverflowError
+			if !errors.As(err, &overflowErr) {
+				t.Fatalf("политика %s: ожидалась ошибка типа *OverflowError, получено: %v", c.policy, err)
+			}
+		} else if err != nil {
+			t.Fatalf("политика %s: получена ошибка: %q", c.policy, err.Error())
+		}
+		if counter != c.expected {
+			t.Fatalf("политика %s: изменение счетчика %d на %d отработало некорректно.\nОжидалось значение счетчика: %d, получено: %d",
+				c.policy, c.counter, c.delta, c.expected, counter)
+		}
+	}
+}
+
+// Тестирование настройки политики переполнения и значения сброса счетчика
+func TestSetOverflowPolicy(t *testing.T) {
+	incObj := CreateIncrementator()
+	if err := incObj.SetOverflowPolicy(OverflowPolicy(42)); err != ErrInvalidOverflowPolicy {
+		t.Fatalf("функция SetOverflowPolicy не вернула ошибку при установке неизвестной политики, получено: %v", err)
+	}
+	if err := incObj.SetResetValue(InitMaxValue + 1); err == nil {
+		t.Fatal("функция SetResetValue не вернула ошибку при установке значения сброса вне диапазона")
+	}
+	incObj.SetMaximumValue(3)
+	incObj.SetResetValue(2)
+	for i := 0; i < 4; i++ {
+		incObj.IncrementNumber()
+	}
+	if counter := incObj.GetNumber(); counter != 2 {
+		t.Fatalf("Ожидалось значение счетчика после сброса: %d, получено: %d", 2, counter)
+	}
+	incObj.SetOverflowPolicy(OverflowReject)
+	incObj.IncrementNumber()
+	if err := incObj.IncrementNumber(); err == nil {
+		t.Fatal("функция IncrementNumber не вернула ошибку при переполнении по политике OverflowReject")
+	}
+	if counter := incObj.GetNumber(); counter != 3 {
+		t.Fatalf("Отклоненное изменение счетчика было применено, ожидалось значение счетчика: %d, получено: %d", 3, counter)
+	}
+	// при политике OverflowReject границы, исключающие текущее значение, не применяются
+	if err := incObj.SetMaximumValue(2); err == nil {
+		t.Fatal("функция SetMaximumValue не вернула ошибку при политике OverflowReject")
+	}
+	incObj.SetOverflowPolicy(OverflowSaturate)
+	if err := incObj.SetMaximumValue(2); err != nil {
+		t.Fatalf("функция SetMaximumValue вернула ошибку: %q", err.Error())
+	}
+	if counter := incObj.GetNumber(); counter != 2 {
+		t.Fatalf("Ожидалось значение счетчика после уменьшения максимального значения: %d, получено: %d", 2, counter)
+	}
+}
+
+// Тестирование атомарного получения значений счетчика при его изменении
+func TestIncrementResult(t *testing.T) {
+	incObj := CreateIncrementator()
+	incObj.SetMaximumValue(2)
+	expected := []IncrementResult{{Previous: 0, Value: 1}, {Previous: 1, Value: 2}, {Previous: 2, Value: ResetValue, Wrapped: true, Wraps: 1}}
+	for k, e := range expected {
+		r, err := incObj.Increment()
+		if err != nil {
+			t.Fatalf("функция Increment вернула ошибку: %q", err.Error())
+		}
+		// состояние после изменения получено вместе с ним
+		if r.State.Value != r.Value || r.State.Version != uint64(k+2) || r.State.Wraps != uint64(r.Wraps) {
+			t.Fatalf("Неверное состояние счетчика в результате изменения: %+v", r)
+		}
+		if r.State = (State{}); r != e {
+			t.Fatalf("функция Increment отработала некорректно.\nОжидалось: %+v, получено: %+v", e, r)
+		}
+	}
+	r, _ := incObj.Decrement()
+	if r.State = (State{}); r != (IncrementResult{Previous: ResetValue, Value: 0}) {
+		t.Fatalf("функция Decrement отработала некорректно, получено: %+v", r)
+	}
+	// состояние возвращают и условные изменения и присваивания во всех режимах с линеаризуемым значением
+	for _, mode := range []Mode{ModeMutex, ModeAtomic} {
+		incObj, _ = CreateIncrementatorWithOptions(WithMode(mode))
+		r, ok, err := incObj.IncrementIf(10)
+		if !ok || err != nil || r.State.Value != 1 || r.State.Version != 1 {
+			t.Fatalf("режим %s: неверный результат IncrementIf: %+v, ошибка: %v", mode, r, err)
+		}
+		if r, err = incObj.Swap(5); err != nil || r.Previous != 1 || r.Value != 5 || r.State.Value != 5 || r.State.Version != 2 {
+			t.Fatalf("режим %s: неверный результат Swap: %+v, ошибка: %v", mode, r, err)
+		}
+		if r, ok, err = incObj.SwapIf(4, 7); ok || err != nil || r.Value != 5 || r.State.Version != 0 {
+			t.Fatalf("режим %s: неверный результат невыполненного SwapIf: %+v, ошибка: %v", mode, r, err)
+		}
+		if r, ok, err = incObj.SwapIf(5, 7); !ok || err != nil || r.Previous != 5 || r.State.Value != 7 || r.State.Version != 3 {
+			t.Fatalf("режим %s: неверный результат SwapIf: %+v, ошибка: %v", mode, r, err)
+		}
+	}
+}
+
+// Тестирование уникальности значений, возвращаемых при конкурентном увеличении счетчика
+func TestIncrementSequenceInParalell(t *testing.T) {
+	incObj := CreateIncrementator()
+	goroutineAmount := 100
+	values := make(chan int64, goroutineAmount)
+	var w sync.WaitGroup
+	w.Add(goroutineAmount)
+	for i := 0; i < goroutineAmount; i++ {
+		go func() {
+			defer w.Done()
+			r, _ := incObj.Increment()
+			values <- r.Value
+		}()
+	}
+	w.Wait()
+	close(values)
+	seen := make(map[int64]bool)
+	for v := range values {
+		if seen[v] {
+			t.Fatalf("функция Increment вернула повторяющееся значение счетчика %d в конкурентном режиме", v)
+		}
+		seen[v] = true
+	}
+}
+
+// Тестирование эквивалентности изменения счетчика на n шагов n последовательным изменениям
+func TestApplySteps(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	policies := []OverflowPolicy{OverflowWrap, OverflowSaturate, OverflowReject, OverflowCarry}
+	for k := 0; k < 2000; k++ {
+		l := limits{minValue: rnd.Int63n(20) - 10, overflow: policies[rnd.Intn(len(policies))]}
+		l.maxValue = l.minValue + rnd.Int63n(30)
+		l.resetValue = l.minValue + rnd.Int63n(l.maxValue-l.minValue+1)
+		counter := l.minValue + rnd.Int63n(l.maxValue-l.minValue+1)
+		step := rnd.Int63n(15) - 7
+		n := rnd.Int63n(50)
+		expected, expectedWraps := counter, int64(0)
+		var expectedErr error
+		for j := int64(0); j < n; j++ {
+			value, wrapped, err := l.apply(expected, step)
+			if err != nil {
+				expected, expectedWraps, expectedErr = counter, 0, err
+				break
+			}
+			expected = value
+			if wrapped {
+				expectedWraps++
+			}
+		}
+		value, wraps, err := l.applySteps(counter, step, n)
+		if (err != nil) != (expectedErr != nil) || value != expected || wraps != expectedWraps {
+			t.Fatalf("функция applySteps отработала некорректно для %+v, счетчик %d, шаг %d, шагов %d.\n"+
+				"Ожидалось: %d (переходов %d, ошибка %v), получено: %d (переходов %d, ошибка %v)",
+				l, counter, step, n, expected, expectedWraps, expectedErr, value, wraps, err)
+		}
+		// вычисление в длинной арифметике для счетчика произвольной точности дает тот же результат
+		bigValue, bigWraps, err := l.toBig().applySteps(big.NewInt(counter), big.NewInt(step), uint64(n))
+		if (err != nil) != (expectedErr != nil) || bigValue.Int64() != expected || bigWraps != uint64(expectedWraps) {
+			t.Fatalf("функция applySteps счетчика произвольной точности отработала некорректно для %+v, счетчик %d, шаг %d, шагов %d.\n"+
+				"Ожидалось: %d (переходов %d), получено: %s (переходов %d, ошибка %v)",
+				l, counter, step, n, expected, expectedWraps, bigValue, bigWraps, err)
+		}
+	}
+}
+
+// Тестирование атомарного изменения счетчика на несколько шагов
+func TestIncrementBy(t *testing.T) {
+	incObj := CreateIncrementator()
+	incObj.SetMaximumValue(9)
+	incObj.SetStep(2)
+	r, err := incObj.IncrementBy(12)
+	if err != nil {
+		t.Fatalf("функция IncrementBy вернула ошибку: %q", err.Error())
+	}
+	// 0 -> 2 -> ... -> 8 -> сброс в 1 -> 3 -> ... -> 9 -> сброс в 1 -> 3 -> 5
+	if e := (IncrementResult{Previous: 0, Value: 5, Wrapped: true, Wraps: 2}); r.Previous != e.Previous || r.Value != e.Value || r.Wrapped != e.Wrapped || r.Wraps != e.Wraps {
+		t.Fatalf("функция IncrementBy отработала некорректно.\nОжидалось: %+v, получено: %+v", e, r)
+	}
+	if _, err = incObj.IncrementBy(-1); err == nil {
+		t.Fatal("функция IncrementBy не вернула ошибку при отрицательном количестве шагов")
+	}
+	incObj.SetOverflowPolicy(OverflowReject)
+	if _, err = incObj.IncrementBy(4); err == nil {
+		t.Fatal("функция IncrementBy не вернула ошибку при переполнении по политике OverflowReject")
+	}
+	if counter := incObj.GetNumber(); counter != 5 {
+		t.Fatalf("Отклоненное изменение счетчика было частично применено, ожидалось значение счетчика: %d, получено: %d", 5, counter)
+	}
+	r, _ = incObj.DecrementBy(2)
+	if r.Value != 1 {
+		t.Fatalf("функция DecrementBy отработала некорректно.\nОжидалось значение счетчика: %d, получено: %d", 1, r.Value)
+	}
+}
+
+// Тестирование условного присваивания значения счетчику
+func TestCompareAndSwap(t *testing.T) {
+	incObj := CreateIncrementator()
+	swapped, err := incObj.CompareAndSwap(1, 5)
+	if err != nil || swapped {
+		t.Fatalf("функция CompareAndSwap выполнила присваивание при несовпадающем значении счетчика, ошибка: %v", err)
+	}
+	swapped, err = incObj.CompareAndSwap(0, 5)
+	if err != nil || !swapped {
+		t.Fatalf("функция CompareAndSwap не выполнила присваивание при совпадающем значении счетчика, ошибка: %v", err)
+	}
+	if counter := incObj.GetNumber(); counter != 5 {
+		t.Fatalf("Ожидалось значение счетчика: %d, получено: %d", 5, counter)
+	}
+	if _, err = incObj.CompareAndSwap(5, InitMaxValue+1); err != ErrValueOutOfRange {
+		t.Fatalf("функция CompareAndSwap не вернула ошибку при значении вне диапазона, получено: %v", err)
+	}
+	previous, err := incObj.SetValue(7)
+	if err != nil || previous != 5 {
+		t.Fatalf("функция SetValue отработала некорректно, предыдущее значение: %d, ошибка: %v", previous, err)
+	}
+	if _, err = incObj.SetValue(-1); err != ErrValueOutOfRange {
+		t.Fatalf("функция SetValue не вернула ошибку при значении вне диапазона, получено: %v", err)
+	}
+	// конкурентные клиенты, увеличивающие счетчик через CompareAndSwap, не теряют изменений
+	goroutineAmount := 20
+	var w sync.WaitGroup
+	w.Add(goroutineAmount)
+	for i := 0; i < goroutineAmount; i++ {
+		go func() {
+			defer w.Done()
+			for {
+				current := incObj.GetNumber()
+				if swapped, _ := incObj.CompareAndSwap(current, current+1); swapped {
+					return
+				}
+			}
+		}()
+	}
+	w.Wait()
+	if counter := incObj.GetNumber(); counter != int64(7+goroutineAmount) {
+		t.Fatalf("Ожидалось значение счетчика: %d, получено: %d", 7+goroutineAmount, counter)
+	}
+}
+
+// Тестирование условного увеличения счетчика
+func TestIncrementIf(t *testing.T) {
+	incObj := CreateIncrementator()
+	limit := int64(3)
+	goroutineAmount := 10
+	var applied int64
+	var mtx sync.Mutex
+	var w sync.WaitGroup
+	w.Add(goroutineAmount)
+	for i := 0; i < goroutineAmount; i++ {
+		go func() {
+			defer w.Done()
+			_, ok, err := incObj.IncrementIf(limit)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				mtx.Lock()
+				applied++
+				mtx.Unlock()
+			}
+		}()
+	}
+	w.Wait()
+	if applied != limit || incObj.GetNumber() != limit {
+		t.Fatalf("функция IncrementIf отработала некорректно: выполнено увеличений %d, значение счетчика %d, ожидалось %d", applied, incObj.GetNumber(), limit)
+	}
+}
+
+// Тестирование получения согласованного снимка состояния счетчика
+func TestGetState(t *testing.T) {
+	incObj := CreateIncrementator()
+	if st := incObj.GetState(); !st.Modified.IsZero() || st.Wraps != 0 {
+		t.Fatalf("функция GetState вернула некорректное состояние нового счетчика: %+v", st)
+	}
+	incObj.SetMaximumValue(4)
+	incObj.SetStep(2)
+	incObj.IncrementBy(5)
+	st := incObj.GetState()
+	// 0 -> 2 -> 4 -> сброс в 1 -> 3 -> сброс в 1
+	e := State{Value: 1, Step: 2, MinValue: InitMinValue, MaxValue: 4, ResetValue: ResetValue, Overflow: OverflowWrap, Mode: ModeMutex, Wraps: 2}
+	if st.Modified.IsZero() {
+		t.Fatal("функция GetState не вернула время последнего изменения счетчика")
+	}
+	st.Modified, st.Version = e.Modified, e.Version
+	if st != e {
+		t.Fatalf("функция GetState отработала некорректно.\nОжидалось: %+v, получено: %+v", e, st)
+	}
+	striped := CreateStripedIncrementator()
+	striped.IncrementNumber()
+	if st = striped.GetState(); st.Value != 1 || st.Mode != ModeStriped || st.Modified.IsZero() {
+		t.Fatalf("функция GetState отработала некорректно для распределенного счетчика: %+v", st)
+	}
+}
+
+// Тестирование возрастания времени последнего изменения вместе с номером версии:
+// в режиме ModeAtomic изменения в пределах одного периода грубых часов получают различное время
+func TestModifiedIncreases(t *testing.T) {
+	for _, incObj := range []*Incrementator{CreateIncrementator(), CreateAtomicIncrementator()} {
+		previous := incObj.GetState()
+		for k := 0; k < 100; k++ {
+			incObj.IncrementNumber()
+			st := incObj.GetState()
+			if st.Version != previous.Version+1 || !st.Modified.After(previous.Modified) {
+				t.Fatalf("режим %s: время изменения не возрастает с номером версии: %+v после %+v", incObj.Mode(), st, previous)
+			}
+			previous = st
+		}
+	}
+}
+
+// legacyIncrementator прежняя реализация счетчика с отдельными мьютексами для значения,
+// максимального значения и шага, используется только для сравнения производительности
+type legacyIncrementator struct {
+	step        int64
+	counter     int64
+	maxValue    int64
+	mtxCounter  sync.RWMutex
+	mtxMaxValue sync.RWMutex
+	mtxStep     sync.RWMutex
+}
+
+func (i *legacyIncrementator) GetNumber() int64 {
+	i.mtxCounter.RLock()
+	defer i.mtxCounter.RUnlock()
+	return i.counter
+}
+
+func (i *legacyIncrementator) IncrementNumber() {
+	i.mtxMaxValue.RLock()
+	maxCounterValue := i.maxValue
+	i.mtxMaxValue.RUnlock()
+	i.mtxStep.RLock()
+	step := i.step
+	i.mtxStep.RUnlock()
+	i.mtxCounter.Lock()
+	defer i.mtxCounter.Unlock()
+	i.counter += step
+	if i.counter > maxCounterValue {
+		i.counter = ResetValue
+	}
+}
+
+// runContended выполнение b.N операций op, распределенных между goroutines горутинами
+func runContended(b *testing.B, goroutines int, op func(k int)) {
+	var w sync.WaitGroup
+	perGoroutine := b.N/goroutines + 1
+	w.Add(goroutines)
+	b.ResetTimer()
+	for g := 0; g < goroutines; g++ {
+		go func() {
+			defer w.Done()
+			for k := 0; k < perGoroutine; k++ {
+				op(k)
+			}
+		}()
+	}
+	w.Wait()
+}
+
+// Сравнение пропускной способности счетчика с единым состоянием и прежней реализации
+// с тремя мьютексами при конкурентном увеличении и при преобладании чтения (одна запись на восемь операций)
+func BenchmarkIncrementContention(b *testing.B) {
+	for _, goroutines := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("single-state/increment/goroutines-%d", goroutines), func(b *testing.B) {
+			incObj := CreateIncrementator()
+			incObj.SetMaximumValue(math.MaxInt)
+			runContended(b, goroutines, func(int) { incObj.IncrementNumber() })
+		})
+		b.Run(fmt.Sprintf("three-mutex/increment/goroutines-%d", goroutines), func(b *testing.B) {
+			incObj := &legacyIncrementator{step: 1, maxValue: math.MaxInt}
+			runContended(b, goroutines, func(int) { incObj.IncrementNumber() })
+		})
+		b.Run(fmt.Sprintf("single-state/read-mostly/goroutines-%d", goroutines), func(b *testing.B) {
+			incObj := CreateIncrementator()
+			incObj.SetMaximumValue(math.MaxInt)
+			runContended(b, goroutines, func(k int) {
+				if k%8 == 0 {
+					incObj.IncrementNumber()
+				} else {
+					incObj.GetNumber()
+				}
+			})
+		})
+		b.Run(fmt.Sprintf("three-mutex/read-mostly/goroutines-%d", goroutines), func(b *testing.B) {
+			incObj := &legacyIncrementator{step: 1, maxValue: math.MaxInt}
+			runContended(b, goroutines, func(k int) {
+				if k%8 == 0 {
+					incObj.IncrementNumber()
+				} else {
+					incObj.GetNumber()
+				}
+			})
+		})
+	}
+}
+
+// Тестирование согласованности снимков состояния при конкурентном изменении счетчика и его настроек
+func TestSnapshotConsistency(t *testing.T) {
+	incObj := CreateIncrementator()
+	var w sync.WaitGroup
+	done := make(chan struct{})
+	w.Add(2)
+	go func() {
+		defer w.Done()
+		for k := 0; k < 1000; k++ {
+			incObj.IncrementNumber()
+		}
+	}()
+	go func() {
+		defer w.Done()
+		for k := 0; k < 1000; k++ {
+			incObj.SetRange(int64(k%10), int64(k%10+5))
+		}
+	}()
+	go func() {
+		w.Wait()
+		close(done)
+	}()
+	var lastVersion uint64
+	for {
+		s := incObj.snapshot()
+		if s.counter < s.minValue || s.counter > s.maxValue {
+			t.Fatalf("Несогласованный снимок состояния: значение %d вне диапазона [%d, %d]", s.counter, s.minValue, s.maxValue)
+		}
+		if s.version < lastVersion {
+			t.Fatalf("Номер версии снимка состояния уменьшился: %d после %d", s.version, lastVersion)
+		}
+		lastVersion = s.version
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+}
+
+// Тестирование счетчика в режиме ModeAtomic
+func TestAtomicIncrementator(t *testing.T) {
+	incObj := CreateAtomicIncrementator()
+	if incObj.Mode() != ModeAtomic {
+		t.Fatalf("функция CreateAtomicIncrementator создала счетчик в режиме %s", incObj.Mode())
+	}
+	incObj.SetMaximumValue(2)
+	expected := []IncrementResult{{Previous: 0, Value: 1}, {Previous: 1, Value: 2}, {Previous: 2, Value: ResetValue, Wrapped: true, Wraps: 1}}
+	for _, e := range expected {
+		if r, _ := incObj.Increment(); r.Previous != e.Previous || r.Value != e.Value || r.Wrapped != e.Wrapped || r.Wraps != e.Wraps || r.State.Value != e.Value {
+			t.Fatalf("функция Increment в режиме ModeAtomic отработала некорректно.\nОжидалось: %+v, получено: %+v", e, r)
+		}
+	}
+	if swapped, _ := incObj.CompareAndSwap(ResetValue, 0); !swapped {
+		t.Fatal("функция CompareAndSwap в режиме ModeAtomic не выполнила присваивание")
+	}
+	// конкурентные увеличения не теряются и не выходят за границы диапазона
+	incObj.SetMaximumValue(InitMaxValue)
+	goroutineAmount := 50
+	var w sync.WaitGroup
+	w.Add(goroutineAmount)
+	for i := 0; i < goroutineAmount; i++ {
+		go func() {
+			defer w.Done()
+			for k := 0; k < 100; k++ {
+				incObj.IncrementNumber()
+			}
+		}()
+	}
+	w.Wait()
+	// 5000 увеличений при максимальном значении 1000: 1000 шагов до первого сброса,
+	// затем циклы по 1000 шагов от значения сброса 1 до 1000
+	if counter := incObj.GetNumber(); counter != 1000 {
+		t.Fatalf("функция IncrementNumber отработала некорректно в режиме ModeAtomic.\nОжидалось значение счетчика: %d, получено: %d", 1000, counter)
+	}
+	if s := incObj.snapshot(); s.version != 5006 {
+		t.Fatalf("Неверный номер версии состояния в режиме ModeAtomic: %d", s.version)
+	}
+}
+
+// Тестирование количества размещений в памяти при изменении счетчика в режиме ModeAtomic:
+// новый снимок состояния размещается один раз на изменение, а не на каждую попытку замены
+func TestAtomicIncrementAllocs(t *testing.T) {
+	incObj := CreateAtomicIncrementator()
+	incObj.SetMaximumValue(math.MaxInt)
+	if allocs := testing.AllocsPerRun(100, func() { incObj.IncrementNumber() }); allocs != 1 {
+		t.Fatalf("функция IncrementNumber в режиме ModeAtomic размещает в памяти %v объектов вместо одного", allocs)
+	}
+}
+
+// Тестирование применения изменений счетчика с заданным временем изменения
+func TestChangeAt(t *testing.T) {
+	at := time.Unix(0, time.Now().Add(-time.Hour).UnixNano())
+	for _, create := range []func() *Incrementator{CreateIncrementator, CreateAtomicIncrementator, CreateStripedIncrementator} {
+		incObj := create()
+		r, err := incObj.AddAt(3, at)
+		if err != nil {
+			t.Fatalf("метод AddAt вернул ошибку: %q", err.Error())
+		}
+		s := incObj.GetState()
+		if r.Value != 3 || s.Value != 3 || !s.Modified.Equal(at) {
+			t.Fatalf("Неверное состояние счетчика в режиме %s после AddAt, ожидалось время изменения %v, получено: %+v", s.Mode, at, s)
+		}
+		at = at.Add(time.Second)
+		if r, err = incObj.AddAt(-2, at); err != nil || r.Previous != 3 || r.Value != 1 {
+			t.Fatalf("Неверный результат AddAt в режиме %s: %+v, ошибка: %v", s.Mode, r, err)
+		}
+		at = at.Add(time.Second)
+		step := int64(2)
+		if err = incObj.ConfigureAt(&Settings{Step: &step}, at, nil); err != nil {
+			t.Fatalf("метод ConfigureAt вернул ошибку: %q", err.Error())
+		}
+		if s = incObj.GetState(); s.Step != step || !s.Modified.Equal(at) {
+			t.Fatalf("Неверное состояние счетчика в режиме %s после ConfigureAt, получено: %+v", s.Mode, s)
+		}
+		if s.Mode != ModeStriped {
+			at = at.Add(time.Second)
+			if r, err = incObj.SwapAt(7, at); err != nil || r.Previous != 1 || !r.State.Modified.Equal(at) {
+				t.Fatalf("Неверный результат SwapAt в режиме %s: %+v, ошибка: %v", s.Mode, r, err)
+			}
+		}
+		// время изменения задается только для одного вызова, поэтому следующие изменения берут время из часов
+		if err = incObj.IncrementNumber(); err != nil {
+			t.Fatalf("функция IncrementNumber вернула ошибку: %q", err.Error())
+		}
+		if s = incObj.GetState(); !s.Modified.After(at.Add(time.Minute)) {
+			t.Fatalf("Неверное время изменения счетчика в режиме %s, получено: %+v", s.Mode, s)
+		}
+	}
+	// время изменения, заданное одному вызову, не получают конкурентные изменения
+	incObj := CreateAtomicIncrementator()
+	incObj.SetMaximumValue(math.MaxInt64)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for k := 0; k < 1000; k++ {
+			incObj.AddAt(1, at)
+		}
+	}()
+	for k := 0; k < 1000; k++ {
+		r, err := incObj.Increment()
+		if err != nil {
+			t.Fatalf("функция Increment вернула ошибку: %q", err.Error())
+		}
+		if r.State.Modified.Before(at.Add(time.Minute)) {
+			t.Fatalf("Конкурентное изменение получило время другого изменения: %+v", r.State)
+		}
+	}
+	<-done
+}
+
+// Сравнение пропускной способности счетчика в режимах ModeMutex, ModeAtomic и ModeStriped при конкурентном увеличении
+func BenchmarkIncrementModes(b *testing.B) {
+	modes := []struct {
+		name   string
+		create func() *Incrementator
+	}{
+		{"mutex", CreateIncrementator},
+		{"atomic", CreateAtomicIncrementator},
+		{"striped", CreateStripedIncrementator},
+	}
+	for _, goroutines := range []int{1, 2, 4, 8, 16, 32, 64} {
+		for _, mode := range modes {
+			b.Run(fmt.Sprintf("%s/goroutines-%d", mode.name, goroutines), func(b *testing.B) {
+				incObj := mode.create()
+				incObj.SetMaximumValue(math.MaxInt)
+				runContended(b, goroutines, func(int) { incObj.IncrementNumber() })
+			})
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+const (
+	// DefaultValue исходное значение счетчика по умолчанию
+	DefaultValue int64 = 0
+	// DefaultStep шаг инкрементации счетчика по умолчанию
+	DefaultStep int64 = 1
+	// DefaultMaxValue максимальное значение счетчика по умолчанию
+	DefaultMaxValue int64 = 1000
+	// DefaultMinValue минимальное значение счетчика по умолчанию
+	DefaultMinValue int64 = 0
+	// DefaultResetValue значение сброса счетчика по умолчанию
+	DefaultResetValue int64 = 1
+	// DefaultOverflowPolicy политика переполнения счетчика по умолчанию
+	DefaultOverflowPolicy OverflowPolicy = OverflowWrap
+)
+
+// Config исходная конфигурация отдельного счетчика
+// В отличие от переменных InitValue, InitStep и т.д. конфигурация принадлежит
+// создаваемому счетчику, поэтому разные части программы могут создавать счетчики
+// с разными настройками по умолчанию независимо друг от друга
+type Config struct {
+	Value      int64          // исходное значение счетчика
+	Step       int64          // шаг инкрементации
+	MinValue   int64          // минимальное значение счетчика
+	MaxValue   int64          // максимальное значение счетчика
+	ResetValue int64          // значение сброса для политики OverflowWrap
+	Overflow   OverflowPolicy // политика переполнения
+	Mode       Mode           // режим синхронизации
+	// Persist функция сохранения состояния счетчика, вызываемая при каждом изменении
+	// со снимком нового состояния; nil - состояние не сохраняется
+	Persist func(s State) error
+}
+
+// Option функция, изменяющая конфигурацию создаваемого счетчика
+type Option func(c *Config)
+
+// DefaultConfig функция возвращает конфигурацию счетчика по умолчанию
+func DefaultConfig() Config {
+	return Config{
+		Value:      DefaultValue,
+		Step:       DefaultStep,
+		MinValue:   DefaultMinValue,
+		MaxValue:   DefaultMaxValue,
+		ResetValue: DefaultResetValue,
+		Overflow:   DefaultOverflowPolicy,
+	}
+}
+
+// WithValue параметр исходного значения счетчика
+func WithValue(value int64) Option {
+	return func(c *Config) { c.Value = value }
+}
+
+// WithStep параметр шага инкрементации счетчика
+func WithStep(step int64) Option {
+	return func(c *Config) { c.Step = step }
+}
+
+// WithMinValue параметр минимального значения счетчика
+func WithMinValue(minValue int64) Option {
+	return func(c *Config) { c.MinValue = minValue }
+}
+
+// WithMaxValue параметр максимального значения счетчика
+func WithMaxValue(maxValue int64) Option {
+	return func(c *Config) { c.MaxValue = maxValue }
+}
+
+// WithRange параметр минимального и максимального значений счетчика
+func WithRange(minValue, maxValue int64) Option {
+	return func(c *Config) { c.MinValue, c.MaxValue = minValue, maxValue }
+}
+
+// WithResetValue параметр значения сброса счетчика для политики OverflowWrap
+func WithResetValue(resetValue int64) Option {
+	return func(c *Config) { c.ResetValue = resetValue }
+}
+
+// WithOverflowPolicy параметр политики переполнения счетчика
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(c *Config) { c.Overflow = policy }
+}
+
+// WithMode параметр режима синхронизации счетчика
+func WithMode(mode Mode) Option {
+	return func(c *Config) { c.Mode = mode }
+}
+
+// WithPersist параметр функции сохранения состояния счетчика
+// Функция вызывается при каждом изменении со снимком нового состояния до его фиксации,
+// и ее ошибка отменяет изменение, а в режимах ModeAtomic и ModeStriped - после фиксации изменения,
+// и ее ошибка возвращается в виде *PersistError без отмены изменения
+func WithPersist(persist func(s State) error) Option {
+	return func(c *Config) { c.Persist = persist }
+}
+
+// CreateIncrementatorWithOptions функция создает новый объет типа Incrementator
+// с конфигурацией по умолчанию, измененной параметрами opts, и возвращает указатель на него.
+// В случае недопустимой конфигурации возвращает ошибку типа *SettingsError
+// со списком всех недопустимых полей
+func CreateIncrementatorWithOptions(opts ...Option) (*Incrementator, error) {
+	c := DefaultConfig()
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return CreateIncrementatorFromConfig(c)
+}
+
+// CreateIncrementatorFromConfig функция создает новый объет типа Incrementator
+// с конфигурацией c и возвращает указатель на него.
+// В случае недопустимой конфигурации возвращает ошибку типа *SettingsError
+// со списком всех недопустимых полей
+func CreateIncrementatorFromConfig(c Config) (*Incrementator, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c.create(), nil
+}
+
+// Validate метод проверяет конфигурацию целиком
+// При обнаружении ошибок возвращает *SettingsError со всеми недопустимыми полями
+// В режиме ModeStriped границы диапазона не применяются, поэтому и не проверяются
+func (c *Config) Validate() error {
+	e := new(SettingsError)
+	if !c.Mode.Valid() {
+		e.add("Mode", "%s: %s", ErrInvalidMode, c.Mode)
+	}
+	if c.Step < 0 {
+		e.add("Step", "недопустимое значение шага счетчика %d", c.Step)
+	}
+	if c.Mode != ModeStriped {
+		if !c.Overflow.Valid() {
+			e.add("Overflow", "%s: %s", ErrInvalidOverflowPolicy, c.Overflow)
+		}
+		if c.MinValue > c.MaxValue {
+			e.add("MaxValue", "максимальное значение %d меньше минимального значения %d", c.MaxValue, c.MinValue)
+		} else {
+			if c.Value < c.MinValue || c.Value > c.MaxValue {
+				e.add("Value", "исходное значение %d выходит за границы диапазона [%d, %d]", c.Value, c.MinValue, c.MaxValue)
+			}
+			if c.ResetValue < c.MinValue || c.ResetValue > c.MaxValue {
+				e.add("ResetValue", "значение сброса %d выходит за границы диапазона [%d, %d]", c.ResetValue, c.MinValue, c.MaxValue)
+			}
+			// разность границ может не поместиться в int64
+			if c.Step > 0 && uint64(c.Step) > uint64(c.MaxValue-c.MinValue) {
+				e.add("Step", "шаг счетчика %d превышает размер диапазона [%d, %d]", c.Step, c.MinValue, c.MaxValue)
+			}
+		}
+	}
+	if len(e.Fields) != 0 {
+		return e
+	}
+	return nil
+}
+
+// create создание счетчика с конфигурацией c без ее проверки
+func (c *Config) create() *Incrementator {
+	i := new(Incrementator)
+	i.counter = c.Value
+	i.step = c.Step
+	i.limits = limits{
+		minValue:   c.MinValue,
+		maxValue:   c.MaxValue,
+		resetValue: c.ResetValue,
+		overflow:   c.Overflow,
+	}
+	i.persist = c.Persist
+	i.setMode(c.Mode)
+	return i
+}
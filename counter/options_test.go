@@ -0,0 +1,146 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Тестирование создания счетчика с параметрами
+func TestCreateIncrementatorWithOptions(t *testing.T) {
+	incObj, err := CreateIncrementatorWithOptions(WithValue(5), WithStep(2), WithRange(-10, 10),
+		WithResetValue(-10), WithOverflowPolicy(OverflowWrap), WithMode(ModeAtomic))
+	if err != nil {
+		t.Fatalf("функция CreateIncrementatorWithOptions вернула ошибку: %q", err.Error())
+	}
+	expected := State{Value: 5, Step: 2, MinValue: -10, MaxValue: 10, ResetValue: -10, Overflow: OverflowWrap, Mode: ModeAtomic}
+	if st := incObj.GetState(); st != expected {
+		t.Fatalf("Неверное состояние созданного счетчика.\nОжидалось: %+v, получено: %+v", expected, st)
+	}
+	r, _ := incObj.IncrementBy(3)
+	if r.Value != -10 || r.Wraps != 1 {
+		t.Fatalf("функция IncrementBy отработала некорректно с параметрами счетчика: %+v", r)
+	}
+	// параметры одного счетчика не влияют на счетчики, создаваемые другими частями программы
+	other, _ := CreateIncrementatorWithOptions(WithMaxValue(7))
+	if st := other.GetState(); st.Value != DefaultValue || st.Step != DefaultStep || st.MaxValue != 7 || st.Mode != ModeMutex {
+		t.Fatalf("Неверное состояние счетчика с конфигурацией по умолчанию: %+v", st)
+	}
+}
+
+// Тестирование проверки конфигурации счетчика
+func TestConfigValidate(t *testing.T) {
+	_, err := CreateIncrementatorWithOptions(WithValue(2000), WithStep(-1), WithResetValue(1001), WithMode(Mode(10)))
+	expected := []string{"Mode", "Step", "Value", "ResetValue"}
+	if fields := settingsFields(t, err); !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("функция CreateIncrementatorWithOptions вернула неверный список недопустимых полей.\nОжидалось: %v, получено: %v", expected, fields)
+	}
+	c := DefaultConfig()
+	c.MinValue, c.MaxValue = 10, 0
+	if fields := settingsFields(t, c.Validate()); !reflect.DeepEqual(fields, []string{"MaxValue"}) {
+		t.Fatalf("функция Validate не отклонила недопустимый диапазон: %v", fields)
+	}
+	// границы диапазона распределенного счетчика не применяются
+	c.Mode, c.Value = ModeStriped, 100
+	if err = c.Validate(); err != nil {
+		t.Fatalf("функция Validate вернула ошибку для распределенного счетчика: %q", err.Error())
+	}
+}
+
+// Тестирование функции сохранения состояния, заданной параметром счетчика
+func TestWithPersist(t *testing.T) {
+	persistErr := errors.New("ошибка сохранения")
+	for _, mode := range []Mode{ModeMutex, ModeAtomic} {
+		var saved []State
+		var fail bool
+		incObj, _ := CreateIncrementatorWithOptions(WithMode(mode), WithPersist(func(s State) error {
+			if fail {
+				return persistErr
+			}
+			saved = append(saved, s)
+			return nil
+		}))
+		incObj.Increment()
+		incObj.SetStep(5)
+		if len(saved) != 2 || saved[0].Value != 1 || saved[0].Version != 1 || saved[1].Step != 5 || saved[1].Version != 2 {
+			t.Fatalf("режим %s: сохранены неверные состояния счетчика: %+v", mode, saved)
+		}
+		fail = true
+		_, err := incObj.Increment()
+		st := incObj.GetState()
+		if mode == ModeMutex {
+			// ошибка сохранения отменяет изменение
+			if err != persistErr || st.Value != 1 || st.Version != 2 {
+				t.Fatalf("режим %s: изменение применено несмотря на ошибку сохранения: %+v, ошибка: %v", mode, st, err)
+			}
+			continue
+		}
+		// в режиме ModeAtomic состояние сохраняется после фиксации, и изменение не отменяется
+		var e *PersistError
+		if !errors.As(err, &e) || !errors.Is(err, persistErr) || st.Value != 6 || st.Version != 3 {
+			t.Fatalf("режим %s: ошибка сохранения зафиксированного изменения не возвращена: %+v, ошибка: %v", mode, st, err)
+		}
+	}
+	// в режиме ModeStriped состояние сохраняется после применения изменения
+	var saved State
+	var fail bool
+	incObj, _ := CreateIncrementatorWithOptions(WithMode(ModeStriped), WithPersist(func(s State) error {
+		if fail {
+			return persistErr
+		}
+		saved = s
+		return nil
+	}))
+	incObj.IncrementNumber()
+	if saved.Value != 1 || saved.Version != 1 {
+		t.Fatalf("режим %s: сохранено неверное состояние счетчика: %+v", ModeStriped, saved)
+	}
+	// изменение полосы не откатывается, поэтому ошибка сохранения сообщает о примененном изменении
+	fail = true
+	var e *PersistError
+	if r, err := incObj.Increment(); !errors.As(err, &e) || r.Value != 2 || incObj.GetNumber() != 2 {
+		t.Fatalf("режим %s: ошибка сохранения примененного изменения не возвращена: %+v, ошибка: %v", ModeStriped, r, err)
+	}
+}
+
+// Тестирование сохранения только зафиксированных состояний при конкурентном изменении в режиме ModeAtomic
+func TestWithPersistAtomicConcurrent(t *testing.T) {
+	const goroutines, increments = 8, 500
+	var mtx sync.Mutex
+	saved := make(map[uint64]int64)
+	incObj, _ := CreateIncrementatorWithOptions(WithMode(ModeAtomic), WithMaxValue(math.MaxInt64), WithPersist(func(s State) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if _, ok := saved[s.Version]; ok {
+			t.Errorf("Состояние версии %d сохранено повторно", s.Version)
+		}
+		saved[s.Version] = s.Value
+		return nil
+	}))
+	var w sync.WaitGroup
+	w.Add(goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func() {
+			defer w.Done()
+			for k := 0; k < increments; k++ {
+				incObj.Increment()
+			}
+		}()
+	}
+	w.Wait()
+	if len(saved) != goroutines*increments {
+		t.Fatalf("Сохранено %d состояний, ожидалось %d", len(saved), goroutines*increments)
+	}
+	// каждая версия соответствует ровно одному зафиксированному увеличению
+	for version, value := range saved {
+		if value != int64(version) {
+			t.Fatalf("Сохранено незафиксированное состояние версии %d со значением %d", version, value)
+		}
+	}
+}
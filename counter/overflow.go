@@ -0,0 +1,214 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// OverflowPolicy политика поведения счетчика при выходе его значения за границы диапазона
+type OverflowPolicy int
+
+const (
+	// OverflowWrap при превышении максимального значения счетчику присваивается значение сброса,
+	// при выходе за минимальное значение - максимальное значение
+	OverflowWrap OverflowPolicy = iota
+	// OverflowSaturate значение счетчика останавливается на границе диапазона
+	OverflowSaturate
+	// OverflowReject изменение, приводящее к выходу за границы диапазона, отклоняется с ошибкой типа *OverflowError
+	OverflowReject
+	// OverflowCarry вышедший за границу диапазона остаток переносится от противоположной границы,
+	// то есть счетчик ведет отсчет по модулю размера диапазона
+	OverflowCarry
+)
+
+// ErrInvalidOverflowPolicy ошибка использования неизвестной политики переполнения
+var ErrInvalidOverflowPolicy = errors.New("недопустимая политика переполнения счетчика")
+
+// ErrIntegerOverflow ошибка изменения счетчика, величина которого не помещается в int64
+var ErrIntegerOverflow = errors.New("величина изменения счетчика не помещается в 64-битное целое")
+
+// String метод возвращает имя политики переполнения
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowWrap:
+		return "wrap"
+	case OverflowSaturate:
+		return "saturate"
+	case OverflowReject:
+		return "reject"
+	case OverflowCarry:
+		return "carry"
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+// Valid метод проверяет, является ли политика переполнения известной
+func (p OverflowPolicy) Valid() bool {
+	return p >= OverflowWrap && p <= OverflowCarry
+}
+
+// OverflowError ошибка выхода значения счетчика за границы диапазона при политике OverflowReject
+type OverflowError struct {
+	Value int64 // значение счетчика до изменения
+	Delta int64 // величина отклоненного изменения за один шаг
+	Steps int64 // количество шагов отклоненного изменения
+	Min   int64 // минимальное значение счетчика
+	Max   int64 // максимальное значение счетчика
+}
+
+// Error метод возвращает текстовое описание ошибки
+func (e *OverflowError) Error() string {
+	if e.Steps > 1 {
+		return fmt.Sprintf("изменение счетчика %d на %d (шагов: %d) выходит за границы диапазона [%d, %d]", e.Value, e.Delta, e.Steps, e.Min, e.Max)
+	}
+	return fmt.Sprintf("изменение счетчика %d на %d выходит за границы диапазона [%d, %d]", e.Value, e.Delta, e.Min, e.Max)
+}
+
+// limits граничные значения счетчика и политика обработки выхода за них
+type limits struct {
+	minValue   int64          // минимальное значение счетчика
+	maxValue   int64          // максимальное значение счетчика
+	resetValue int64          // значение, в которое устанавливается счетчик при превышении максимального значения по политике OverflowWrap
+	overflow   OverflowPolicy // политика поведения счетчика при выходе за границы диапазона
+}
+
+// apply метод вычисляет новое значение счетчика после его изменения на величину delta
+// с учетом границ диапазона и политики переполнения
+// Возвращает также признак перехода счетчика через границу диапазона
+func (l limits) apply(counter, delta int64) (int64, bool, error) {
+	value, ok := addInt64(counter, delta)
+	if ok && value >= l.minValue && value <= l.maxValue {
+		return value, false, nil
+	}
+	// сумма, не поместившаяся в int64, выходит за границу диапазона в направлении изменения
+	above := value > l.maxValue
+	if !ok {
+		above = delta > 0
+	}
+	switch l.overflow {
+	case OverflowSaturate:
+		if above {
+			return l.maxValue, false, nil
+		}
+		return l.minValue, false, nil
+	case OverflowReject:
+		return counter, false, &OverflowError{Value: counter, Delta: delta, Steps: 1, Min: l.minValue, Max: l.maxValue}
+	case OverflowCarry:
+		value, _ = l.carry(counter, delta, 1)
+		return value, true, nil
+	}
+	if above {
+		return l.resetTarget(), true, nil
+	}
+	return l.maxValue, true, nil
+}
+
+// applySteps метод вычисляет новое значение счетчика после n последовательных изменений
+// на величину step с учетом границ диапазона и политики переполнения
+// Результат совпадает с n-кратным вызовом apply, но вычисляется без перебора шагов
+// Возвращает также количество переходов счетчика через границу диапазона
+// Расстояния между значениями вычисляются в uint64, так как разность двух значений int64
+// может не поместиться в int64, а результат всегда лежит в границах диапазона
+func (l limits) applySteps(counter, step, n int64) (int64, int64, error) {
+	if n <= 0 || step == 0 {
+		return counter, 0, nil
+	}
+	// величина шага; для math.MinInt64 преобразование в uint64 также дает верный результат
+	abs := uint64(step)
+	if step < 0 {
+		abs = uint64(-step)
+	}
+	// количество шагов, которые счетчик может сделать, не выходя за границу диапазона
+	var room uint64
+	if step > 0 && counter <= l.maxValue {
+		room = uint64(l.maxValue-counter) / abs
+	} else if step < 0 && counter >= l.minValue {
+		room = uint64(counter-l.minValue) / abs
+	}
+	if uint64(n) <= room {
+		// произведение n*step может не поместиться в int64, но сумма лежит в границах диапазона
+		// и верно вычисляется в арифметике по модулю 2^64
+		return counter + n*step, 0, nil
+	}
+	switch l.overflow {
+	case OverflowSaturate:
+		if step > 0 {
+			return l.maxValue, 0, nil
+		}
+		return l.minValue, 0, nil
+	case OverflowReject:
+		return counter, 0, &OverflowError{Value: counter, Delta: step, Steps: n, Min: l.minValue, Max: l.maxValue}
+	case OverflowCarry:
+		value, cycles := l.carry(counter, step, n)
+		// шаг, не меньший размера диапазона, переходит через границу на каждом изменении,
+		// иначе каждый переход приходится на отдельный шаг
+		wraps := n
+		if cycles.Abs(cycles).IsInt64() && cycles.Int64() < n {
+			wraps = cycles.Int64()
+		}
+		return value, wraps, nil
+	}
+	// после первого перехода через границу счетчик начинает цикл
+	// от значения сброса (или от максимального значения при уменьшении),
+	// длина цикла - количество шагов до следующего перехода
+	remaining := uint64(n) - room - 1
+	start := l.resetTarget()
+	span := uint64(l.maxValue - start)
+	if step < 0 {
+		start = l.maxValue
+		span = uint64(l.maxValue - l.minValue)
+	}
+	// количество шагов цикла без перехода; при полном диапазоне int64 и единичном шаге
+	// длина цикла 2^64 не помещается в uint64, поэтому сравнивается без прибавления единицы
+	inCycle := span / abs
+	if remaining <= inCycle {
+		return int64(uint64(start) + remaining*uint64(step)), 1, nil
+	}
+	cycle := inCycle + 1
+	return int64(uint64(start) + (remaining%cycle)*uint64(step)), 1 + int64(remaining/cycle), nil
+}
+
+// carry метод вычисляет значение счетчика по политике OverflowCarry после n изменений на величину step
+// Произведение n*step и размер диапазона могут не поместиться в int64, поэтому используется длинная арифметика
+// Возвращает также количество полных циклов диапазона, отрицательное при уменьшении счетчика
+func (l limits) carry(counter, step, n int64) (int64, *big.Int) {
+	total := new(big.Int).Mul(big.NewInt(n), big.NewInt(step))
+	total.Add(total, new(big.Int).Sub(big.NewInt(counter), big.NewInt(l.minValue)))
+	size := new(big.Int).Sub(big.NewInt(l.maxValue), big.NewInt(l.minValue))
+	size.Add(size, big.NewInt(1))
+	cycles, offset := new(big.Int).DivMod(total, size, new(big.Int))
+	// смещение не превышает разности границ, которая помещается в uint64
+	return int64(uint64(l.minValue) + offset.Uint64()), cycles
+}
+
+// addInt64 функция возвращает сумму a и b и признак того, что сумма поместилась в int64
+func addInt64(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+// mulInt64 функция возвращает произведение a и b и признак того, что произведение поместилось в int64
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if (c < 0) != ((a < 0) != (b < 0)) || c/b != a {
+		return c, false
+	}
+	return c, true
+}
+
+// resetTarget метод возвращает значение сброса счетчика
+// Если значение сброса оказалось вне диапазона после изменения границ, используется минимальное значение
+func (l limits) resetTarget() int64 {
+	if l.resetValue < l.minValue || l.resetValue > l.maxValue {
+		return l.minValue
+	}
+	return l.resetValue
+}
@@ -0,0 +1,103 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrCounterExists ошибка создания счетчика с уже занятым именем
+	ErrCounterExists = errors.New("счетчик с таким именем уже существует")
+	// ErrCounterNotFound ошибка обращения к несуществующему счетчику
+	ErrCounterNotFound = errors.New("счетчик с таким именем не найден")
+	// ErrInvalidCounterName ошибка использования недопустимого имени счетчика
+	ErrInvalidCounterName = errors.New("недопустимое имя счетчика")
+)
+
+// Registry реестр независимо настраиваемых счетчиков типа T,
+// доступ к которым осуществляется по имени
+// Вызов методов потокобезопасен
+type Registry[T any] struct {
+	counters map[string]T // счетчики, проиндексированные по имени
+	create   func() T     // функция создания счетчика с настройками по умолчанию
+	mtx      sync.RWMutex // мьютекс чтения/записи для блокировки одновременного доступа к списку счетчиков
+}
+
+// CreateRegistry функция создает новый пустой реестр счетчиков и возвращает указатель на него.
+func CreateRegistry() *Registry[*Incrementator] {
+	return &Registry[*Incrementator]{counters: make(map[string]*Incrementator), create: CreateIncrementator}
+}
+
+// CreateBigRegistry функция создает новый пустой реестр счетчиков произвольной точности
+// и возвращает указатель на него.
+func CreateBigRegistry() *Registry[*BigIncrementator] {
+	return &Registry[*BigIncrementator]{counters: make(map[string]*BigIncrementator), create: CreateBigIncrementator}
+}
+
+// Create метод создает новый счетчик с настройками по умолчанию и регистрирует его под именем name
+// В случае, если имя пустое или уже занято, - возвращает ошибку
+func (r *Registry[T]) Create(name string) (T, error) {
+	i := r.create()
+	if err := r.Add(name, i); err != nil {
+		var none T
+		return none, err
+	}
+	return i, nil
+}
+
+// Add метод регистрирует уже созданный счетчик под именем name
+// Используется, в том числе, при загрузке счетчиков из хранилища
+// В случае, если имя пустое или уже занято, - возвращает ошибку
+func (r *Registry[T]) Add(name string, i T) error {
+	if name == "" {
+		return ErrInvalidCounterName
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.counters[name]; ok {
+		return ErrCounterExists
+	}
+	r.counters[name] = i
+	return nil
+}
+
+// Get метод возвращает счетчик, зарегистрированный под именем name
+// В случае, если счетчик не найден, - возвращает ошибку
+func (r *Registry[T]) Get(name string) (T, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	i, ok := r.counters[name]
+	if !ok {
+		return i, ErrCounterNotFound
+	}
+	return i, nil
+}
+
+// Delete метод удаляет счетчик, зарегистрированный под именем name
+// В случае, если счетчик не найден, - возвращает ошибку
+func (r *Registry[T]) Delete(name string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.counters[name]; !ok {
+		return ErrCounterNotFound
+	}
+	delete(r.counters, name)
+	return nil
+}
+
+// List метод возвращает отсортированный список имен зарегистрированных счетчиков
+func (r *Registry[T]) List() []string {
+	r.mtx.RLock()
+	names := make([]string, 0, len(r.counters))
+	for name := range r.counters {
+		names = append(names, name)
+	}
+	r.mtx.RUnlock()
+	sort.Strings(names)
+	return names
+}
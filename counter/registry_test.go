@@ -0,0 +1,80 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Тестирование создания, получения и удаления счетчиков реестра
+func TestRegistry(t *testing.T) {
+	r := CreateRegistry()
+	if _, err := r.Create(""); err != ErrInvalidCounterName {
+		t.Fatalf("метод Create не вернул ошибку при создании счетчика с пустым именем, получено: %v", err)
+	}
+	created, err := r.Create("requests")
+	if err != nil {
+		t.Fatalf("метод Create вернул ошибку: %q", err.Error())
+	}
+	if _, err = r.Create("requests"); err != ErrCounterExists {
+		t.Fatalf("метод Create не вернул ошибку при создании счетчика с занятым именем, получено: %v", err)
+	}
+	got, err := r.Get("requests")
+	if err != nil {
+		t.Fatalf("метод Get вернул ошибку: %q", err.Error())
+	}
+	if got != created {
+		t.Fatal("метод Get вернул счетчик, отличный от созданного")
+	}
+	if _, err = r.Get("unknown"); err != ErrCounterNotFound {
+		t.Fatalf("метод Get не вернул ошибку при обращении к несуществующему счетчику, получено: %v", err)
+	}
+	r.Create("errors")
+	expectedNames := []string{"errors", "requests"}
+	if names := r.List(); !reflect.DeepEqual(names, expectedNames) {
+		t.Fatalf("метод List отработал некорректно.\nОжидалось: %v, получено: %v", expectedNames, names)
+	}
+	if err = r.Delete("requests"); err != nil {
+		t.Fatalf("метод Delete вернул ошибку: %q", err.Error())
+	}
+	if err = r.Delete("requests"); err != ErrCounterNotFound {
+		t.Fatalf("метод Delete не вернул ошибку при удалении несуществующего счетчика, получено: %v", err)
+	}
+	if _, err = r.Get("requests"); err != ErrCounterNotFound {
+		t.Fatal("метод Get вернул удаленный счетчик")
+	}
+}
+
+// Тестирование независимости счетчиков реестра при конкурентном доступе
+func TestRegistryInParalell(t *testing.T) {
+	r := CreateRegistry()
+	names := []string{"a", "b", "c"}
+	goroutineAmount := 10
+	var w sync.WaitGroup
+	w.Add(goroutineAmount * len(names))
+	for _, name := range names {
+		r.Create(name)
+		for i := 0; i < goroutineAmount; i++ {
+			go func(name string) {
+				defer w.Done()
+				IObj, err := r.Get(name)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				IObj.IncrementNumber()
+			}(name)
+		}
+	}
+	w.Wait()
+	for _, name := range names {
+		IObj, _ := r.Get(name)
+		if counter := IObj.GetNumber(); counter != int64(goroutineAmount) {
+			t.Fatalf("счетчик %q отработал некорректно в конкурентом режиме.\nОжидалось значения счетчика: %d, получено: %d", name, goroutineAmount, counter)
+		}
+	}
+}
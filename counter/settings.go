@@ -0,0 +1,132 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Settings желаемые настройки счетчика, передаваемые клиентами по RPC протоколу
+type Settings struct {
+	Step     *int64 // шаг инкрементации
+	MaxValue *int64 // максимальное значение счетчика
+	MinValue *int64 // минимальное значение счетчика
+	// Overflow политика поведения счетчика при выходе за границы диапазона
+	Overflow *OverflowPolicy
+	// ResetValue значение, в которое устанавливается счетчик при превышении максимального значения по политике OverflowWrap
+	ResetValue *int64
+}
+
+// FieldError ошибка значения одного поля настроек счетчика
+type FieldError struct {
+	Field   string // имя поля настроек
+	Message string // описание ошибки
+}
+
+// SettingsError ошибка проверки настроек счетчика, перечисляющая все недопустимые поля
+// При передаче по RPC протоколу клиент получает текст ошибки, в котором
+// каждое поле указано в виде "<имя поля>: <описание ошибки>"
+type SettingsError struct {
+	Fields []FieldError // недопустимые поля в порядке их проверки
+}
+
+// Error метод возвращает текстовое описание ошибки
+func (e *SettingsError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for k, f := range e.Fields {
+		fields[k] = f.Field + ": " + f.Message
+	}
+	return "недопустимые настройки счетчика: " + strings.Join(fields, "; ")
+}
+
+// add метод добавляет в ошибку недопустимое поле настроек
+func (e *SettingsError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// apply метод проверяет настройки целиком и применяет их к копии состояния счетчика st
+// Каждое поле проверяется с учетом остальных переданных полей и уже установленных
+// значений, в том числе соотношение шага и размера диапазона
+// Если текущее значение счетчика выходит за новые границы, оно приводится к диапазону
+// согласно новой политике переполнения, а при политике OverflowReject настройки отклоняются
+// При обнаружении ошибок возвращает *SettingsError со всеми недопустимыми полями,
+// состояние st в этом случае не должно фиксироваться
+func (s *Settings) apply(st *state, mode Mode) error {
+	e := new(SettingsError)
+	next, step := st.limits, st.step
+	if mode == ModeStriped {
+		// в режиме ModeStriped изменяется только шаг счетчика
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"Overflow", s.Overflow != nil},
+			{"MinValue", s.MinValue != nil},
+			{"MaxValue", s.MaxValue != nil},
+			{"ResetValue", s.ResetValue != nil},
+		} {
+			if f.set {
+				e.add(f.name, "%s: %s", ErrUnsupportedByMode, mode)
+			}
+		}
+	}
+	if s.Overflow != nil {
+		if !s.Overflow.Valid() {
+			e.add("Overflow", "%s: %s", ErrInvalidOverflowPolicy, *s.Overflow)
+		}
+		next.overflow = *s.Overflow
+	}
+	if s.MinValue != nil {
+		next.minValue = *s.MinValue
+	}
+	if s.MaxValue != nil {
+		next.maxValue = *s.MaxValue
+	}
+	validRange := next.minValue <= next.maxValue
+	if !validRange {
+		if s.MinValue != nil {
+			e.add("MinValue", "минимальное значение %d превышает максимальное значение %d", next.minValue, next.maxValue)
+		}
+		if s.MaxValue != nil {
+			e.add("MaxValue", "максимальное значение %d меньше минимального значения %d", next.maxValue, next.minValue)
+		}
+	}
+	if s.ResetValue != nil {
+		next.resetValue = *s.ResetValue
+		if validRange && (next.resetValue < next.minValue || next.resetValue > next.maxValue) {
+			e.add("ResetValue", "значение сброса %d выходит за границы диапазона [%d, %d]", next.resetValue, next.minValue, next.maxValue)
+		}
+	}
+	if s.Step != nil {
+		step = *s.Step
+		if step < 0 {
+			e.add("Step", "недопустимое значение шага счетчика %d", step)
+		}
+	}
+	// шаг, превышающий размер диапазона, переводит счетчик через границу при каждом изменении,
+	// поэтому проверяется при изменении шага или границ; разность границ может не поместиться в int64
+	changed := s.Step != nil || s.MinValue != nil || s.MaxValue != nil
+	if changed && mode != ModeStriped && validRange && step > 0 && uint64(step) > uint64(next.maxValue-next.minValue) {
+		e.add("Step", "шаг счетчика %d превышает размер диапазона [%d, %d]", step, next.minValue, next.maxValue)
+	}
+	counter := st.counter
+	if len(e.Fields) == 0 && mode != ModeStriped {
+		var err error
+		counter, _, err = next.apply(st.counter, 0)
+		if err != nil {
+			field := "MaxValue"
+			if st.counter < next.minValue {
+				field = "MinValue"
+			}
+			e.add(field, "%s", err)
+		}
+	}
+	if len(e.Fields) != 0 {
+		return e
+	}
+	st.limits, st.step, st.counter = next, step, counter
+	return nil
+}
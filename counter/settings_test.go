@@ -0,0 +1,115 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// settingsFields имена недопустимых полей из ошибки проверки настроек
+func settingsFields(t *testing.T, err error) []string {
+	var e *SettingsError
+	if !errors.As(err, &e) {
+		t.Fatalf("ожидалась ошибка типа *SettingsError, получено: %v", err)
+	}
+	fields := make([]string, len(e.Fields))
+	for k, f := range e.Fields {
+		fields[k] = f.Field
+	}
+	return fields
+}
+
+// Тестирование атомарного применения настроек счетчика
+func TestConfigure(t *testing.T) {
+	step, minValue, maxValue, resetValue := int64(2), int64(10), int64(20), int64(12)
+	overflow := OverflowSaturate
+	incObj := CreateIncrementator()
+	err := incObj.Configure(&Settings{Step: &step, MinValue: &minValue, MaxValue: &maxValue, ResetValue: &resetValue, Overflow: &overflow})
+	if err != nil {
+		t.Fatalf("функция Configure вернула ошибку: %q", err.Error())
+	}
+	st := incObj.GetState()
+	// значение счетчика приводится к новому диапазону по новой политике переполнения
+	if st.Value != minValue || st.Step != step || st.MinValue != minValue || st.MaxValue != maxValue ||
+		st.ResetValue != resetValue || st.Overflow != overflow || st.Version != 1 {
+		t.Fatalf("функция Configure отработала некорректно: %+v", st)
+	}
+	// все недопустимые поля перечисляются, а счетчик не изменяется
+	badStep, badMin, badMax, badPolicy := int64(-1), int64(30), int64(25), OverflowPolicy(10)
+	err = incObj.Configure(&Settings{Step: &badStep, MinValue: &badMin, MaxValue: &badMax, Overflow: &badPolicy})
+	expected := []string{"Overflow", "MinValue", "MaxValue", "Step"}
+	if fields := settingsFields(t, err); !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("функция Configure вернула неверный список недопустимых полей.\nОжидалось: %v, получено: %v", expected, fields)
+	}
+	if after := incObj.GetState(); after != st {
+		t.Fatalf("функция Configure частично применила недопустимые настройки: %+v", after)
+	}
+	// шаг проверяется вместе с новыми границами
+	bigStep := int64(11)
+	if fields := settingsFields(t, incObj.Configure(&Settings{Step: &bigStep})); !reflect.DeepEqual(fields, []string{"Step"}) {
+		t.Fatalf("функция Configure не отклонила шаг, превышающий размер диапазона: %v", fields)
+	}
+	if err = incObj.Configure(&Settings{Step: &bigStep, MaxValue: &badMin}); err != nil {
+		t.Fatalf("функция Configure не применила шаг вместе с расширением диапазона: %q", err.Error())
+	}
+	// по политике OverflowReject настройки, выводящие значение счетчика за границы, отклоняются
+	incObj.SetValue(30)
+	reject, narrowMax := OverflowReject, int64(25)
+	if fields := settingsFields(t, incObj.Configure(&Settings{Overflow: &reject, MaxValue: &narrowMax})); !reflect.DeepEqual(fields, []string{"MaxValue"}) {
+		t.Fatalf("функция Configure не отклонила выход значения счетчика за границы диапазона: %v", fields)
+	}
+	if st = incObj.GetState(); st.Value != 30 || st.Overflow != OverflowSaturate {
+		t.Fatalf("функция Configure частично применила отклоненные настройки: %+v", st)
+	}
+}
+
+// Тестирование отмены изменения настроек при ошибке сохранения
+func TestConfigurePersist(t *testing.T) {
+	maxValue := int64(5)
+	persistErr := errors.New("ошибка сохранения")
+	for _, mode := range []Mode{ModeMutex, ModeAtomic} {
+		incObj := CreateIncrementator()
+		incObj.setMode(mode)
+		err := incObj.ConfigureWith(&Settings{MaxValue: &maxValue}, func(s State) error {
+			if s.MaxValue != maxValue || s.Version != 1 {
+				t.Errorf("режим %s: сохраняется неверное состояние счетчика: %+v", mode, s)
+			}
+			return persistErr
+		})
+		st := incObj.GetState()
+		if mode == ModeAtomic {
+			// в режиме ModeAtomic функция сохранения вызывается после фиксации изменения
+			var e *PersistError
+			if !errors.As(err, &e) || st.MaxValue != maxValue || st.Version != 1 {
+				t.Fatalf("режим %s: неверный результат ошибки сохранения зафиксированных настроек: %+v, ошибка: %v", mode, st, err)
+			}
+			continue
+		}
+		if err != persistErr {
+			t.Fatalf("режим %s: функция configure не вернула ошибку сохранения, получено: %v", mode, err)
+		}
+		if st.MaxValue != InitMaxValue || st.Version != 0 {
+			t.Fatalf("режим %s: настройки применены несмотря на ошибку сохранения: %+v", mode, st)
+		}
+	}
+}
+
+// Тестирование изменения настроек распределенного счетчика
+func TestConfigureStriped(t *testing.T) {
+	step, maxValue := int64(3), int64(5)
+	incObj := CreateStripedIncrementator()
+	if fields := settingsFields(t, incObj.Configure(&Settings{Step: &step, MaxValue: &maxValue})); !reflect.DeepEqual(fields, []string{"MaxValue"}) {
+		t.Fatalf("функция Configure не отклонила границы диапазона распределенного счетчика: %v", fields)
+	}
+	if err := incObj.Configure(&Settings{Step: &step}); err != nil {
+		t.Fatalf("функция Configure вернула ошибку: %q", err.Error())
+	}
+	incObj.IncrementNumber()
+	if counter := incObj.GetNumber(); counter != step {
+		t.Fatalf("Неверное значение распределенного счетчика после изменения шага, ожидалось: %d, получено: %d", step, counter)
+	}
+}
@@ -0,0 +1,98 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync/atomic"
+)
+
+// stripe полоса распределенного счетчика
+type stripe struct {
+	value    atomic.Int64  // сумма изменений, примененных к полосе
+	ops      atomic.Uint64 // количество изменений, примененных к полосе
+	modified atomic.Int64  // время последнего изменения полосы в наносекундах от начала эпохи Unix
+	_        [40]byte      // дополнение до размера строки кэша, чтобы соседние полосы не разделяли одну строку
+}
+
+// StripedCounter распределенный счетчик для подсчета при очень высокой конкуренции записи
+// Изменения распределяются между полосами, количество которых соответствует количеству
+// процессоров, доступных планировщику, а значение счетчика вычисляется суммированием полос
+//
+// Гарантии согласованности:
+//   - каждое изменение применяется атомарно к одной из полос и никогда не теряется;
+//   - если изменения не выполняются одновременно с чтением, GetNumber возвращает точную сумму;
+//   - при одновременных изменениях GetNumber учитывает все изменения, завершившиеся до начала
+//     чтения, и произвольную часть выполняющихся одновременно с ним, то есть значение
+//     не линеаризуемо и может не совпадать ни с одним промежуточным состоянием счетчика;
+//   - границы диапазона и политика переполнения не применяются, а выход суммы полос
+//     за границы int64 не обнаруживается.
+//
+// Вызов методов потокобезопасен
+type StripedCounter struct {
+	stripes []stripe // полосы счетчика
+}
+
+// CreateStripedCounter функция создает новый распределенный счетчик с нулевым значением
+// и возвращает указатель на него.
+func CreateStripedCounter() *StripedCounter {
+	return &StripedCounter{stripes: make([]stripe, runtime.GOMAXPROCS(0))}
+}
+
+// Add метод изменяет значение счетчика на величину delta
+// Полоса выбирается псевдослучайно, что распределяет конкурентные изменения
+// между полосами без общего для всех горутин участка памяти
+// Время изменения полосы берется из грубых часов, чтение которых не обращается к системным часам
+func (c *StripedCounter) Add(delta int64) {
+	c.add(delta, coarseNow())
+}
+
+// add изменение значения счетчика на величину delta со временем изменения now
+func (c *StripedCounter) add(delta, now int64) {
+	s := &c.stripes[rand.IntN(len(c.stripes))]
+	s.value.Add(delta)
+	s.ops.Add(1)
+	s.modified.Store(now)
+}
+
+// reset установка значения счетчика value без учета в количестве изменений
+// Вызывается до начала конкурентного использования счетчика
+func (c *StripedCounter) reset(value int64) {
+	for k := range c.stripes {
+		c.stripes[k].value.Store(0)
+	}
+	c.stripes[0].value.Store(value)
+}
+
+// GetNumber метод возвращает сумму полос счетчика
+func (c *StripedCounter) GetNumber() int64 {
+	var sum int64
+	for k := range c.stripes {
+		sum += c.stripes[k].value.Load()
+	}
+	return sum
+}
+
+// Ops метод возвращает количество изменений, примененных к счетчику
+func (c *StripedCounter) Ops() uint64 {
+	var ops uint64
+	for k := range c.stripes {
+		ops += c.stripes[k].ops.Load()
+	}
+	return ops
+}
+
+// Modified метод возвращает время последнего изменения счетчика в наносекундах от начала эпохи Unix
+// или нуль, если счетчик не изменялся
+func (c *StripedCounter) Modified() int64 {
+	var modified int64
+	for k := range c.stripes {
+		if m := c.stripes[k].modified.Load(); m > modified {
+			modified = m
+		}
+	}
+	return modified
+}
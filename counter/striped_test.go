@@ -0,0 +1,74 @@
+package counter
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"sync"
+	"testing"
+)
+
+// Тестирование распределенного счетчика в многопоточном режиме
+func TestStripedCounter(t *testing.T) {
+	c := CreateStripedCounter()
+	goroutineAmount := 20
+	var w sync.WaitGroup
+	w.Add(goroutineAmount)
+	for i := 0; i < goroutineAmount; i++ {
+		go func() {
+			defer w.Done()
+			for k := 0; k < 100; k++ {
+				c.Add(3)
+			}
+			c.Add(-1)
+		}()
+	}
+	w.Wait()
+	expected := int64(goroutineAmount * (100*3 - 1))
+	if counter := c.GetNumber(); counter != expected {
+		t.Fatalf("функция GetNumber распределенного счетчика отработала некорректно.\nОжидалось значение счетчика: %d, получено: %d", expected, counter)
+	}
+	if ops := c.Ops(); ops != uint64(goroutineAmount*101) {
+		t.Fatalf("Неверное количество изменений распределенного счетчика: %d", ops)
+	}
+}
+
+// Тестирование счетчика в режиме ModeStriped
+func TestStripedIncrementator(t *testing.T) {
+	incObj := CreateStripedIncrementator()
+	if incObj.Mode() != ModeStriped {
+		t.Fatalf("функция CreateStripedIncrementator создала счетчик в режиме %s", incObj.Mode())
+	}
+	incObj.SetStep(2)
+	goroutineAmount := 10
+	var w sync.WaitGroup
+	w.Add(goroutineAmount)
+	for i := 0; i < goroutineAmount; i++ {
+		go func() {
+			defer w.Done()
+			// границы диапазона в режиме ModeStriped не применяются
+			for k := int64(0); k < InitMaxValue; k++ {
+				incObj.IncrementNumber()
+			}
+		}()
+	}
+	w.Wait()
+	expected := int64(goroutineAmount) * InitMaxValue * 2
+	if counter := incObj.GetNumber(); counter != expected {
+		t.Fatalf("функция IncrementNumber отработала некорректно в режиме ModeStriped.\nОжидалось значение счетчика: %d, получено: %d", expected, counter)
+	}
+	r, err := incObj.DecrementBy(3)
+	if err != nil || r.Value != expected-6 || r.Previous != expected {
+		t.Fatalf("функция DecrementBy отработала некорректно в режиме ModeStriped: %+v, ошибка: %v", r, err)
+	}
+	if s := incObj.snapshot(); s.counter != expected-6 || s.step != 2 {
+		t.Fatalf("Неверный снимок состояния в режиме ModeStriped: значение %d, шаг %d", s.counter, s.step)
+	}
+	if _, err = incObj.CompareAndSwap(0, 1); err != ErrUnsupportedByMode {
+		t.Fatalf("функция CompareAndSwap не вернула ошибку в режиме ModeStriped, получено: %v", err)
+	}
+	if err = incObj.SetMaximumValue(10); err != ErrUnsupportedByMode {
+		t.Fatalf("функция SetMaximumValue не вернула ошибку в режиме ModeStriped, получено: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+// ReloadResult результат повторного чтения настроек сервиса, передаваемый клиентам по RPC протоколу
+// Настройки указываются по именам в файле настроек
+type ReloadResult struct {
+	Applied         []string // измененные настройки, примененные без перезапуска сервиса
+	RestartRequired []string // измененные настройки, которые вступят в силу только после перезапуска сервиса
+}
+
+// Reloader функция повторного чтения настроек сервиса и применения их изменений
+type Reloader func() (ReloadResult, error)
+
+// Admin объект административных RPC методов сервиса
+// Регистрируется RPC сервером, если в ServerConfig задана функция Reload
+type Admin struct {
+	reload Reloader // функция повторного чтения настроек
+}
+
+// Reload метод повторно читает настройки сервиса и применяет те изменения,
+// которые не требуют перезапуска
+// В случае недопустимых настроек возвращает ошибку, а действующие настройки не изменяются
+// req - запрос от клиента, не используется
+// resp - ответ клиенту, перечень примененных и требующих перезапуска настроек
+func (a *Admin) Reload(req int, resp *ReloadResult) error {
+	result, err := a.reload()
+	if err != nil {
+		return err
+	}
+	*resp = result
+	return nil
+}
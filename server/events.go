@@ -0,0 +1,326 @@
+package server
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+)
+
+// DefaultSnapshotInterval количество событий журнала между снимками состояния счетчиков по умолчанию
+const DefaultSnapshotInterval = 1000
+
+// ErrEventLogNotEmpty ошибка восстановления счетчиков в журнал событий, уже содержащий события
+var ErrEventLogNotEmpty = errors.New("журнал событий не пуст")
+
+// CreateEventSourcedRPCIncrementator функция создает новый объет типа RPCIncrementator в режиме журнала событий
+// и возвращает указатель на него.
+// Состояние счетчиков Incrementator восстанавливается из последнего снимка events и применением событий,
+// добавленных в журнал после снимка, а каждое изменение счетчиков записывается в журнал до его применения
+// Снимок состояния счетчиков сохраняется после каждых snapshotInterval событий и при вызове Flush
+// Если журнал пуст, в него переносятся счетчики из хранилища st, сохраненные в режиме сохранения состояния,
+// а отсутствующий в хранилище счетчик по умолчанию создается с конфигурацией c
+// Счетчики произвольной точности и журнал изменений History ведутся в хранилище st так же,
+// как в функции CreatePersistentRPCIncrementatorFromConfig
+// В случае недопустимой конфигурации возвращает ошибку *counter.SettingsError
+func CreateEventSourcedRPCIncrementator(st storage.Store, events storage.EventLog, c counter.Config, snapshotInterval int) (i *RPCIncrementator, err error) {
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if snapshotInterval <= 0 {
+		return nil, fmt.Errorf("недопустимый интервал снимков состояния счетчиков %d", snapshotInterval)
+	}
+	ctx := context.Background()
+	i = CreateRPCIncrementator()
+	i.Defaults = c
+	i.History, _ = st.(storage.History)
+	i.events, i.snapshotInterval = events, uint64(snapshotInterval)
+	i.IObj = nil
+	err = i.restore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if i.IObj == nil {
+		err = i.importStates(ctx, st, c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	bigStates, err := st.ListBig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for name, s := range bigStates {
+		if err = i.BigCounters.Add(name, counter.CreateBigIncrementatorFromState(s)); err != nil {
+			return nil, err
+		}
+	}
+	i.OnUpdateBigCounter = func(name string, s counter.BigState) error {
+		return st.SaveBig(ctx, name, s)
+	}
+	i.OnDeleteBigCounter = func(name string) error {
+		return st.DeleteBig(ctx, name)
+	}
+	if i.lastSeq-i.snapshotSeq >= i.snapshotInterval {
+		err = i.saveSnapshot()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+// ReplayEvents функция восстанавливает состояние счетчиков Incrementator применением всех событий журнала src
+// без учета его снимка, переносит события в пустой журнал dst и сохраняет в него снимок итогового состояния
+// Если dst реализует интерфейс storage.Store, в него также сохраняется итоговое состояние счетчиков,
+// поэтому восстановленное хранилище может использоваться как в режиме журнала событий, так и без него
+// Изменения счетчиков произвольной точности и журнал изменений History в журнал событий не записываются,
+// поэтому переносятся из src в dst как есть: счетчики произвольной точности - если src и dst реализуют
+// интерфейс storage.Store, история изменений упомянутых в событиях счетчиков - если src и dst
+// реализуют интерфейс storage.History; в остальных случаях они в dst не переносятся
+// Возвращает количество перенесенных событий
+// В случае, если журнал dst не пуст, возвращает ErrEventLogNotEmpty
+func ReplayEvents(ctx context.Context, src, dst storage.EventLog) (n int, err error) {
+	err = dst.Events(ctx, 0, func(storage.Event) error {
+		return ErrEventLogNotEmpty
+	})
+	if err != nil {
+		return 0, err
+	}
+	i := &RPCIncrementator{Counters: counter.CreateRegistry(), events: dst}
+	names := map[string]bool{}
+	err = src.Events(ctx, 0, func(e storage.Event) error {
+		if err := i.apply(e); err != nil {
+			return fmt.Errorf("ошибка применения события %d: %w", e.Seq, err)
+		}
+		seq, err := dst.AppendEvent(ctx, e)
+		if err != nil {
+			return err
+		}
+		i.lastSeq = seq
+		names[e.Name] = true
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	if i.IObj == nil {
+		return n, errors.New("журнал событий не содержит создания счетчика по умолчанию")
+	}
+	err = i.saveSnapshot()
+	if err != nil {
+		return n, err
+	}
+	if st, ok := dst.(storage.Store); ok {
+		err = st.Save(ctx, "", i.IObj.GetState())
+		for _, name := range i.Counters.List() {
+			if IObj, e := i.Counters.Get(name); e == nil && err == nil {
+				err = st.Save(ctx, name, IObj.GetState())
+			}
+		}
+		if from, ok := src.(storage.Store); ok && err == nil {
+			err = copyBig(ctx, from, st)
+		}
+	}
+	if from, ok := src.(storage.History); ok && err == nil {
+		if to, ok := dst.(storage.History); ok {
+			err = copyHistory(ctx, from, to, names)
+		}
+	}
+	return n, err
+}
+
+// copyBig перенос состояния всех счетчиков произвольной точности из хранилища src в хранилище dst
+func copyBig(ctx context.Context, src, dst storage.Store) error {
+	states, err := src.ListBig(ctx)
+	if err != nil {
+		return err
+	}
+	for name, s := range states {
+		if err = dst.SaveBig(ctx, name, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyHistory перенос истории изменений счетчиков names из журнала src в журнал dst
+func copyHistory(ctx context.Context, src, dst storage.History, names map[string]bool) error {
+	for name := range names {
+		entries, err := src.History(ctx, name, time.Time{}, time.Time{})
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err = dst.AppendHistory(ctx, name, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restore восстановление состояния счетчиков из снимка и применением событий журнала, добавленных после снимка
+func (i *RPCIncrementator) restore(ctx context.Context) error {
+	snap, err := i.events.LoadSnapshot(ctx)
+	switch {
+	case err == nil:
+		for name, s := range snap.Counters {
+			err = i.apply(storage.Event{Name: name, Kind: storage.EventCreate, State: s})
+			if err != nil {
+				return fmt.Errorf("ошибка загрузки снимка состояния счетчиков: %w", err)
+			}
+		}
+		i.lastSeq, i.snapshotSeq = snap.Seq, snap.Seq
+	case !errors.Is(err, storage.ErrNotFound):
+		return err
+	}
+	return i.events.Events(ctx, i.lastSeq, func(e storage.Event) error {
+		if err := i.apply(e); err != nil {
+			return fmt.Errorf("ошибка применения события %d: %w", e.Seq, err)
+		}
+		i.lastSeq = e.Seq
+		return nil
+	})
+}
+
+// importStates перенос в пустой журнал событий счетчиков, сохраненных в хранилище st
+// Счетчик по умолчанию, отсутствующий в хранилище, создается с конфигурацией c
+func (i *RPCIncrementator) importStates(ctx context.Context, st storage.Store, c counter.Config) error {
+	s, err := st.Load(ctx, "")
+	switch {
+	case err == nil:
+		i.IObj = counter.CreateIncrementatorFromState(s)
+	case errors.Is(err, storage.ErrNotFound):
+		i.IObj, _ = counter.CreateIncrementatorFromConfig(c)
+		err = i.record("", "CreateCounter", i.IObj.GetState())
+		if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	err = i.appendEvent(storage.Event{Kind: storage.EventCreate, State: i.IObj.GetState()})
+	if err != nil {
+		return err
+	}
+	states, err := st.List(ctx)
+	if err != nil {
+		return err
+	}
+	for name, s := range states {
+		if err = i.Counters.Add(name, counter.CreateIncrementatorFromState(s)); err != nil {
+			return err
+		}
+		if err = i.appendEvent(storage.Event{Name: name, Kind: storage.EventCreate, State: s}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply применение события журнала к счетчикам без вызова обработчиков событий изменения
+func (i *RPCIncrementator) apply(e storage.Event) (err error) {
+	switch e.Kind {
+	case storage.EventCreate:
+		IObj := counter.CreateIncrementatorFromState(e.State)
+		if e.Name == "" {
+			i.IObj = IObj
+			return nil
+		}
+		return i.Counters.Add(e.Name, IObj)
+	case storage.EventDelete:
+		return i.Counters.Delete(e.Name)
+	}
+	IObj, err := i.lookup(e.Name)
+	if err != nil {
+		return err
+	}
+	if IObj == nil {
+		return errors.New("счетчик по умолчанию не создан")
+	}
+	if e.Kind == storage.EventConfigure {
+		// изменение применяется со временем события, как и при его записи в журнал
+		return IObj.ConfigureAt(e.Settings, e.Time, nil)
+	}
+	_, err = applyAt(IObj, e)
+	return err
+}
+
+// applyAt применение к счетчику IObj изменения значения, описанного событием e, со временем события,
+// поэтому восстановление из журнала приводит к тому же времени последнего изменения
+func applyAt(IObj *counter.Incrementator, e storage.Event) (counter.IncrementResult, error) {
+	switch e.Kind {
+	case storage.EventAdd:
+		return IObj.AddAt(e.Steps, e.Time)
+	case storage.EventSetValue:
+		return IObj.SwapAt(e.Value, e.Time)
+	}
+	return counter.IncrementResult{}, fmt.Errorf("неизвестный вид события %d", e.Kind)
+}
+
+// lockEvents блокировка изменений счетчиков в режиме журнала событий, чтобы порядок событий
+// в журнале совпадал с порядком их применения
+// Возвращает функцию разблокировки, которая сохраняет снимок состояния счетчиков, если после
+// предыдущего снимка в журнал добавлено snapshotInterval событий
+// Ошибка сохранения снимка не отменяет уже записанное в журнал изменение, поэтому только выводится в лог,
+// а сохранение повторяется после следующего изменения
+func (i *RPCIncrementator) lockEvents() (unlock func()) {
+	if i.events == nil {
+		return func() {}
+	}
+	i.eventsMtx.Lock()
+	return func() {
+		defer i.eventsMtx.Unlock()
+		if i.lastSeq-i.snapshotSeq >= i.snapshotInterval {
+			if err := i.saveSnapshot(); err != nil {
+				log.Printf("Ошибка сохранения снимка состояния счетчиков: %v", err)
+			}
+		}
+	}
+}
+
+// appendEvent добавление события в журнал в режиме журнала событий
+// Незаданное время события заменяется текущим временем
+// Вызывается при заблокированных изменениях счетчиков
+func (i *RPCIncrementator) appendEvent(e storage.Event) error {
+	if i.events == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	seq, err := i.events.AppendEvent(context.Background(), e)
+	if err != nil {
+		return err
+	}
+	i.lastSeq = seq
+	return nil
+}
+
+// saveSnapshot сохранение снимка текущего состояния счетчиков после последнего события журнала
+// Вызывается при заблокированных изменениях счетчиков
+func (i *RPCIncrementator) saveSnapshot() error {
+	snap := storage.Snapshot{Seq: i.lastSeq, Counters: map[string]counter.State{"": i.IObj.GetState()}}
+	for _, name := range i.Counters.List() {
+		if IObj, err := i.Counters.Get(name); err == nil {
+			snap.Counters[name] = IObj.GetState()
+		}
+	}
+	err := i.events.SaveSnapshot(context.Background(), snap)
+	if err != nil {
+		return err
+	}
+	i.snapshotSeq = i.lastSeq
+	return nil
+}
@@ -0,0 +1,230 @@
+package server
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+)
+
+// states состояние всех счетчиков Incrementator, включая счетчик по умолчанию с пустым именем
+func states(i *RPCIncrementator) map[string]counter.State {
+	result := map[string]counter.State{"": i.IObj.GetState()}
+	for _, name := range i.Counters.List() {
+		IObj, _ := i.Counters.Get(name)
+		result[name] = IObj.GetState()
+	}
+	return result
+}
+
+// checkStates сравнение состояния счетчиков, включая время последнего изменения
+func checkStates(t *testing.T, got, want map[string]counter.State) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Неверный набор счетчиков, ожидалось: %+v, получено: %+v", want, got)
+	}
+	for name, s := range want {
+		g, ok := got[name]
+		modified := g.Modified.Equal(s.Modified)
+		g.Modified = s.Modified
+		if !ok || !modified || g != s {
+			t.Fatalf("Неверное состояние счетчика %q, ожидалось: %+v, получено: %+v", name, s, got[name])
+		}
+	}
+}
+
+// changeCounters изменение счетчиков всеми видами изменений, записываемых в журнал событий
+func changeCounters(t *testing.T, inc *RPCIncrementator) {
+	t.Helper()
+	maxValue, step, policy := int64(10), int64(3), counter.OverflowWrap
+	var reply int64
+	for _, req := range []*CounterRequest{
+		{Name: "requests", Settings: &counter.Settings{MaxValue: &maxValue, Overflow: &policy}},
+		{Name: "atomic", Mode: counter.ModeAtomic},
+		{Name: "striped", Mode: counter.ModeStriped},
+		{Name: "removed"},
+	} {
+		if err := inc.CreateCounter(req, &reply); err != nil {
+			t.Fatalf("CreateCounter: метод возвратил ошибку: %q", err.Error())
+		}
+	}
+	var results []BatchResult
+	err := inc.IncrementBatch([]BatchIncrement{{Name: "requests", Steps: 25}, {Steps: 4}, {Name: "atomic", Steps: 2}, {Name: "striped", Steps: 7}}, &results)
+	if err != nil {
+		t.Fatalf("IncrementBatch: метод возвратил ошибку: %q", err.Error())
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			t.Fatalf("IncrementBatch: ошибка применения элемента: %s", r.Error)
+		}
+	}
+	if err = inc.DecrementCounter("striped", &reply); err != nil {
+		t.Fatalf("DecrementCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	if err = inc.SetValue(&SetValueRequest{Name: "atomic", Value: 40}, &reply); err != nil {
+		t.Fatalf("SetValue: метод возвратил ошибку: %q", err.Error())
+	}
+	var swapped bool
+	for _, old := range []int64{0, 40} {
+		if err = inc.CompareAndSwap(&CompareAndSwapRequest{Name: "atomic", OldValue: old, NewValue: 50}, &swapped); err != nil {
+			t.Fatalf("CompareAndSwap: метод возвратил ошибку: %q", err.Error())
+		}
+	}
+	var applied IncrementIfResult
+	for _, limit := range []int64{0, 100} {
+		if err = inc.IncrementIf(&IncrementIfRequest{Name: "atomic", Limit: limit}, &applied); err != nil {
+			t.Fatalf("IncrementIf: метод возвратил ошибку: %q", err.Error())
+		}
+	}
+	if err = inc.ConfigureCounter(&CounterRequest{Name: "requests", Settings: &counter.Settings{Step: &step}}, new(int)); err != nil {
+		t.Fatalf("ConfigureCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	if err = inc.SetSettings(&counter.Settings{Step: &step}, new(int)); err != nil {
+		t.Fatalf("SetSettings: метод возвратил ошибку: %q", err.Error())
+	}
+	if err = inc.DecrementNumber(0, &reply); err != nil {
+		t.Fatalf("DecrementNumber: метод возвратил ошибку: %q", err.Error())
+	}
+	if err = inc.DeleteCounter("removed", new(int)); err != nil {
+		t.Fatalf("DeleteCounter: метод возвратил ошибку: %q", err.Error())
+	}
+}
+
+// Тестирование восстановления состояния счетчиков из журнала событий и снимков состояния
+func TestEventSourced(t *testing.T) {
+	ctx := context.Background()
+	for _, interval := range []int{1, 4, DefaultSnapshotInterval} {
+		st := storage.CreateMemoryStore()
+		inc, err := CreateEventSourcedRPCIncrementator(st, st, counter.DefaultConfig(), interval)
+		if err != nil {
+			t.Fatalf("функция CreateEventSourcedRPCIncrementator вернула ошибку: %q", err.Error())
+		}
+		changeCounters(t, inc)
+		want := states(inc)
+		if _, err = st.Load(ctx, "requests"); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("В режиме журнала событий состояние счетчика сохранено в хранилище: %v", err)
+		}
+		snap, err := st.LoadSnapshot(ctx)
+		if interval < DefaultSnapshotInterval && (err != nil || snap.Seq == 0) {
+			t.Fatalf("Снимок состояния счетчиков не сохранен: %+v, ошибка: %v", snap, err)
+		}
+		restored, err := CreateEventSourcedRPCIncrementator(st, st, counter.DefaultConfig(), interval)
+		if err != nil {
+			t.Fatalf("функция CreateEventSourcedRPCIncrementator вернула ошибку: %q", err.Error())
+		}
+		checkStates(t, states(restored), want)
+		// после сохранения снимка при остановке сервиса события не применяются повторно
+		if err = restored.Flush(); err != nil {
+			t.Fatalf("метод Flush вернул ошибку: %q", err.Error())
+		}
+		restored, err = CreateEventSourcedRPCIncrementator(st, st, counter.DefaultConfig(), interval)
+		if err != nil {
+			t.Fatalf("функция CreateEventSourcedRPCIncrementator вернула ошибку: %q", err.Error())
+		}
+		checkStates(t, states(restored), want)
+	}
+}
+
+// Тестирование перевода счетчиков, сохраненных без журнала событий, в режим журнала событий
+func TestEventSourcedImport(t *testing.T) {
+	st := storage.CreateMemoryStore()
+	inc, err := CreatePersistentRPCIncrementator(st)
+	if err != nil {
+		t.Fatalf("функция CreatePersistentRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	var reply int64
+	if err = inc.CreateCounter(&CounterRequest{Name: "requests"}, &reply); err != nil {
+		t.Fatalf("CreateCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	if err = inc.IncrementBy(&BatchIncrement{Steps: 5}, new(counter.IncrementResult)); err != nil {
+		t.Fatalf("IncrementBy: метод возвратил ошибку: %q", err.Error())
+	}
+	want := states(inc)
+	sourced, err := CreateEventSourcedRPCIncrementator(st, st, counter.DefaultConfig(), DefaultSnapshotInterval)
+	if err != nil {
+		t.Fatalf("функция CreateEventSourcedRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	checkStates(t, states(sourced), want)
+	if err = sourced.IncrementCounter("requests", &reply); err != nil {
+		t.Fatalf("IncrementCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	want = states(sourced)
+	restored, err := CreateEventSourcedRPCIncrementator(st, st, counter.DefaultConfig(), DefaultSnapshotInterval)
+	if err != nil {
+		t.Fatalf("функция CreateEventSourcedRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	checkStates(t, states(restored), want)
+}
+
+// Тестирование восстановления счетчиков по журналу событий в новое хранилище
+func TestReplayEvents(t *testing.T) {
+	ctx := context.Background()
+	src := storage.CreateMemoryStore()
+	inc, err := CreateEventSourcedRPCIncrementator(src, src, counter.DefaultConfig(), 2)
+	if err != nil {
+		t.Fatalf("функция CreateEventSourcedRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	changeCounters(t, inc)
+	want := states(inc)
+	var big counter.BigState
+	if err = inc.CreateBigCounter(&BigCounterRequest{Name: "bytes"}, &big); err != nil {
+		t.Fatalf("CreateBigCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	var bigResult counter.BigIncrementResult
+	if err = inc.IncrementBigCounter(&BigIncrement{Name: "bytes", Steps: 7}, &bigResult); err != nil {
+		t.Fatalf("IncrementBigCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	if err = inc.GetBigState("bytes", &big); err != nil {
+		t.Fatalf("GetBigState: метод возвратил ошибку: %q", err.Error())
+	}
+	// снимок исходного журнала не используется при восстановлении
+	if err = src.SaveSnapshot(ctx, storage.Snapshot{Seq: 1000, Counters: map[string]counter.State{"": {Value: 12345}}}); err != nil {
+		t.Fatalf("метод SaveSnapshot вернул ошибку: %q", err.Error())
+	}
+	dst := storage.CreateMemoryStore()
+	n, err := ReplayEvents(ctx, src, dst)
+	if err != nil {
+		t.Fatalf("функция ReplayEvents вернула ошибку: %q", err.Error())
+	}
+	if n == 0 {
+		t.Fatal("функция ReplayEvents не перенесла события")
+	}
+	// восстановленное хранилище содержит итоговое состояние счетчиков
+	for name, s := range want {
+		loaded, err := dst.Load(ctx, name)
+		if err != nil {
+			t.Fatalf("Счетчик %q не сохранен в хранилище: %v", name, err)
+		}
+		checkStates(t, map[string]counter.State{name: loaded}, map[string]counter.State{name: s})
+	}
+	// счетчики произвольной точности и история изменений переносятся без изменений
+	for _, name := range []string{"", "requests", "removed"} {
+		history, err := src.History(ctx, name, time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("метод History вернул ошибку: %q", err.Error())
+		}
+		copied, err := dst.History(ctx, name, time.Time{}, time.Time{})
+		if err != nil || len(history) == 0 || !reflect.DeepEqual(copied, history) {
+			t.Fatalf("История изменений счетчика %q не перенесена, ожидалось: %+v, получено: %+v, ошибка: %v", name, history, copied, err)
+		}
+	}
+	restored, err := CreateEventSourcedRPCIncrementator(dst, dst, counter.DefaultConfig(), DefaultSnapshotInterval)
+	if err != nil {
+		t.Fatalf("функция CreateEventSourcedRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	checkStates(t, states(restored), want)
+	var restoredBig counter.BigState
+	if err = restored.GetBigState("bytes", &restoredBig); err != nil || restoredBig.Value.Cmp(big.Value) != 0 || restoredBig.Version != big.Version {
+		t.Fatalf("Счетчик произвольной точности не перенесен, ожидалось: %+v, получено: %+v, ошибка: %v", big, restoredBig, err)
+	}
+	if _, err = ReplayEvents(ctx, src, dst); !errors.Is(err, ErrEventLogNotEmpty) {
+		t.Fatalf("функция ReplayEvents не вернула ошибку ErrEventLogNotEmpty, получено: %v", err)
+	}
+}
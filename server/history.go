@@ -0,0 +1,87 @@
+package server
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+)
+
+// ErrHistoryDisabled ошибка обращения к истории изменений счетчиков, которая не ведется
+var ErrHistoryDisabled = errors.New("история изменений счетчиков не ведется")
+
+// ErrNoStateAsOf ошибка запроса состояния счетчика на момент, когда счетчик не существовал
+var ErrNoStateAsOf = errors.New("счетчик не существовал в заданный момент времени")
+
+// HistoryRequest запрос истории изменений счетчика за период, передаваемый клиентами по RPC протоколу
+type HistoryRequest struct {
+	Name string    // имя счетчика, пустое имя соответствует счетчику по умолчанию
+	From time.Time // начало периода, включительно
+	To   time.Time // конец периода, не включительно; нулевое значение не ограничивает период
+}
+
+// AsOfRequest запрос состояния счетчика на заданный момент времени, передаваемый клиентами по RPC протоколу
+type AsOfRequest struct {
+	Name string    // имя счетчика, пустое имя соответствует счетчику по умолчанию
+	At   time.Time // момент времени
+}
+
+// GetHistory метод возвращает записи истории изменений счетчика за период в порядке возрастания времени
+// Каждая запись содержит время изменения, имя выполнившего его RPC метода и состояние счетчика после изменения
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) GetHistory(req *HistoryRequest, resp *[]storage.HistoryEntry) (err error) {
+	if i.History == nil {
+		return ErrHistoryDisabled
+	}
+	*resp, err = i.History.History(context.Background(), req.Name, req.From, req.To)
+	return
+}
+
+// GetStateAsOf метод возвращает состояние счетчика на заданный момент времени по истории его изменений
+// В случае, если счетчик в этот момент еще не был создан или уже был удален, возвращает ErrNoStateAsOf
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) GetStateAsOf(req *AsOfRequest, resp *counter.State) error {
+	if i.History == nil {
+		return ErrHistoryDisabled
+	}
+	e, err := i.History.HistoryAsOf(context.Background(), req.Name, req.At)
+	if errors.Is(err, storage.ErrNotFound) || err == nil && e.Deleted {
+		return ErrNoStateAsOf
+	}
+	if err != nil {
+		return err
+	}
+	*resp = e.State
+	return nil
+}
+
+// record запись изменения счетчика name RPC методом operation в журнал, если он задан
+// Временем изменения считается время последнего изменения из снимка состояния счетчика
+func (i *RPCIncrementator) record(name, operation string, s counter.State) error {
+	if i.History == nil {
+		return nil
+	}
+	at := s.Modified
+	if at.IsZero() {
+		at = time.Now()
+	}
+	return i.History.AppendHistory(context.Background(), name, storage.HistoryEntry{Time: at, Operation: operation, State: s})
+}
+
+// recordDelete запись удаления счетчика name RPC методом operation в журнал, если он задан
+func (i *RPCIncrementator) recordDelete(name, operation string) error {
+	if i.History == nil {
+		return nil
+	}
+	return i.History.AppendHistory(context.Background(), name, storage.HistoryEntry{Time: time.Now(), Operation: operation, Deleted: true})
+}
@@ -0,0 +1,172 @@
+package server
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+)
+
+// Тестирование записи изменений счетчиков в журнал и чтения истории изменений
+func TestHistory(t *testing.T) {
+	inc, err := CreatePersistentRPCIncrementator(storage.CreateMemoryStore())
+	if err != nil {
+		t.Fatalf("функция CreatePersistentRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	start := time.Now()
+	var reply int64
+	if err = inc.CreateCounter(&CounterRequest{Name: "requests"}, &reply); err != nil {
+		t.Fatalf("CreateCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	var results []BatchResult
+	err = inc.IncrementBatch([]BatchIncrement{{Name: "requests", Steps: 2}, {Steps: 3}, {Name: "missing", Steps: 1}}, &results)
+	if err != nil {
+		t.Fatalf("IncrementBatch: метод возвратил ошибку: %q", err.Error())
+	}
+	step := int64(5)
+	if err = inc.ConfigureCounter(&CounterRequest{Name: "requests", Settings: &counter.Settings{Step: &step}}, new(int)); err != nil {
+		t.Fatalf("ConfigureCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	// неприменившиеся настройки не записываются в журнал
+	invalid := int64(-1)
+	if err = inc.ConfigureCounter(&CounterRequest{Name: "requests", Settings: &counter.Settings{Step: &invalid}}, new(int)); err == nil {
+		t.Fatal("ConfigureCounter: метод не вернул ошибку недопустимых настроек")
+	}
+	if err = inc.SetSettings(&counter.Settings{Step: &step}, new(int)); err != nil {
+		t.Fatalf("SetSettings: метод возвратил ошибку: %q", err.Error())
+	}
+	var state counter.State
+	if err = inc.GetState("requests", &state); err != nil {
+		t.Fatalf("GetState: метод возвратил ошибку: %q", err.Error())
+	}
+	if err = inc.DeleteCounter("requests", new(int)); err != nil {
+		t.Fatalf("DeleteCounter: метод возвратил ошибку: %q", err.Error())
+	}
+
+	var entries []storage.HistoryEntry
+	if err = inc.GetHistory(&HistoryRequest{Name: "requests"}, &entries); err != nil {
+		t.Fatalf("GetHistory: метод возвратил ошибку: %q", err.Error())
+	}
+	operations := []string{"CreateCounter", "IncrementBatch", "ConfigureCounter", "DeleteCounter"}
+	if len(entries) != len(operations) {
+		t.Fatalf("Неверное количество записей истории, ожидалось: %d, получено: %+v", len(operations), entries)
+	}
+	for k, e := range entries {
+		if e.Operation != operations[k] || e.Time.Before(start) {
+			t.Fatalf("Неверная запись истории %d, ожидалась операция %q, получено: %+v", k, operations[k], e)
+		}
+	}
+	if entries[1].State.Value != 2 || entries[2].State.Step != 5 || !entries[3].Deleted {
+		t.Fatalf("Неверное состояние счетчика в записях истории: %+v", entries)
+	}
+	if err = inc.GetHistory(&HistoryRequest{From: start}, &entries); err != nil {
+		t.Fatalf("GetHistory: метод возвратил ошибку: %q", err.Error())
+	}
+	if len(entries) != 2 || entries[0].Operation != "IncrementBatch" || entries[1].Operation != "SetSettings" || entries[1].State.Step != 5 {
+		t.Fatalf("Неверная история счетчика по умолчанию: %+v", entries)
+	}
+
+	var asOf counter.State
+	if err = inc.GetStateAsOf(&AsOfRequest{Name: "requests", At: state.Modified}, &asOf); err != nil {
+		t.Fatalf("GetStateAsOf: метод возвратил ошибку: %q", err.Error())
+	}
+	if asOf.Version != state.Version || asOf.Value != state.Value || asOf.Step != state.Step {
+		t.Fatalf("Неверное состояние счетчика на момент времени, ожидалось: %+v, получено: %+v", state, asOf)
+	}
+	for _, at := range []time.Time{start.Add(-time.Second), time.Now()} {
+		if err = inc.GetStateAsOf(&AsOfRequest{Name: "requests", At: at}, &asOf); !errors.Is(err, ErrNoStateAsOf) {
+			t.Fatalf("GetStateAsOf: не возвращена ошибка ErrNoStateAsOf на момент %v, получено: %v", at, err)
+		}
+	}
+}
+
+// Тестирование обращения к истории изменений счетчиков, которая не ведется
+func TestHistoryDisabled(t *testing.T) {
+	inc := CreateRPCIncrementator()
+	if err := inc.IncrementNumber(0, new(int64)); err != nil {
+		t.Fatalf("IncrementNumber: метод возвратил ошибку: %q", err.Error())
+	}
+	if err := inc.GetHistory(&HistoryRequest{}, new([]storage.HistoryEntry)); !errors.Is(err, ErrHistoryDisabled) {
+		t.Fatalf("GetHistory: не возвращена ошибка ErrHistoryDisabled, получено: %v", err)
+	}
+	if err := inc.GetStateAsOf(&AsOfRequest{At: time.Now()}, new(counter.State)); !errors.Is(err, ErrHistoryDisabled) {
+		t.Fatalf("GetStateAsOf: не возвращена ошибка ErrHistoryDisabled, получено: %v", err)
+	}
+}
+
+// Тестирование записи в журнал настроек счетчика ModeAtomic, примененных несмотря на ошибку сохранения
+func TestConfigureAtomicPersistError(t *testing.T) {
+	inc, err := CreatePersistentRPCIncrementator(storage.CreateMemoryStore())
+	if err != nil {
+		t.Fatalf("функция CreatePersistentRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	if err = inc.CreateCounter(&CounterRequest{Name: "requests", Mode: counter.ModeAtomic}, new(int64)); err != nil {
+		t.Fatalf("CreateCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	persistErr := errors.New("ошибка сохранения")
+	inc.OnUpdateCounter = func(string, counter.State) error { return persistErr }
+	step := int64(5)
+	err = inc.ConfigureCounter(&CounterRequest{Name: "requests", Settings: &counter.Settings{Step: &step}}, new(int))
+	var e *counter.PersistError
+	if !errors.As(err, &e) || !errors.Is(err, persistErr) {
+		t.Fatalf("ConfigureCounter: метод не вернул ошибку сохранения примененных настроек, получено: %v", err)
+	}
+	var entries []storage.HistoryEntry
+	if err = inc.GetHistory(&HistoryRequest{Name: "requests"}, &entries); err != nil {
+		t.Fatalf("GetHistory: метод возвратил ошибку: %q", err.Error())
+	}
+	if len(entries) != 2 || entries[1].Operation != "ConfigureCounter" || entries[1].State.Step != step || entries[1].State.Version != 1 {
+		t.Fatalf("Примененные настройки не записаны в журнал: %+v", entries)
+	}
+}
+
+// Тестирование журнала изменений при конкурентном изменении счетчика
+func TestHistoryConcurrent(t *testing.T) {
+	const goroutines, increments = 8, 50
+	for _, mode := range []counter.Mode{counter.ModeMutex, counter.ModeAtomic} {
+		inc, err := CreatePersistentRPCIncrementator(storage.CreateMemoryStore())
+		if err != nil {
+			t.Fatalf("функция CreatePersistentRPCIncrementator вернула ошибку: %q", err.Error())
+		}
+		if err = inc.CreateCounter(&CounterRequest{Name: "requests", Mode: mode}, new(int64)); err != nil {
+			t.Fatalf("CreateCounter: метод возвратил ошибку: %q", err.Error())
+		}
+		var w sync.WaitGroup
+		w.Add(goroutines)
+		for g := 0; g < goroutines; g++ {
+			go func(g int) {
+				defer w.Done()
+				for k := 0; k < increments; k++ {
+					if g%2 == 0 {
+						inc.IncrementCounter("requests", new(int64))
+					} else {
+						inc.IncrementBatch([]BatchIncrement{{Name: "requests", Steps: 1}}, new([]BatchResult))
+					}
+				}
+			}(g)
+		}
+		w.Wait()
+		var entries []storage.HistoryEntry
+		if err = inc.GetHistory(&HistoryRequest{Name: "requests"}, &entries); err != nil {
+			t.Fatalf("GetHistory: метод возвратил ошибку: %q", err.Error())
+		}
+		if len(entries) != goroutines*increments+1 {
+			t.Fatalf("режим %s: неверное количество записей истории: %d", mode, len(entries))
+		}
+		// записи в порядке времени соответствуют версиям состояния без пропусков и повторов
+		for k, e := range entries {
+			if e.State.Version != uint64(k) || e.State.Value != int64(k) {
+				t.Fatalf("режим %s: запись истории %d содержит состояние версии %d со значением %d", mode, k, e.State.Version, e.State.Value)
+			}
+			if k > 0 && e.Operation != "IncrementCounter" && e.Operation != "IncrementBatch" {
+				t.Fatalf("режим %s: неверная операция записи истории %d: %q", mode, k, e.Operation)
+			}
+		}
+	}
+}
@@ -0,0 +1,798 @@
+// Пакет server реализует RPC сервер работы со счетчиками пакета counter
+package server
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+)
+
+// CounterRequest запрос к именованному счетчику, передаваемый клиентами по RPC протоколу
+type CounterRequest struct {
+	Name     string            // имя счетчика
+	Settings *counter.Settings // желаемые настройки счетчика, используются при создании счетчика и изменении его настроек
+	Mode     counter.Mode      // режим синхронизации счетчика, используется только при создании счетчика
+}
+
+// BatchIncrement запрос на увеличение счетчика на несколько шагов, передаваемый клиентами по RPC протоколу
+type BatchIncrement struct {
+	Name  string // имя счетчика, пустое имя соответствует счетчику по умолчанию
+	Steps int64  // количество шагов увеличения счетчика
+}
+
+// BatchResult результат применения одного элемента пакета изменений счетчиков
+type BatchResult struct {
+	counter.IncrementResult
+	Error string // текст ошибки применения изменения, пустой при успешном применении
+}
+
+// CompareAndSwapRequest запрос на условное присваивание значения счетчику, передаваемый клиентами по RPC протоколу
+type CompareAndSwapRequest struct {
+	Name     string // имя счетчика, пустое имя соответствует счетчику по умолчанию
+	OldValue int64  // ожидаемое текущее значение счетчика
+	NewValue int64  // присваиваемое значение счетчика
+}
+
+// SetValueRequest запрос на присваивание значения счетчику, передаваемый клиентами по RPC протоколу
+type SetValueRequest struct {
+	Name  string // имя счетчика, пустое имя соответствует счетчику по умолчанию
+	Value int64  // присваиваемое значение счетчика
+}
+
+// IncrementIfRequest запрос на условное увеличение счетчика, передаваемый клиентами по RPC протоколу
+type IncrementIfRequest struct {
+	Name  string // имя счетчика, пустое имя соответствует счетчику по умолчанию
+	Limit int64  // значение, которое счетчик не должен превысить после увеличения
+}
+
+// IncrementIfResult результат условного увеличения счетчика
+type IncrementIfResult struct {
+	counter.IncrementResult
+	Applied bool // признак выполнения увеличения
+}
+
+// BigCounterRequest запрос к именованному счетчику произвольной точности, передаваемый клиентами по RPC протоколу
+type BigCounterRequest struct {
+	Name     string               // имя счетчика
+	Settings *counter.BigSettings // желаемые настройки счетчика, используются при создании счетчика и изменении его настроек
+}
+
+// BigIncrement запрос на изменение счетчика произвольной точности на несколько шагов, передаваемый клиентами по RPC протоколу
+type BigIncrement struct {
+	Name  string // имя счетчика
+	Steps uint64 // количество шагов изменения счетчика
+}
+
+// OnUpdateIncrementor функция обработчик события изменения состояния счетчика
+// s - согласованный снимок нового состояния счетчика
+type OnUpdateIncrementor func(s counter.State) error
+
+// OnUpdateCounter функция обработчик события создания или изменения состояния именованного счетчика
+// s - согласованный снимок нового состояния счетчика
+type OnUpdateCounter func(name string, s counter.State) error
+
+// OnDeleteCounter функция обработчик события удаления именованного счетчика
+type OnDeleteCounter func(name string) error
+
+// OnUpdateBigCounter функция обработчик события создания или изменения состояния счетчика произвольной точности
+// s - согласованный снимок нового состояния счетчика
+type OnUpdateBigCounter func(name string, s counter.BigState) error
+
+// RPCIncrementator объект-обертка, позволяющая вести подсчет
+// возникновений определенного события, ресурсов и.т.д
+// Используется для регистрации RPC сервера
+type RPCIncrementator struct {
+	IObj            *counter.Incrementator
+	OnUpdate        OnUpdateIncrementor
+	Counters        *counter.Registry[*counter.Incrementator] // реестр именованных счетчиков
+	OnUpdateCounter OnUpdateCounter                           // обработчик события создания или изменения именованного счетчика
+	OnDeleteCounter OnDeleteCounter                           // обработчик события удаления именованного счетчика
+	deleteMtx       sync.RWMutex                              // мьютекс, исключающий сохранение именованных счетчиков во время их удаления
+	// BigCounters реестр именованных счетчиков произвольной точности
+	BigCounters *counter.Registry[*counter.BigIncrementator]
+	// OnUpdateBigCounter обработчик события создания или изменения счетчика произвольной точности
+	OnUpdateBigCounter OnUpdateBigCounter
+	// OnDeleteBigCounter обработчик события удаления счетчика произвольной точности
+	OnDeleteBigCounter OnDeleteCounter
+	// Defaults конфигурация, с которой создаются именованные счетчики до применения
+	// переданных клиентом настроек; режим и функция сохранения конфигурации не используются
+	// После начала обслуживания клиентов изменяется только методом SetDefaults
+	Defaults    counter.Config
+	defaultsMtx sync.RWMutex // мьютекс для блокировки чтения Defaults во время его изменения
+	// History журнал, в который записывается каждое изменение состояния и настроек счетчиков
+	// и из которого читают методы GetHistory и GetStateAsOf; если не задан, история не ведется
+	// Изменения счетчиков произвольной точности в журнал не записываются
+	History storage.History
+	// events журнал событий, из которого восстанавливается состояние счетчиков в режиме журнала событий;
+	// задается функцией CreateEventSourcedRPCIncrementator
+	events           storage.EventLog
+	eventsMtx        sync.Mutex // мьютекс, упорядочивающий изменения счетчиков в режиме журнала событий
+	snapshotInterval uint64     // количество событий журнала между снимками состояния счетчиков
+	lastSeq          uint64     // номер последнего события журнала
+	snapshotSeq      uint64     // номер последнего события журнала, учтенного в снимке состояния счетчиков
+}
+
+// GetDefaults метод возвращает конфигурацию, с которой создаются именованные счетчики
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) GetDefaults() counter.Config {
+	i.defaultsMtx.RLock()
+	defer i.defaultsMtx.RUnlock()
+	return i.Defaults
+}
+
+// SetDefaults метод заменяет конфигурацию, с которой создаются новые именованные счетчики
+// Уже созданные счетчики не изменяются
+// В случае недопустимой конфигурации возвращает ошибку *counter.SettingsError
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) SetDefaults(c counter.Config) error {
+	err := c.Validate()
+	if err != nil {
+		return err
+	}
+	i.defaultsMtx.Lock()
+	defer i.defaultsMtx.Unlock()
+	i.Defaults = c
+	return nil
+}
+
+// CreateRPCIncrementator функция создает новый объет типа RPCIncrementator с конфигурацией
+// счетчиков по умолчанию и возвращает указатель на него.
+func CreateRPCIncrementator() *RPCIncrementator {
+	c := counter.DefaultConfig()
+	// конфигурация по умолчанию всегда допустима
+	IObj, _ := counter.CreateIncrementatorFromConfig(c)
+	return &RPCIncrementator{IObj: IObj, Counters: counter.CreateRegistry(), BigCounters: counter.CreateBigRegistry(), Defaults: c}
+}
+
+// CreatePersistentRPCIncrementator функция создает новый объет типа RPCIncrementator,
+// загружает состояние счетчиков из хранилища st и устанавливает обработчики событий,
+// сохраняющие в него каждое изменение, и возвращает указатель на объект.
+// Если хранилище реализует интерфейс storage.History, оно же используется как журнал изменений счетчиков
+func CreatePersistentRPCIncrementator(st storage.Store) (*RPCIncrementator, error) {
+	return CreatePersistentRPCIncrementatorFromConfig(st, counter.DefaultConfig())
+}
+
+// CreatePersistentRPCIncrementatorFromConfig функция аналогична CreatePersistentRPCIncrementator,
+// но счетчик по умолчанию, отсутствующий в хранилище, и новые именованные счетчики
+// создаются с конфигурацией c
+// Счетчик по умолчанию, отсутствующий в хранилище, сразу сохраняется в него
+// В случае недопустимой конфигурации возвращает ошибку *counter.SettingsError
+func CreatePersistentRPCIncrementatorFromConfig(st storage.Store, c counter.Config) (i *RPCIncrementator, err error) {
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	i = CreateRPCIncrementator()
+	i.Defaults = c
+	i.History, _ = st.(storage.History)
+	s, err := st.Load(ctx, "")
+	switch {
+	case err == nil:
+		i.IObj = counter.CreateIncrementatorFromState(s)
+	case errors.Is(err, storage.ErrNotFound):
+		i.IObj, _ = counter.CreateIncrementatorFromConfig(c)
+		err = st.Save(ctx, "", i.IObj.GetState())
+		if err != nil {
+			return nil, err
+		}
+		err = i.record("", "CreateCounter", i.IObj.GetState())
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	states, err := st.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for name, s := range states {
+		if err = i.Counters.Add(name, counter.CreateIncrementatorFromState(s)); err != nil {
+			return nil, err
+		}
+	}
+	bigStates, err := st.ListBig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for name, s := range bigStates {
+		if err = i.BigCounters.Add(name, counter.CreateBigIncrementatorFromState(s)); err != nil {
+			return nil, err
+		}
+	}
+	// обработчики событий вызываются RPC методами, которые не получают контекст от клиента
+	i.OnUpdate = func(s counter.State) error {
+		return st.Save(ctx, "", s)
+	}
+	i.OnUpdateCounter = func(name string, s counter.State) error {
+		return st.Save(ctx, name, s)
+	}
+	i.OnDeleteCounter = func(name string) error {
+		return st.Delete(ctx, name)
+	}
+	i.OnUpdateBigCounter = func(name string, s counter.BigState) error {
+		return st.SaveBig(ctx, name, s)
+	}
+	i.OnDeleteBigCounter = func(name string) error {
+		return st.DeleteBig(ctx, name)
+	}
+	return i, nil
+}
+
+// GetNumber метод возвращает текущее значение счетчика
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) GetNumber(req int, resp *int64) error {
+	*resp = i.IObj.GetNumber()
+	return nil
+}
+
+// GetState метод возвращает согласованный снимок состояния счетчика: значение, настройки,
+// общее количество переходов через границу диапазона и время последнего изменения
+// req - имя счетчика, пустое имя соответствует счетчику по умолчанию
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) GetState(req string, resp *counter.State) error {
+	IObj, err := i.lookup(req)
+	if err != nil {
+		return err
+	}
+	*resp = IObj.GetState()
+	return nil
+}
+
+// IncrementNumber метод увеличивает значение счетчика
+// req - запрос от клиента
+// resp - ответ клиенту, значение счетчика после увеличения
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) IncrementNumber(req int, resp *int64) error {
+	r, err := i.change("", "IncrementNumber", storage.Event{Kind: storage.EventAdd, Steps: 1}, (*counter.Incrementator).Increment)
+	*resp = r.Value
+	return err
+}
+
+// DecrementNumber метод уменьшает значение счетчика
+// req - запрос от клиента
+// resp - ответ клиенту, значение счетчика после уменьшения
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) DecrementNumber(req int, resp *int64) error {
+	r, err := i.change("", "DecrementNumber", storage.Event{Kind: storage.EventAdd, Steps: -1}, (*counter.Incrementator).Decrement)
+	*resp = r.Value
+	return err
+}
+
+// IncrementAndGet метод увеличивает значение счетчика и возвращает его значения
+// до и после изменения, вычисленные атомарно вместе с изменением
+// req - имя счетчика, пустое имя соответствует счетчику по умолчанию
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) IncrementAndGet(req string, resp *counter.IncrementResult) (err error) {
+	*resp, err = i.change(req, "IncrementAndGet", storage.Event{Kind: storage.EventAdd, Steps: 1}, (*counter.Incrementator).Increment)
+	return
+}
+
+// DecrementAndGet метод уменьшает значение счетчика и возвращает его значения
+// до и после изменения, вычисленные атомарно вместе с изменением
+// req - имя счетчика, пустое имя соответствует счетчику по умолчанию
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) DecrementAndGet(req string, resp *counter.IncrementResult) (err error) {
+	*resp, err = i.change(req, "DecrementAndGet", storage.Event{Kind: storage.EventAdd, Steps: -1}, (*counter.Incrementator).Decrement)
+	return
+}
+
+// IncrementBy метод атомарно увеличивает значение счетчика на заданное количество шагов
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) IncrementBy(req *BatchIncrement, resp *counter.IncrementResult) (err error) {
+	*resp, err = i.incrementBy(req, "IncrementBy")
+	return
+}
+
+// IncrementBatch метод применяет пакет увеличений нескольких счетчиков за один вызов
+// Каждый элемент пакета применяется атомарно и независимо от остальных,
+// ошибка применения элемента возвращается в его результате
+// req - запрос от клиента
+// resp - ответ клиенту, результаты в порядке элементов запроса
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) IncrementBatch(req []BatchIncrement, resp *[]BatchResult) error {
+	results := make([]BatchResult, len(req))
+	for k := range req {
+		var err error
+		results[k].IncrementResult, err = i.incrementBy(&req[k], "IncrementBatch")
+		if err != nil {
+			results[k].Error = err.Error()
+		}
+	}
+	*resp = results
+	return nil
+}
+
+// CompareAndSwap метод присваивает счетчику новое значение, только если его текущее значение
+// совпадает с ожидаемым, что позволяет клиентам реализовать оптимистичную координацию
+// req - запрос от клиента
+// resp - ответ клиенту, признак выполнения присваивания
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) CompareAndSwap(req *CompareAndSwapRequest, resp *bool) error {
+	_, err := i.change(req.Name, "CompareAndSwap", storage.Event{Kind: storage.EventSetValue, Value: req.NewValue}, func(IObj *counter.Incrementator) (r counter.IncrementResult, err error) {
+		r, *resp, err = IObj.SwapIf(req.OldValue, req.NewValue)
+		return
+	})
+	return err
+}
+
+// SetValue метод присваивает счетчику значение
+// req - запрос от клиента
+// resp - ответ клиенту, значение счетчика до присваивания
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) SetValue(req *SetValueRequest, resp *int64) error {
+	r, err := i.change(req.Name, "SetValue", storage.Event{Kind: storage.EventSetValue, Value: req.Value}, func(IObj *counter.Incrementator) (counter.IncrementResult, error) {
+		return IObj.Swap(req.Value)
+	})
+	*resp = r.Previous
+	return err
+}
+
+// IncrementIf метод увеличивает значение счетчика, только если значение после увеличения не превысит заданный предел
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) IncrementIf(req *IncrementIfRequest, resp *IncrementIfResult) (err error) {
+	resp.IncrementResult, err = i.change(req.Name, "IncrementIf", storage.Event{Kind: storage.EventAdd, Steps: 1}, func(IObj *counter.Incrementator) (r counter.IncrementResult, err error) {
+		r, resp.Applied, err = IObj.IncrementIf(req.Limit)
+		return
+	})
+	return
+}
+
+// SetSettings метод принимает новые настройки счетчика
+// Настройки проверяются целиком, применяются атомарно и сохраняются до фиксации изменения,
+// поэтому при ошибке проверки или сохранения счетчик остается без изменений
+// В случае недопустимых настроек возвращает ошибку со списком всех недопустимых полей
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) SetSettings(req *counter.Settings, resp *int) error {
+	return i.configure("", "SetSettings", req)
+}
+
+// CreateCounter метод создает новый именованный счетчик с конфигурацией Defaults,
+// к которой применяются переданные клиентом настройки
+// В случае, если имя счетчика занято или настройки некорректны, - возвращает ошибку
+// req - запрос от клиента
+// resp - ответ клиенту, текущее значение созданного счетчика
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) CreateCounter(req *CounterRequest, resp *int64) error {
+	if !req.Mode.Valid() {
+		return counter.ErrInvalidMode
+	}
+	c := i.GetDefaults()
+	c.Mode, c.Persist = req.Mode, nil
+	IObj, err := counter.CreateIncrementatorFromConfig(c)
+	if err != nil {
+		return err
+	}
+	err = IObj.Configure(req.Settings)
+	if err != nil {
+		return err
+	}
+	// время создания записывается в состояние счетчика, поэтому последующие изменения, время которых
+	// в режимах ModeAtomic и ModeStriped берется из грубых часов, не предшествуют созданию в журнале
+	s := IObj.GetState()
+	s.Modified = time.Now()
+	IObj = counter.CreateIncrementatorFromState(s)
+	defer i.lockEvents()()
+	err = i.Counters.Add(req.Name, IObj)
+	if err != nil {
+		return err
+	}
+	err = i.appendEvent(storage.Event{Name: req.Name, Kind: storage.EventCreate, State: IObj.GetState()})
+	if err != nil {
+		i.Counters.Delete(req.Name)
+		return err
+	}
+	*resp = IObj.GetNumber()
+	return i.update(req.Name, "CreateCounter", IObj, IObj.GetState())
+}
+
+// GetCounter метод возвращает текущее значение именованного счетчика
+// req - имя счетчика
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) GetCounter(req string, resp *int64) error {
+	IObj, err := i.Counters.Get(req)
+	if err != nil {
+		return err
+	}
+	*resp = IObj.GetNumber()
+	return nil
+}
+
+// IncrementCounter метод увеличивает значение именованного счетчика
+// req - имя счетчика
+// resp - ответ клиенту, значение счетчика после увеличения
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) IncrementCounter(req string, resp *int64) error {
+	if req == "" {
+		return counter.ErrInvalidCounterName
+	}
+	r, err := i.change(req, "IncrementCounter", storage.Event{Kind: storage.EventAdd, Steps: 1}, (*counter.Incrementator).Increment)
+	*resp = r.Value
+	return err
+}
+
+// DecrementCounter метод уменьшает значение именованного счетчика
+// req - имя счетчика
+// resp - ответ клиенту, значение счетчика после уменьшения
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) DecrementCounter(req string, resp *int64) error {
+	if req == "" {
+		return counter.ErrInvalidCounterName
+	}
+	r, err := i.change(req, "DecrementCounter", storage.Event{Kind: storage.EventAdd, Steps: -1}, (*counter.Incrementator).Decrement)
+	*resp = r.Value
+	return err
+}
+
+// ConfigureCounter метод принимает новые настройки именованного счетчика
+// Настройки применяются так же, как в методе SetSettings
+// В случае, если счетчик не найден или настройки недопустимы, - возвращает ошибку
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) ConfigureCounter(req *CounterRequest, resp *int) error {
+	if req.Name == "" {
+		return counter.ErrInvalidCounterName
+	}
+	return i.configure(req.Name, "ConfigureCounter", req.Settings)
+}
+
+// ListCounters метод возвращает отсортированный список имен именованных счетчиков
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) ListCounters(req int, resp *[]string) error {
+	*resp = i.Counters.List()
+	return nil
+}
+
+// DeleteCounter метод удаляет именованный счетчик
+// req - имя счетчика
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) DeleteCounter(req string, resp *int) (err error) {
+	defer i.lockEvents()()
+	if i.events != nil {
+		if _, err = i.Counters.Get(req); err != nil {
+			return
+		}
+		if err = i.appendEvent(storage.Event{Name: req, Kind: storage.EventDelete}); err != nil {
+			return
+		}
+	}
+	i.deleteMtx.Lock()
+	defer i.deleteMtx.Unlock()
+	err = i.Counters.Delete(req)
+	if err != nil {
+		return
+	}
+	if i.OnDeleteCounter != nil {
+		err = i.OnDeleteCounter(req)
+	}
+	if e := i.recordDelete(req, "DeleteCounter"); err == nil {
+		err = e
+	}
+	return
+}
+
+// CreateBigCounter метод создает новый именованный счетчик произвольной точности с настройками по умолчанию,
+// к которым применяются переданные клиентом настройки
+// В случае, если имя счетчика занято или настройки некорректны, - возвращает ошибку
+// req - запрос от клиента
+// resp - ответ клиенту, состояние созданного счетчика
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) CreateBigCounter(req *BigCounterRequest, resp *counter.BigState) error {
+	IObj := counter.CreateBigIncrementator()
+	err := IObj.Configure(req.Settings)
+	if err != nil {
+		return err
+	}
+	err = i.BigCounters.Add(req.Name, IObj)
+	if err != nil {
+		return err
+	}
+	*resp = IObj.GetState()
+	return i.updateBigCounter(req.Name, IObj, *resp)
+}
+
+// GetBigState метод возвращает согласованный снимок состояния счетчика произвольной точности
+// req - имя счетчика
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) GetBigState(req string, resp *counter.BigState) error {
+	IObj, err := i.BigCounters.Get(req)
+	if err != nil {
+		return err
+	}
+	*resp = IObj.GetState()
+	return nil
+}
+
+// IncrementBigCounter метод атомарно увеличивает значение счетчика произвольной точности на заданное количество шагов
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) IncrementBigCounter(req *BigIncrement, resp *counter.BigIncrementResult) (err error) {
+	*resp, err = i.changeBig(req.Name, func(IObj *counter.BigIncrementator) (counter.BigIncrementResult, error) {
+		return IObj.IncrementBy(req.Steps)
+	})
+	return
+}
+
+// DecrementBigCounter метод атомарно уменьшает значение счетчика произвольной точности на заданное количество шагов
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) DecrementBigCounter(req *BigIncrement, resp *counter.BigIncrementResult) (err error) {
+	*resp, err = i.changeBig(req.Name, func(IObj *counter.BigIncrementator) (counter.BigIncrementResult, error) {
+		return IObj.DecrementBy(req.Steps)
+	})
+	return
+}
+
+// ConfigureBigCounter метод принимает новые настройки счетчика произвольной точности
+// Настройки применяются так же, как в методе SetSettings
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) ConfigureBigCounter(req *BigCounterRequest, resp *int) error {
+	IObj, err := i.BigCounters.Get(req.Name)
+	if err != nil {
+		return err
+	}
+	return IObj.ConfigureWith(req.Settings, func(s counter.BigState) error {
+		return i.updateBigCounter(req.Name, IObj, s)
+	})
+}
+
+// ListBigCounters метод возвращает отсортированный список имен счетчиков произвольной точности
+// req - запрос от клиента
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) ListBigCounters(req int, resp *[]string) error {
+	*resp = i.BigCounters.List()
+	return nil
+}
+
+// DeleteBigCounter метод удаляет счетчик произвольной точности
+// req - имя счетчика
+// resp - ответ клиенту
+// Вызов метода потокобезопасен
+func (i *RPCIncrementator) DeleteBigCounter(req string, resp *int) (err error) {
+	i.deleteMtx.Lock()
+	defer i.deleteMtx.Unlock()
+	err = i.BigCounters.Delete(req)
+	if err != nil {
+		return
+	}
+	if i.OnDeleteBigCounter != nil {
+		err = i.OnDeleteBigCounter(req)
+	}
+	return
+}
+
+// Flush метод передает обработчикам событий изменения снимки текущего состояния всех счетчиков
+// Вызывается при остановке сервиса после завершения RPC вызовов, чтобы хранилище
+// содержало последнее состояние счетчиков, в том числе изменения распределенных счетчиков,
+// снимки которых могли быть сохранены не по порядку
+// Возвращает первую ошибку сохранения, продолжая сохранять остальные счетчики
+func (i *RPCIncrementator) Flush() (err error) {
+	keep := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+	if i.events != nil {
+		i.eventsMtx.Lock()
+		if i.lastSeq > i.snapshotSeq {
+			keep(i.saveSnapshot())
+		}
+		i.eventsMtx.Unlock()
+	}
+	if i.OnUpdate != nil {
+		keep(i.OnUpdate(i.IObj.GetState()))
+	}
+	for _, name := range i.Counters.List() {
+		if IObj, e := i.Counters.Get(name); e == nil {
+			keep(i.updateCounter(name, IObj, IObj.GetState()))
+		}
+	}
+	for _, name := range i.BigCounters.List() {
+		if IObj, e := i.BigCounters.Get(name); e == nil {
+			keep(i.updateBigCounter(name, IObj, IObj.GetState()))
+		}
+	}
+	return
+}
+
+// lookup метод возвращает счетчик по имени
+// Пустое имя соответствует счетчику по умолчанию
+func (i *RPCIncrementator) lookup(name string) (*counter.Incrementator, error) {
+	if name == "" {
+		return i.IObj, nil
+	}
+	return i.Counters.Get(name)
+}
+
+// incrementBy увеличение счетчика на заданное количество шагов RPC методом operation
+func (i *RPCIncrementator) incrementBy(req *BatchIncrement, operation string) (counter.IncrementResult, error) {
+	return i.change(req.Name, operation, storage.Event{Kind: storage.EventAdd, Steps: req.Steps}, func(IObj *counter.Incrementator) (counter.IncrementResult, error) {
+		return IObj.IncrementBy(req.Steps)
+	})
+}
+
+// change изменение счетчика с именем name операцией op, вызов обработчика события изменения
+// и запись изменения в журнал от имени RPC метода operation
+// В режиме журнала событий изменение записывается в журнал событием e до его применения к счетчику
+// Пустое имя соответствует счетчику по умолчанию
+func (i *RPCIncrementator) change(name, operation string, e storage.Event, op func(*counter.Incrementator) (counter.IncrementResult, error)) (counter.IncrementResult, error) {
+	defer i.lockEvents()()
+	IObj, err := i.lookup(name)
+	if err != nil {
+		return counter.IncrementResult{}, err
+	}
+	var r counter.IncrementResult
+	if i.events != nil {
+		// в журнал записываются только применимые изменения, поэтому операция сначала
+		// выполняется с копией счетчика, а изменения счетчиков упорядочены блокировкой
+		r, err = op(counter.CreateIncrementatorFromState(IObj.GetState()))
+		if err != nil || unchanged(r) {
+			return r, err
+		}
+		e.Name, e.Time = name, time.Now()
+		if err = i.appendEvent(e); err != nil {
+			return counter.IncrementResult{}, err
+		}
+		// к счетчику применяется само записанное событие, поэтому время изменения совпадает со временем события
+		r, err = applyAt(IObj, e)
+	} else {
+		r, err = op(IObj)
+	}
+	// неизменившееся состояние счетчика не требует сохранения
+	if err != nil || unchanged(r) {
+		return r, err
+	}
+	// состояние после изменения получено вместе с ним, поэтому при конкурентных изменениях
+	// каждая запись журнала соответствует своему изменению; в режиме ModeStriped значение
+	// не линеаризуемо, и состояние читается после изменения
+	s := r.State
+	if s.Version == 0 {
+		s = IObj.GetState()
+	}
+	return r, i.update(name, operation, IObj, s)
+}
+
+// configure применение настроек s к счетчику с именем name RPC методом operation,
+// сохранение счетчика до фиксации изменения и запись изменения в журнал
+// В режиме журнала событий настройки сначала применяются к копии счетчика, чтобы в журнал
+// записывались только применимые изменения, и событие записывается до изменения счетчика
+// Пустое имя соответствует счетчику по умолчанию
+func (i *RPCIncrementator) configure(name, operation string, s *counter.Settings) error {
+	defer i.lockEvents()()
+	IObj, err := i.lookup(name)
+	if err != nil || s == nil {
+		return err
+	}
+	var saved counter.State
+	persist := func(st counter.State) error {
+		saved = st
+		return i.save(name, IObj, st)
+	}
+	if i.events != nil {
+		if err = counter.CreateIncrementatorFromState(IObj.GetState()).Configure(s); err != nil {
+			return err
+		}
+		e := storage.Event{Name: name, Kind: storage.EventConfigure, Settings: s, Time: time.Now()}
+		if err = i.appendEvent(e); err != nil {
+			return err
+		}
+		// время изменения совпадает со временем события, поэтому восстановление из журнала
+		// приводит к тому же времени последнего изменения
+		err = IObj.ConfigureAt(s, e.Time, persist)
+	} else {
+		err = IObj.ConfigureWith(s, persist)
+	}
+	// в режиме ModeAtomic счетчик сохраняется после фиксации, и ошибка сохранения не отменяет изменение
+	var persistErr *counter.PersistError
+	if err != nil && !errors.As(err, &persistErr) {
+		return err
+	}
+	if e := i.record(name, operation, saved); err == nil {
+		err = e
+	}
+	return err
+}
+
+// unchanged признак изменения, не изменившего значение счетчика и количество переходов через границу диапазона
+func unchanged(r counter.IncrementResult) bool {
+	return r.Previous == r.Value && !r.Wrapped
+}
+
+// update вызов обработчика события изменения счетчика name и запись изменения в журнал
+// Запись в журнал выполняется и при ошибке сохранения, так как изменение уже применено к счетчику;
+// возвращается первая из ошибок
+func (i *RPCIncrementator) update(name, operation string, IObj *counter.Incrementator, s counter.State) (err error) {
+	err = i.save(name, IObj, s)
+	if e := i.record(name, operation, s); err == nil {
+		err = e
+	}
+	return
+}
+
+// save вызов обработчика события изменения счетчика name
+// Пустое имя соответствует счетчику по умолчанию
+func (i *RPCIncrementator) save(name string, IObj *counter.Incrementator, s counter.State) error {
+	if name == "" {
+		if i.OnUpdate != nil {
+			return i.OnUpdate(s)
+		}
+		return nil
+	}
+	return i.updateCounter(name, IObj, s)
+}
+
+// changeBig изменение счетчика произвольной точности с именем name операцией op
+// и вызов обработчика события изменения
+func (i *RPCIncrementator) changeBig(name string, op func(*counter.BigIncrementator) (counter.BigIncrementResult, error)) (counter.BigIncrementResult, error) {
+	IObj, err := i.BigCounters.Get(name)
+	if err != nil {
+		return counter.BigIncrementResult{}, err
+	}
+	r, err := op(IObj)
+	// неизменившееся состояние счетчика не требует сохранения
+	if err != nil || r.Previous.Cmp(r.Value) == 0 {
+		return r, err
+	}
+	return r, i.updateBigCounter(name, IObj, IObj.GetState())
+}
+
+// updateBigCounter вызов обработчика события изменения счетчика произвольной точности, если он установлен
+// Обработчик вызывается так же, как в методе updateCounter, только для зарегистрированного счетчика
+func (i *RPCIncrementator) updateBigCounter(name string, IObj *counter.BigIncrementator, s counter.BigState) error {
+	if i.OnUpdateBigCounter == nil {
+		return nil
+	}
+	i.deleteMtx.RLock()
+	defer i.deleteMtx.RUnlock()
+	if current, err := i.BigCounters.Get(name); err != nil || current != IObj {
+		return nil
+	}
+	return i.OnUpdateBigCounter(name, s)
+}
+
+// updateCounter вызов обработчика события изменения именованного счетчика, если он установлен
+// Обработчик вызывается, только если счетчик IObj все еще зарегистрирован под именем name,
+// а удаление счетчика ожидает завершения начатых сохранений, поэтому удаленный счетчик
+// не записывается в хранилище повторно
+func (i *RPCIncrementator) updateCounter(name string, IObj *counter.Incrementator, s counter.State) error {
+	if i.OnUpdateCounter == nil {
+		return nil
+	}
+	i.deleteMtx.RLock()
+	defer i.deleteMtx.RUnlock()
+	if current, err := i.Counters.Get(name); err != nil || current != IObj {
+		return nil
+	}
+	return i.OnUpdateCounter(name, s)
+}
@@ -0,0 +1,607 @@
+package server
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"net/http/httptest"
+	"net/rpc"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/sqlite"
+)
+
+var (
+	// объект RPC сервера с интеграцией с БД
+	i *RPCIncrementator
+	// хранилище состояния счетчиков в интеграционных тестах
+	st *sqlite.Store
+)
+
+const (
+	// путь HTTP обработчика тестового RPC сервера
+	RPCHTTPPath = "/testRPC"
+	// имя временной (для тестирования) БД
+	tempDBName string = "test.db"
+	// имя таблицы хранения состояния счетчика во временной (для тестирования) БД
+	tableName string = "incrementator"
+)
+
+// startServer запуск тестового RPC сервера с объектом inc на случайном порту
+// Сервер останавливается после завершения теста
+// Возвращает адрес и путь HTTP обработчика RPC запросов сервера
+func startServer(t *testing.T, inc *RPCIncrementator, rpcPath string) string {
+	srv, err := CreateServer(ServerConfig{Addr: "127.0.0.1:0", RPCPath: rpcPath}, inc)
+	if err != nil {
+		t.Fatalf("функция CreateServer вернула ошибку: %q", err.Error())
+	}
+	if err = srv.Start(); err != nil {
+		t.Fatalf("метод Start вернул ошибку: %q", err.Error())
+	}
+	t.Cleanup(func() {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			t.Errorf("метод Shutdown вернул ошибку: %q", err.Error())
+		}
+	})
+	return srv.Addr()
+}
+
+// dial подключение клиента к тестовому RPC серверу по адресу addr
+func dial(t *testing.T, addr string) *rpc.Client {
+	client, err := rpc.DialHTTP("tcp", addr)
+	if err != nil {
+		t.Fatal("ошибка создания клиента для RPC сервера: ", err)
+	}
+	return client
+}
+
+// Удаление временной БД после выполнения всех тестов
+func TestMain(m *testing.M) {
+	code := m.Run()
+	clean(tempDBName)
+	os.Exit(code)
+}
+
+// Сводный метод тестирования RPC сервера
+func TestRPC(t *testing.T) {
+	// Два независимых сервера в одном процессе
+	for _, addr := range []string{startServer(t, CreateRPCIncrementator(), ""), startServer(t, CreateRPCIncrementator(), "")} {
+		testBasicRPCClient(t, addr)
+		testRPCClient(t, addr)
+		testNamedCountersRPC(t, addr)
+		testBigCountersRPC(t, addr)
+	}
+	// Тестирование сервиса с интеграцией с БД
+	initRPCWithDBIntegration(t)
+	addr := startServer(t, i, "")
+	testBasicRPCClient(t, addr)
+	testRPCClient(t, addr)
+	testNamedCountersRPC(t, addr)
+	testBigCountersRPC(t, addr)
+	testNamedCountersPersistence(t)
+}
+
+// Тестирование обслуживания RPC запросов к именованным счетчикам
+func testNamedCountersRPC(t *testing.T, addr string) {
+	client := dial(t, addr)
+	defer client.Close()
+	var err error
+	var reply int64
+	var names []string
+	var step int64 = 3
+	var maxValue int64 = 5
+	// Создаем два счетчика с различными настройками
+	err = client.Call("RPCIncrementator.CreateCounter", &CounterRequest{Name: "first"}, &reply)
+	if err != nil {
+		t.Fatalf("CreateCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	err = client.Call("RPCIncrementator.CreateCounter", &CounterRequest{Name: "second", Settings: &counter.Settings{Step: &step}, Mode: counter.ModeAtomic}, &reply)
+	if err != nil {
+		t.Fatalf("CreateCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	err = client.Call("RPCIncrementator.CreateCounter", &CounterRequest{Name: "first"}, &reply)
+	if err == nil {
+		t.Fatal("CreateCounter не вернул ошибку при создании счетчика с занятым именем")
+	}
+	// Проверяем, что счетчики изменяются независимо друг от друга
+	client.Call("RPCIncrementator.IncrementCounter", "first", &reply)
+	client.Call("RPCIncrementator.IncrementCounter", "second", &reply)
+	client.Call("RPCIncrementator.IncrementCounter", "second", &reply)
+	client.Call("RPCIncrementator.GetCounter", "first", &reply)
+	if reply != 1 {
+		t.Fatalf("Неверное значение счетчика first, ожидалось: %d, получено: %d", 1, reply)
+	}
+	client.Call("RPCIncrementator.DecrementCounter", "second", &reply)
+	client.Call("RPCIncrementator.GetCounter", "second", &reply)
+	if reply != step {
+		t.Fatalf("Неверное значение счетчика second, ожидалось: %d, получено: %d", step, reply)
+	}
+	client.Call("RPCIncrementator.IncrementCounter", "second", &reply)
+	// Проверяем сброс счетчика после изменения его максимального значения
+	err = client.Call("RPCIncrementator.ConfigureCounter", &CounterRequest{Name: "second", Settings: &counter.Settings{MaxValue: &maxValue}}, &reply)
+	if err != nil {
+		t.Fatalf("ConfigureCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	client.Call("RPCIncrementator.GetCounter", "second", &reply)
+	if reply != counter.ResetValue {
+		t.Fatalf("Неверное значение счетчика second после изменения максимального значения, ожидалось: %d, получено: %d", counter.ResetValue, reply)
+	}
+	// Проверяем отклонение инкремента по политике OverflowReject
+	overflow := counter.OverflowReject
+	client.Call("RPCIncrementator.ConfigureCounter", &CounterRequest{Name: "second", Settings: &counter.Settings{Overflow: &overflow}}, &reply)
+	client.Call("RPCIncrementator.IncrementCounter", "second", &reply)
+	err = client.Call("RPCIncrementator.IncrementCounter", "second", &reply)
+	if err == nil {
+		t.Fatal("IncrementCounter не вернул ошибку при переполнении по политике OverflowReject")
+	}
+	err = client.Call("RPCIncrementator.ListCounters", 0, &names)
+	if err != nil {
+		t.Fatalf("ListCounters: метод возвратил ошибку: %q", err.Error())
+	}
+	if len(names) != 2 || names[0] != "first" || names[1] != "second" {
+		t.Fatalf("Неверный список счетчиков: %v", names)
+	}
+	// Проверяем пакетное изменение нескольких счетчиков за один вызов
+	var results []BatchResult
+	var result counter.IncrementResult
+	batch := []BatchIncrement{{Name: "first", Steps: 4}, {Name: "unknown", Steps: 1}, {Name: "second", Steps: 1}}
+	err = client.Call("RPCIncrementator.IncrementBatch", batch, &results)
+	if err != nil {
+		t.Fatalf("IncrementBatch: метод возвратил ошибку: %q", err.Error())
+	}
+	if len(results) != len(batch) {
+		t.Fatalf("IncrementBatch: неверное количество результатов, ожидалось: %d, получено: %d", len(batch), len(results))
+	}
+	if results[0].Error != "" || results[0].Previous != 1 || results[0].Value != 5 {
+		t.Fatalf("IncrementBatch: неверный результат изменения счетчика first: %+v", results[0])
+	}
+	if results[1].Error == "" {
+		t.Fatal("IncrementBatch: не возвращена ошибка изменения несуществующего счетчика")
+	}
+	if results[2].Error == "" {
+		t.Fatal("IncrementBatch: не возвращена ошибка переполнения счетчика second по политике OverflowReject")
+	}
+	// Проверяем условные операции над счетчиком
+	var swapped bool
+	err = client.Call("RPCIncrementator.CompareAndSwap", &CompareAndSwapRequest{Name: "first", OldValue: 4, NewValue: 2}, &swapped)
+	if err != nil || swapped {
+		t.Fatalf("CompareAndSwap: присваивание выполнено при несовпадающем значении, ошибка: %v", err)
+	}
+	err = client.Call("RPCIncrementator.CompareAndSwap", &CompareAndSwapRequest{Name: "first", OldValue: 5, NewValue: 2}, &swapped)
+	if err != nil || !swapped {
+		t.Fatalf("CompareAndSwap: присваивание не выполнено при совпадающем значении, ошибка: %v", err)
+	}
+	err = client.Call("RPCIncrementator.SetValue", &SetValueRequest{Name: "first", Value: 8}, &reply)
+	if err != nil || reply != 2 {
+		t.Fatalf("SetValue: неверное предыдущее значение счетчика %d, ошибка: %v", reply, err)
+	}
+	var ifResult IncrementIfResult
+	err = client.Call("RPCIncrementator.IncrementIf", &IncrementIfRequest{Name: "first", Limit: 8}, &ifResult)
+	if err != nil || ifResult.Applied || ifResult.Value != 8 {
+		t.Fatalf("IncrementIf: неверный результат при достигнутом пределе: %+v, ошибка: %v", ifResult, err)
+	}
+	err = client.Call("RPCIncrementator.IncrementIf", &IncrementIfRequest{Name: "first", Limit: 9}, &ifResult)
+	if err != nil || !ifResult.Applied || ifResult.Value != 9 {
+		t.Fatalf("IncrementIf: неверный результат при недостигнутом пределе: %+v, ошибка: %v", ifResult, err)
+	}
+	// Проверяем распределенный счетчик: границы диапазона не применяются, условные операции недоступны
+	err = client.Call("RPCIncrementator.CreateCounter", &CounterRequest{Name: "tally", Mode: counter.ModeStriped}, &reply)
+	if err != nil {
+		t.Fatalf("CreateCounter: метод возвратил ошибку при создании распределенного счетчика: %q", err.Error())
+	}
+	client.Call("RPCIncrementator.IncrementBy", &BatchIncrement{Name: "tally", Steps: counter.InitMaxValue + 1}, &result)
+	client.Call("RPCIncrementator.GetCounter", "tally", &reply)
+	if reply != counter.InitMaxValue+1 {
+		t.Fatalf("Неверное значение распределенного счетчика, ожидалось: %d, получено: %d", counter.InitMaxValue+1, reply)
+	}
+	err = client.Call("RPCIncrementator.CompareAndSwap", &CompareAndSwapRequest{Name: "tally", OldValue: reply, NewValue: 0}, &swapped)
+	if err == nil {
+		t.Fatal("CompareAndSwap не вернул ошибку для распределенного счетчика")
+	}
+	client.Call("RPCIncrementator.DeleteCounter", "tally", &reply)
+	// Счетчик second оставляем для проверки загрузки из хранилища
+	err = client.Call("RPCIncrementator.DeleteCounter", "first", &reply)
+	if err != nil {
+		t.Fatalf("DeleteCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	err = client.Call("RPCIncrementator.GetCounter", "first", &reply)
+	if err == nil {
+		t.Fatal("GetCounter не вернул ошибку при обращении к удаленному счетчику")
+	}
+}
+
+// Тестирование обслуживания RPC запросов к счетчикам произвольной точности
+func testBigCountersRPC(t *testing.T, addr string) {
+	client := dial(t, addr)
+	defer client.Close()
+	var err error
+	var st counter.BigState
+	var reply int
+	// шаг 2^40, умноженный на 2^30 шагов, не помещается в int64
+	step := new(big.Int).Lsh(big.NewInt(1), 40)
+	err = client.Call("RPCIncrementator.CreateBigCounter", &BigCounterRequest{Name: "bytes", Settings: &counter.BigSettings{Step: step}}, &st)
+	if err != nil {
+		t.Fatalf("CreateBigCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	if st.Value.Sign() != 0 || st.Step.Cmp(step) != 0 || st.MaxValue != nil {
+		t.Fatalf("CreateBigCounter: неверное состояние созданного счетчика: %+v", st)
+	}
+	var result counter.BigIncrementResult
+	err = client.Call("RPCIncrementator.IncrementBigCounter", &BigIncrement{Name: "bytes", Steps: 1 << 30}, &result)
+	expected := new(big.Int).Lsh(big.NewInt(1), 70)
+	if err != nil || result.Value.Cmp(expected) != 0 || result.Previous.Sign() != 0 || result.Wrapped {
+		t.Fatalf("IncrementBigCounter: неверный результат изменения счетчика: %+v, ошибка: %v", result, err)
+	}
+	err = client.Call("RPCIncrementator.DecrementBigCounter", &BigIncrement{Name: "bytes", Steps: 1 << 31}, &result)
+	if err == nil {
+		t.Fatal("DecrementBigCounter не вернул ошибку при уменьшении счетчика ниже минимального значения")
+	}
+	maxValue := new(big.Int).Lsh(big.NewInt(1), 60)
+	err = client.Call("RPCIncrementator.ConfigureBigCounter", &BigCounterRequest{Name: "bytes", Settings: &counter.BigSettings{MaxValue: maxValue}}, &reply)
+	if err == nil || !strings.Contains(err.Error(), "MaxValue:") {
+		t.Fatalf("ConfigureBigCounter не отклонил границу, исключающую значение счетчика по политике OverflowReject: %v", err)
+	}
+	client.Call("RPCIncrementator.GetBigState", "bytes", &st)
+	if st.Value.Cmp(expected) != 0 || st.MaxValue != nil || st.Version != 2 {
+		t.Fatalf("GetBigState: неверное состояние счетчика: %+v", st)
+	}
+	var names []string
+	client.Call("RPCIncrementator.ListBigCounters", 0, &names)
+	if len(names) != 1 || names[0] != "bytes" {
+		t.Fatalf("ListBigCounters: неверный список счетчиков: %v", names)
+	}
+	// Счетчик bytes оставляем для проверки загрузки из хранилища
+	client.Call("RPCIncrementator.CreateBigCounter", &BigCounterRequest{Name: "temp"}, &st)
+	err = client.Call("RPCIncrementator.DeleteBigCounter", "temp", &reply)
+	if err != nil {
+		t.Fatalf("DeleteBigCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	if err = client.Call("RPCIncrementator.GetBigState", "temp", &st); err == nil {
+		t.Fatal("GetBigState не вернул ошибку при обращении к удаленному счетчику")
+	}
+}
+
+// Тестирование загрузки именованных счетчиков из хранилища
+func testNamedCountersPersistence(t *testing.T) {
+	st, err := sqlite.Open(tempDBName, tableName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	loaded, err := CreatePersistentRPCIncrementator(st)
+	if err != nil {
+		t.Fatalf("функция CreatePersistentRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	names := loaded.Counters.List()
+	if len(names) != 1 || names[0] != "second" {
+		t.Fatalf("Неверный список загруженных из хранилища счетчиков: %v", names)
+	}
+	IObj, _ := loaded.Counters.Get("second")
+	if IObj.Mode() != counter.ModeAtomic {
+		t.Fatalf("Неверный режим синхронизации загруженного из хранилища счетчика: %s", IObj.Mode())
+	}
+	state := IObj.GetState()
+	if state.Step != 3 || state.MaxValue != 5 || state.MinValue != 0 || state.Value != 4 || state.Overflow != counter.OverflowReject {
+		t.Fatalf("Неверное состояние загруженного из хранилища счетчика: %+v", state)
+	}
+	if state.Modified.IsZero() || state.Version == 0 {
+		t.Fatalf("Не загружены время последнего изменения и версия состояния счетчика: %+v", state)
+	}
+	bytes, err := loaded.BigCounters.Get("bytes")
+	if err != nil {
+		t.Fatalf("Счетчик произвольной точности не загружен из хранилища: %v", err)
+	}
+	bigState := bytes.GetState()
+	if bigState.Value.Cmp(new(big.Int).Lsh(big.NewInt(1), 70)) != 0 || bigState.MaxValue != nil || bigState.MinValue.Sign() != 0 || bigState.Version != 2 {
+		t.Fatalf("Неверное состояние загруженного из хранилища счетчика произвольной точности: %+v", bigState)
+	}
+}
+
+// Тестирование удаления именованного счетчика во время его сохранения:
+// удаление ожидает завершения сохранения, и удаленный счетчик не записывается в хранилище повторно
+func TestDeleteCounterDuringSave(t *testing.T) {
+	i := CreateRPCIncrementator()
+	err := i.CreateCounter(&CounterRequest{Name: "slow"}, new(int64))
+	if err != nil {
+		t.Fatalf("CreateCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	var mtx sync.Mutex
+	stored := map[string]int64{"slow": 0}
+	started, release := make(chan struct{}), make(chan struct{})
+	i.OnUpdateCounter = func(name string, s counter.State) error {
+		close(started)
+		<-release
+		mtx.Lock()
+		defer mtx.Unlock()
+		stored[name] = s.Value
+		return nil
+	}
+	i.OnDeleteCounter = func(name string) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		delete(stored, name)
+		return nil
+	}
+	incremented, deleted := make(chan error), make(chan error)
+	go func() {
+		incremented <- i.IncrementCounter("slow", new(int64))
+	}()
+	<-started
+	go func() {
+		deleted <- i.DeleteCounter("slow", new(int))
+	}()
+	select {
+	case <-deleted:
+		t.Fatal("DeleteCounter завершился до завершения сохранения счетчика")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err = <-incremented; err != nil {
+		t.Fatalf("IncrementCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	if err = <-deleted; err != nil {
+		t.Fatalf("DeleteCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	if _, ok := stored["slow"]; ok {
+		t.Fatal("Удаленный счетчик записан в хранилище повторно")
+	}
+}
+
+// Тестирование общего обслуживания RPC запросов
+func testBasicRPCClient(t *testing.T, addr string) {
+	client := dial(t, addr)
+	defer client.Close()
+	var err error
+	var reply int64
+	var s = new(counter.Settings)
+	var step int64 = counter.InitValue
+	var maxValue int64 = counter.InitMaxValue
+	s.Step = &step
+	s.MaxValue = &maxValue
+	// Проверяем метод инкрементации на успешный исход работы
+	err = client.Call("RPCIncrementator.IncrementNumber", 0, nil)
+	if err != nil {
+		t.Fatalf("IncrementNumber: метод возвратил ошибку: %q", err.Error())
+	}
+	// Проверяем метод получения значения счетчика на успешный исход работы
+	err = client.Call("RPCIncrementator.GetNumber", 0, &reply)
+	if err != nil {
+		t.Fatalf("GetNumber: метод возвратил ошибку: %q", err.Error())
+	}
+	// Проверяем метод установки новых параметровсчетчика на успешный исход работы
+	err = client.Call("RPCIncrementator.SetSettings", s, nil)
+	if err != nil {
+		t.Fatalf("SetSettings: метод возвратил ошибку: %q", err.Error())
+	}
+	// Проверяем как отреагируемт сервис на вызов несуществующего метода в нашем RPC сервисе
+	err = client.Call("RPCIncrementator.NoMethod", 0, &reply)
+	if err == nil {
+		t.Error("NoMethod: ожидаемая ошибка")
+	} else if !strings.HasPrefix(err.Error(), "rpc: can't find method ") {
+		t.Errorf("NoMethod: ожидалось получение ошибки вызова несуществующего метода; получена ошибка: %q", err)
+	}
+}
+
+// Расширенное тестирование обслуживания RPC запросов
+func testRPCClient(t *testing.T, addr string) {
+	// Создаем клиента RPC сервиса
+	client := dial(t, addr)
+	defer client.Close()
+	var err error
+	var reply int64
+	var step int64 = 2
+	var maxValue int64
+	var expectedCounterValue int64 = 5
+	var startCounterValue int64
+	var s = new(counter.Settings)
+	s.Step = &step
+	// Проверяем изменение счетчика при шаге инкрементации и максимальном значении по умолчанию
+	// Сначала получаем текущее значение счетчика
+	client.Call("RPCIncrementator.GetNumber", 0, &startCounterValue)
+	for i := int64(0); i < expectedCounterValue; i++ {
+		client.Call("RPCIncrementator.IncrementNumber", 0, nil)
+	}
+	client.Call("RPCIncrementator.GetNumber", 0, &reply)
+	// Находим значение счетчика, которое ожидаем получить, исходя из начального его значения
+	expectedCounterValue += startCounterValue
+	if reply != expectedCounterValue {
+		t.Fatalf("Неверное значение счетчика, ожидалось: %d, получено: %d", expectedCounterValue, reply)
+	}
+	// Проверяем изменение счетчика при изменении шага инкрементации
+	startCounterValue = reply
+	client.Call("RPCIncrementator.SetSettings", s, nil)
+	client.Call("RPCIncrementator.IncrementNumber", 0, nil)
+	client.Call("RPCIncrementator.GetNumber", 0, &reply)
+	expectedCounterValue = startCounterValue + *s.Step
+	if reply != expectedCounterValue {
+		t.Fatalf("Неверное значение счетчика после изменения шага инкрементации, ожидалось: %d, получено: %d", expectedCounterValue, reply)
+	}
+	// Проверяем сброс счетчика в 1 при превышении максимального значения
+	maxValue = expectedCounterValue
+	expectedCounterValue = 1
+	s.MaxValue = &maxValue
+	client.Call("RPCIncrementator.SetSettings", s, nil)
+	client.Call("RPCIncrementator.IncrementNumber", 0, nil)
+	client.Call("RPCIncrementator.GetNumber", 0, &reply)
+	if reply != expectedCounterValue {
+		t.Fatalf("Неверное значение счетчика после изменения максимального значения, ожидалось: %d, получено: %d", expectedCounterValue, reply)
+	}
+	// Проверяем получение значений счетчика до и после изменения
+	var result counter.IncrementResult
+	err = client.Call("RPCIncrementator.IncrementAndGet", "", &result)
+	if err != nil {
+		t.Fatalf("IncrementAndGet: метод возвратил ошибку: %q", err.Error())
+	}
+	if result.Previous != 1 || result.Value != 1+step || result.Wrapped {
+		t.Fatalf("IncrementAndGet: неверный результат изменения счетчика: %+v", result)
+	}
+	client.Call("RPCIncrementator.DecrementNumber", 0, &reply)
+	if reply != 1 {
+		t.Fatalf("DecrementNumber: неверное значение счетчика после изменения, ожидалось: %d, получено: %d", 1, reply)
+	}
+	err = client.Call("RPCIncrementator.DecrementAndGet", "", &result)
+	if err != nil {
+		t.Fatalf("DecrementAndGet: метод возвратил ошибку: %q", err.Error())
+	}
+	if result.Previous != 1 || result.Value != maxValue || !result.Wrapped {
+		t.Fatalf("DecrementAndGet: неверный результат изменения счетчика: %+v", result)
+	}
+	// Проверяем получение состояния счетчика вместе с настройками
+	var st counter.State
+	err = client.Call("RPCIncrementator.GetState", "", &st)
+	if err != nil {
+		t.Fatalf("GetState: метод возвратил ошибку: %q", err.Error())
+	}
+	if st.Value != maxValue || st.Step != step || st.MaxValue != maxValue || st.Overflow != counter.OverflowWrap || st.Wraps == 0 || st.Modified.IsZero() {
+		t.Fatalf("GetState: неверное состояние счетчика: %+v", st)
+	}
+	client.Call("RPCIncrementator.IncrementNumber", 0, &reply)
+	if reply != 1 {
+		t.Fatalf("IncrementNumber: неверное значение счетчика после изменения, ожидалось: %d, получено: %d", 1, reply)
+	}
+	// Проверяем уменьшение счетчика и переход через минимальное значение
+	client.Call("RPCIncrementator.DecrementNumber", 0, nil)
+	client.Call("RPCIncrementator.GetNumber", 0, &reply)
+	if reply != maxValue {
+		t.Fatalf("Неверное значение счетчика после перехода через минимальное значение, ожидалось: %d, получено: %d", maxValue, reply)
+	}
+	// Проверяем обработку запроса на установку шага
+	// инкрементации с неверным его значеним (отрицательным)
+	step = -3
+	err = client.Call("RPCIncrementator.SetSettings", s, nil)
+	if err == nil {
+		t.Fatal("SetSettings не вернул ошибку, при установке отрицательного шага инкрементации")
+	}
+	// Проверяем обработку запроса на установку максимального значения счетчика
+	// с неверным его значеним (отрицательным)
+	step = 2
+	maxValue = -2
+	err = client.Call("RPCIncrementator.SetSettings", s, nil)
+	if err == nil {
+		t.Fatal("SetSettings не вернул ошибку, при установке отрицательного максимального значения")
+	}
+	// Проверяем, что недопустимые настройки не применяются частично,
+	// а ошибка перечисляет все недопустимые поля
+	var before, after counter.State
+	client.Call("RPCIncrementator.GetState", "", &before)
+	step = -3
+	resetValue := int64(100)
+	s.ResetValue = &resetValue
+	err = client.Call("RPCIncrementator.SetSettings", s, nil)
+	if err == nil || !strings.Contains(err.Error(), "Step:") || !strings.Contains(err.Error(), "MaxValue:") {
+		t.Fatalf("SetSettings не перечислил все недопустимые поля настроек: %v", err)
+	}
+	client.Call("RPCIncrementator.GetState", "", &after)
+	if after.Version != before.Version || after.Step != before.Step || after.MaxValue != before.MaxValue || after.ResetValue != before.ResetValue {
+		t.Fatalf("SetSettings частично применил недопустимые настройки.\nДо: %+v\nПосле: %+v", before, after)
+	}
+}
+
+// Тестирование HTTP обработчиков
+func TestHTTP(t *testing.T) {
+	// Обработчик по нестандартному пути
+	testHTTPRPC(t, startServer(t, CreateRPCIncrementator(), RPCHTTPPath), RPCHTTPPath)
+	// Обработчик, встроенный в HTTP сервер приложения
+	srv, err := CreateServer(ServerConfig{RPCPath: RPCHTTPPath}, CreateRPCIncrementator())
+	if err != nil {
+		t.Fatalf("функция CreateServer вернула ошибку: %q", err.Error())
+	}
+	httpServer := httptest.NewServer(srv.Handler())
+	defer httpServer.Close()
+	defer srv.Shutdown(context.Background())
+	testHTTPRPC(t, httpServer.Listener.Addr().String(), RPCHTTPPath)
+}
+
+func testHTTPRPC(t *testing.T, addr, path string) {
+	client, err := rpc.DialHTTPPath("tcp", addr, path)
+	if err != nil {
+		t.Fatal("ошибка создания клиента для RPC сервера", err)
+	}
+	defer client.Close()
+	var reply int64
+	err = client.Call("RPCIncrementator.IncrementNumber", 0, &reply)
+	if err != nil {
+		t.Fatalf("IncrementNumber: метод возвратил ошибку: %q", err.Error())
+	}
+}
+
+// Метод подключения к БД и инициализации RPC объекта с интеграцией с БД
+func initRPCWithDBIntegration(t *testing.T) {
+	var err error
+	st, err = sqlite.Open(tempDBName, tableName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err = CreatePersistentRPCIncrementator(st)
+	if err != nil {
+		t.Fatalf("функция CreatePersistentRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	if i == nil {
+		t.Fatal("функция CreatePersistentRPCIncrementator вернула нулевой указатель объекта RPCIncrementor")
+	}
+	if i.IObj == nil {
+		t.Fatal("функция CreatePersistentRPCIncrementator вернула нулевой указатель объекта Incrementor")
+	}
+	if i.OnUpdate == nil {
+		t.Fatal("функция CreatePersistentRPCIncrementator вернула нулевой указатель на обработчик события обновления счетчика")
+	}
+}
+
+// Очитска файловой системы и освобождение ресурсов после тестирования
+func clean(files ...string) {
+	for _, file := range files {
+		err := os.Remove(file)
+		if err != nil {
+			log.Printf("ошибка при очистке: %q", err.Error())
+		}
+	}
+}
+
+// Тестирование сохранения изменений счетчиков в хранилище в памяти
+func TestPersistentMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	st := storage.CreateMemoryStore()
+	c := counter.DefaultConfig()
+	c.Value = 10
+	inc, err := CreatePersistentRPCIncrementatorFromConfig(st, c)
+	if err != nil {
+		t.Fatalf("функция CreatePersistentRPCIncrementatorFromConfig вернула ошибку: %q", err.Error())
+	}
+	// отсутствующий в хранилище счетчик по умолчанию сохраняется при создании
+	if s, err := st.Load(ctx, ""); err != nil || s.Value != 10 {
+		t.Fatalf("Счетчик по умолчанию не сохранен в хранилище: %+v, ошибка: %v", s, err)
+	}
+	var reply int64
+	if err = inc.IncrementNumber(0, &reply); err != nil {
+		t.Fatalf("IncrementNumber: метод возвратил ошибку: %q", err.Error())
+	}
+	if err = inc.CreateCounter(&CounterRequest{Name: "requests"}, &reply); err != nil {
+		t.Fatalf("CreateCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	loaded, err := CreatePersistentRPCIncrementator(st)
+	if err != nil {
+		t.Fatalf("функция CreatePersistentRPCIncrementator вернула ошибку: %q", err.Error())
+	}
+	if value := loaded.IObj.GetNumber(); value != 11 {
+		t.Fatalf("Неверное значение загруженного счетчика, ожидалось: %d, получено: %d", 11, value)
+	}
+	if names := loaded.Counters.List(); len(names) != 1 || names[0] != "requests" {
+		t.Fatalf("Неверный список загруженных из хранилища счетчиков: %v", names)
+	}
+	if err = loaded.DeleteCounter("requests", new(int)); err != nil {
+		t.Fatalf("DeleteCounter: метод возвратил ошибку: %q", err.Error())
+	}
+	if _, err = st.Load(ctx, "requests"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Счетчик не удален из хранилища: %v", err)
+	}
+}
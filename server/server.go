@@ -0,0 +1,338 @@
+package server
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/rpc"
+	"sync"
+)
+
+// DefaultAddr адрес прослушивания RPC сервера по умолчанию
+const DefaultAddr = ":8080"
+
+// ErrServerStarted ошибка повторного запуска RPC сервера
+var ErrServerStarted = errors.New("RPC сервер уже запущен")
+
+// ErrServerClosed ошибка запуска остановленного RPC сервера
+var ErrServerClosed = errors.New("RPC сервер остановлен")
+
+// errDraining ошибка чтения запроса, поступившего после начала остановки сервера
+// RPC сервер закрывает подключение, не выполняя запрос, и клиент получает rpc.ErrShutdown
+var errDraining = errors.New("RPC сервер останавливается")
+
+// ServerConfig настройки RPC сервера
+type ServerConfig struct {
+	Addr    string // адрес прослушивания, по умолчанию DefaultAddr; порт 0 соответствует случайному свободному порту
+	RPCPath string // путь HTTP обработчика RPC запросов, по умолчанию rpc.DefaultRPCPath
+	// Reload функция повторного чтения настроек сервиса, вызываемая RPC методом Admin.Reload;
+	// если не задана, административные RPC методы недоступны
+	Reload Reloader
+}
+
+// connected ответ на HTTP запрос CONNECT, ожидаемый клиентом пакета net/rpc
+const connected = "200 Connected to Go RPC"
+
+// Server RPC сервер счетчиков, обслуживающий запросы по протоколу HTTP
+// В отличие от rpc.Register и rpc.HandleHTTP сервер использует собственные
+// rpc.Server и http.ServeMux, поэтому в одном процессе может работать несколько
+// независимых серверов, а сервер можно встроить в другое приложение
+// Клиенты подключаются функцией rpc.DialHTTPPath с путем RPCPath
+type Server struct {
+	addr     string                // адрес прослушивания
+	rpcPath  string                // путь HTTP обработчика RPC запросов
+	rpc      *rpc.Server           // RPC сервер с зарегистрированным объектом RPCIncrementator
+	mux      *http.ServeMux        // обработчики HTTP запросов сервера
+	http     *http.Server          // HTTP сервер, созданный при запуске
+	listener net.Listener          // прослушиваемый адрес, созданный при запуске
+	served   chan error            // результат обслуживания подключений после остановки
+	mtx      sync.Mutex            // мьютекс для блокировки одновременного изменения состояния сервера
+	conns    map[net.Conn]struct{} // подключения, переданные RPC серверу
+	wg       sync.WaitGroup        // обслуживаемые RPC сервером подключения
+	calls    sync.WaitGroup        // выполняемые RPC вызовы
+	closed   bool                  // признак остановки сервера
+}
+
+// CreateServer функция создает новый RPC сервер с настройками c,
+// регистрирует в нем объект inc и возвращает указатель на сервер.
+func CreateServer(c ServerConfig, inc *RPCIncrementator) (*Server, error) {
+	if c.Addr == "" {
+		c.Addr = DefaultAddr
+	}
+	if c.RPCPath == "" {
+		c.RPCPath = rpc.DefaultRPCPath
+	}
+	s := &Server{
+		addr:    c.Addr,
+		rpcPath: c.RPCPath,
+		rpc:     rpc.NewServer(),
+		mux:     http.NewServeMux(),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	err := s.rpc.Register(inc)
+	if err != nil {
+		return nil, err
+	}
+	if c.Reload != nil {
+		err = s.rpc.Register(&Admin{reload: c.Reload})
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.mux.HandleFunc(s.rpcPath, s.serveRPC)
+	return s, nil
+}
+
+// Handler метод возвращает обработчик HTTP запросов сервера для встраивания
+// в HTTP сервер приложения
+// Подключения, обслуживаемые через этот обработчик, закрываются методом Shutdown
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Addr метод возвращает прослушиваемый адрес запущенного сервера,
+// а до запуска - адрес, переданный при создании
+func (s *Server) Addr() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.addr
+}
+
+// Start метод начинает прослушивание адреса сервера и обслуживание подключений
+// Возвращает управление сразу после начала прослушивания
+// В случае, если адрес занят или сервер уже запускался, - возвращает ошибку
+func (s *Server) Start() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return ErrServerClosed
+	}
+	if s.listener != nil {
+		return ErrServerStarted
+	}
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	s.http = &http.Server{Handler: s.mux}
+	s.served = make(chan error, 1)
+	go func() {
+		err := s.http.Serve(l)
+		if err == http.ErrServerClosed {
+			err = nil
+		}
+		s.served <- err
+	}()
+	return nil
+}
+
+// Wait метод ожидает остановки запущенного сервера и возвращает ошибку обслуживания подключений,
+// если сервер остановлен не методом Shutdown
+func (s *Server) Wait() error {
+	s.mtx.Lock()
+	served := s.served
+	s.mtx.Unlock()
+	if served == nil {
+		return nil
+	}
+	err := <-served
+	// результат возвращается и другим ожидающим горутинам
+	served <- err
+	return err
+}
+
+// Shutdown метод останавливает сервер: прекращает прослушивание адреса и прием новых
+// RPC вызовов, ожидает завершения уже выполняемых вызовов и отправки ответов на них,
+// после чего закрывает подключения RPC клиентов и ожидает завершения их обслуживания
+// Вызовы, поступившие после начала остановки, не выполняются, а подключение, по которому
+// они поступили, закрывается, поэтому клиент получает ошибку rpc.ErrShutdown
+// В случае, если контекст ctx завершился раньше, подключения закрываются без ожидания
+// выполняемых вызовов, а метод возвращает ошибку контекста
+// Повторный вызов метода только ожидает завершения обслуживания подключений
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mtx.Lock()
+	s.closed = true
+	httpServer := s.http
+	s.mtx.Unlock()
+	var err error
+	if httpServer != nil {
+		err = httpServer.Shutdown(ctx)
+	}
+	if err == nil {
+		err = wait(ctx, &s.calls)
+	}
+	s.mtx.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+	return wait(ctx, &s.wg)
+}
+
+// wait ожидание обнуления счетчика wg или завершения контекста ctx
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serveRPC обработчик HTTP запроса CONNECT, передающий подключение RPC серверу
+// Повторяет rpc.Server.ServeHTTP, но учитывает подключение, чтобы закрыть его при остановке сервера
+func (s *Server) serveRPC(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodConnect {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, "405 must CONNECT\n")
+		return
+	}
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		log.Print("rpc hijacking ", req.RemoteAddr, ": ", err.Error())
+		return
+	}
+	if !s.track(conn) {
+		conn.Close()
+		return
+	}
+	defer s.untrack(conn)
+	io.WriteString(conn, "HTTP/1.0 "+connected+"\n\n")
+	s.rpc.ServeCodec(&callCodec{ServerCodec: newGobServerCodec(conn), server: s})
+}
+
+// track учет подключения, обслуживаемого RPC сервером
+// Возвращает false, если сервер остановлен
+func (s *Server) track(conn net.Conn) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+// untrack завершение учета подключения после окончания его обслуживания
+func (s *Server) untrack(conn net.Conn) {
+	s.mtx.Lock()
+	delete(s.conns, conn)
+	s.mtx.Unlock()
+	s.wg.Done()
+}
+
+// beginCall учет RPC вызова, заголовок которого прочитан из подключения
+// Возвращает false, если сервер останавливается и новые вызовы не принимаются
+func (s *Server) beginCall() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return false
+	}
+	s.calls.Add(1)
+	return true
+}
+
+// callCodec кодек RPC сервера, учитывающий выполняемые вызовы
+// Каждый прочитанный заголовок запроса net/rpc сопровождает ровно одним ответом,
+// в том числе при ошибке, поэтому вызов считается выполняемым от чтения заголовка до записи ответа
+type callCodec struct {
+	rpc.ServerCodec
+	server *Server // сервер, обслуживающий подключение
+}
+
+// ReadRequestHeader метод читает заголовок запроса и учитывает начатый вызов
+func (c *callCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := c.ServerCodec.ReadRequestHeader(r)
+	if err != nil {
+		return err
+	}
+	if !c.server.beginCall() {
+		return errDraining
+	}
+	return nil
+}
+
+// WriteResponse метод записывает ответ и завершает учет вызова
+func (c *callCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	defer c.server.calls.Done()
+	return c.ServerCodec.WriteResponse(r, body)
+}
+
+// gobServerCodec кодек RPC сервера в формате gob, совпадающий с кодеком пакета net/rpc,
+// который недоступен для использования вне пакета
+type gobServerCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	closed bool
+}
+
+// newGobServerCodec создание кодека RPC сервера для подключения conn
+func newGobServerCodec(conn io.ReadWriteCloser) *gobServerCodec {
+	buf := bufio.NewWriter(conn)
+	return &gobServerCodec{rwc: conn, dec: gob.NewDecoder(conn), enc: gob.NewEncoder(buf), encBuf: buf}
+}
+
+// ReadRequestHeader метод читает заголовок запроса
+func (c *gobServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	return c.dec.Decode(r)
+}
+
+// ReadRequestBody метод читает аргумент запроса
+func (c *gobServerCodec) ReadRequestBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+// WriteResponse метод записывает заголовок и тело ответа
+// При ошибке кодирования подключение закрывается, так как поток gob становится несогласованным
+func (c *gobServerCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
+	if err = c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			log.Println("rpc: gob error encoding response:", err)
+			c.Close()
+		}
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			log.Println("rpc: gob error encoding body:", err)
+			c.Close()
+		}
+		return
+	}
+	return c.encBuf.Flush()
+}
+
+// Close метод закрывает подключение
+func (c *gobServerCodec) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
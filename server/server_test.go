@@ -0,0 +1,183 @@
+package server
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"net/http"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+)
+
+// Тестирование запуска и остановки RPC сервера
+func TestServerLifecycle(t *testing.T) {
+	srv, err := CreateServer(ServerConfig{Addr: "127.0.0.1:0"}, CreateRPCIncrementator())
+	if err != nil {
+		t.Fatalf("функция CreateServer вернула ошибку: %q", err.Error())
+	}
+	if err = srv.Start(); err != nil {
+		t.Fatalf("метод Start вернул ошибку: %q", err.Error())
+	}
+	if err = srv.Start(); err != ErrServerStarted {
+		t.Fatalf("метод Start не вернул ошибку при повторном запуске, получено: %v", err)
+	}
+	client := dial(t, srv.Addr())
+	defer client.Close()
+	var reply int64
+	if err = client.Call("RPCIncrementator.IncrementNumber", 0, &reply); err != nil {
+		t.Fatalf("IncrementNumber: метод возвратил ошибку: %q", err.Error())
+	}
+	// запрос без метода CONNECT отклоняется
+	resp, err := http.Get("http://" + srv.Addr() + "/_goRPC_")
+	if err != nil {
+		t.Fatalf("Ошибка HTTP запроса к серверу: %q", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("Неверный код ответа на запрос без метода CONNECT: %d", resp.StatusCode)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = srv.Shutdown(ctx); err != nil {
+		t.Fatalf("метод Shutdown вернул ошибку: %q", err.Error())
+	}
+	if err = srv.Wait(); err != nil {
+		t.Fatalf("метод Wait вернул ошибку после остановки сервера: %q", err.Error())
+	}
+	// подключения клиентов закрываются при остановке сервера
+	if err = client.Call("RPCIncrementator.IncrementNumber", 0, &reply); err == nil {
+		t.Fatal("Вызов RPC метода выполнен после остановки сервера")
+	}
+	if err = srv.Start(); err != ErrServerClosed {
+		t.Fatalf("метод Start не вернул ошибку при запуске остановленного сервера, получено: %v", err)
+	}
+	if err = srv.Shutdown(ctx); err != nil {
+		t.Fatalf("повторный вызов метода Shutdown вернул ошибку: %q", err.Error())
+	}
+}
+
+// Тестирование завершения выполняемых RPC вызовов при остановке сервера
+func TestServerDrain(t *testing.T) {
+	inc := CreateRPCIncrementator()
+	started, release := make(chan struct{}), make(chan struct{})
+	// обработчик события изменения задерживает выполнение вызова
+	inc.OnUpdate = func(s counter.State) error {
+		close(started)
+		<-release
+		return nil
+	}
+	srv, err := CreateServer(ServerConfig{Addr: "127.0.0.1:0"}, inc)
+	if err != nil {
+		t.Fatalf("функция CreateServer вернула ошибку: %q", err.Error())
+	}
+	if err = srv.Start(); err != nil {
+		t.Fatalf("метод Start вернул ошибку: %q", err.Error())
+	}
+	client, idle := dial(t, srv.Addr()), dial(t, srv.Addr())
+	defer client.Close()
+	defer idle.Close()
+	var reply int64
+	call := client.Go("RPCIncrementator.IncrementNumber", 0, &reply, nil)
+	<-started
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Shutdown(context.Background())
+	}()
+	// вызов, поступивший после начала остановки, не выполняется, а подключение закрывается
+	for !stopping(srv) {
+		time.Sleep(time.Millisecond)
+	}
+	if err = idle.Call("RPCIncrementator.DecrementNumber", 0, new(int64)); err == nil {
+		t.Fatal("Вызов, поступивший после начала остановки сервера, не отклонен")
+	}
+	if err = idle.Call("RPCIncrementator.DecrementNumber", 0, new(int64)); err != rpc.ErrShutdown {
+		t.Fatalf("Подключение не закрыто после отклонения вызова, получено: %v", err)
+	}
+	select {
+	case err = <-stopped:
+		t.Fatalf("метод Shutdown завершился до окончания выполняемого вызова: %v", err)
+	default:
+	}
+	close(release)
+	if err = (<-call.Done).Error; err != nil || reply != 1 {
+		t.Fatalf("Выполняемый вызов не завершен при остановке сервера: ошибка %v, значение %d", err, reply)
+	}
+	if err = <-stopped; err != nil {
+		t.Fatalf("метод Shutdown вернул ошибку: %q", err.Error())
+	}
+	if counter := inc.IObj.GetNumber(); counter != 1 {
+		t.Fatalf("Неверное значение счетчика после остановки сервера, ожидалось: %d, получено: %d", 1, counter)
+	}
+}
+
+// stopping признак начала остановки сервера srv
+func stopping(srv *Server) bool {
+	srv.mtx.Lock()
+	defer srv.mtx.Unlock()
+	return srv.closed
+}
+
+// Тестирование остановки сервера по истечении времени ожидания выполняемых вызовов
+func TestServerShutdownTimeout(t *testing.T) {
+	inc := CreateRPCIncrementator()
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	inc.OnUpdate = func(s counter.State) error {
+		close(started)
+		<-release
+		return nil
+	}
+	srv, _ := CreateServer(ServerConfig{Addr: "127.0.0.1:0"}, inc)
+	srv.Start()
+	client := dial(t, srv.Addr())
+	defer client.Close()
+	call := client.Go("RPCIncrementator.IncrementNumber", 0, new(int64), nil)
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("метод Shutdown не вернул ошибку истечения времени ожидания, получено: %v", err)
+	}
+	// подключение закрыто без ожидания вызова
+	if err := (<-call.Done).Error; err == nil {
+		t.Fatal("Вызов завершен успешно, хотя подключение закрыто по истечении времени ожидания")
+	}
+}
+
+// Тестирование административного RPC метода повторного чтения настроек
+func TestServerReload(t *testing.T) {
+	calls := 0
+	reload := func() (ReloadResult, error) {
+		calls++
+		return ReloadResult{Applied: []string{"log_file"}, RestartRequired: []string{"addr"}}, nil
+	}
+	srv, err := CreateServer(ServerConfig{Addr: "127.0.0.1:0", Reload: reload}, CreateRPCIncrementator())
+	if err != nil {
+		t.Fatalf("функция CreateServer вернула ошибку: %q", err.Error())
+	}
+	if err = srv.Start(); err != nil {
+		t.Fatalf("метод Start вернул ошибку: %q", err.Error())
+	}
+	defer srv.Shutdown(context.Background())
+	client := dial(t, srv.Addr())
+	defer client.Close()
+	var result ReloadResult
+	if err = client.Call("Admin.Reload", 0, &result); err != nil {
+		t.Fatalf("Admin.Reload: метод возвратил ошибку: %q", err.Error())
+	}
+	if calls != 1 || len(result.Applied) != 1 || result.Applied[0] != "log_file" || len(result.RestartRequired) != 1 || result.RestartRequired[0] != "addr" {
+		t.Fatalf("Неверный результат повторного чтения настроек: %+v, вызовов: %d", result, calls)
+	}
+	// без функции повторного чтения настроек административные методы недоступны
+	addr := startServer(t, CreateRPCIncrementator(), "")
+	other := dial(t, addr)
+	defer other.Close()
+	if err = other.Call("Admin.Reload", 0, &result); err == nil {
+		t.Fatal("Административный метод доступен без функции повторного чтения настроек")
+	}
+}
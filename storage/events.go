@@ -0,0 +1,78 @@
+package storage
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+)
+
+// EventKind вид события изменения счетчика
+type EventKind int
+
+// Виды событий изменения счетчика
+const (
+	EventCreate    EventKind = iota + 1 // создание счетчика с состоянием State
+	EventAdd                            // изменение счетчика на Steps шагов, отрицательное значение - уменьшение
+	EventSetValue                       // присваивание счетчику значения Value
+	EventConfigure                      // изменение настроек счетчика на Settings
+	EventDelete                         // удаление счетчика
+)
+
+// String метод возвращает имя вида события
+func (k EventKind) String() string {
+	switch k {
+	case EventCreate:
+		return "create"
+	case EventAdd:
+		return "add"
+	case EventSetValue:
+		return "set_value"
+	case EventConfigure:
+		return "configure"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event событие изменения счетчика типа Incrementator
+// Состояние счетчика определяется последовательным применением его событий в порядке номеров
+type Event struct {
+	Seq      uint64            // номер события, присваивается журналом при добавлении
+	Name     string            // имя счетчика, пустое имя соответствует счетчику по умолчанию
+	Time     time.Time         // время события
+	Kind     EventKind         // вид события
+	Steps    int64             // количество шагов изменения для EventAdd
+	Value    int64             // присваиваемое значение для EventSetValue
+	Settings *counter.Settings // новые настройки для EventConfigure
+	State    counter.State     // исходное состояние для EventCreate
+}
+
+// Snapshot снимок состояния счетчиков после применения событий журнала с номерами не больше Seq
+// Снимок всегда содержит состояние счетчика по умолчанию
+type Snapshot struct {
+	Seq      uint64                   // номер последнего учтенного события
+	Counters map[string]counter.State // состояние счетчиков, включая счетчик по умолчанию с пустым именем
+}
+
+// EventLog журнал событий изменения счетчиков типа Incrementator, который только дополняется новыми событиями,
+// и снимок состояния счетчиков, ограничивающий количество событий, применяемых при восстановлении
+// Вызов методов потокобезопасен
+type EventLog interface {
+	// AppendEvent добавляет событие в журнал и возвращает присвоенный ему номер
+	// Номера возрастают в порядке добавления, поле Seq события не используется
+	AppendEvent(ctx context.Context, e Event) (uint64, error)
+	// Events вызывает fn для каждого события с номером больше after в порядке номеров
+	// Возвращает первую ошибку fn, прекращая перебор
+	Events(ctx context.Context, after uint64, fn func(e Event) error) error
+	// SaveSnapshot заменяет снимок состояния счетчиков, если его номер Seq больше номера сохраненного снимка,
+	// а при отсутствии сохраненного снимка - больше нуля
+	SaveSnapshot(ctx context.Context, s Snapshot) error
+	// LoadSnapshot загружает снимок состояния счетчиков; если снимок не сохранялся, возвращает ErrNotFound
+	LoadSnapshot(ctx context.Context) (Snapshot, error)
+}
@@ -0,0 +1,35 @@
+package storage
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+)
+
+// HistoryEntry запись истории изменений счетчика, передаваемая клиентам по RPC протоколу
+type HistoryEntry struct {
+	Time      time.Time     // время изменения
+	Operation string        // имя операции (RPC метода), выполнившей изменение
+	Deleted   bool          // признак удаления счетчика
+	State     counter.State // состояние счетчика после изменения, нулевое при удалении счетчика
+}
+
+// History журнал изменений счетчиков типа Incrementator, который только дополняется новыми записями
+// Пустое имя соответствует счетчику по умолчанию
+// Вызов методов потокобезопасен
+type History interface {
+	// AppendHistory добавляет запись в историю изменений счетчика name
+	AppendHistory(ctx context.Context, name string, e HistoryEntry) error
+	// History возвращает записи истории изменений счетчика name со временем изменения
+	// не раньше from и раньше to в порядке возрастания времени, записи с одинаковым
+	// временем - в порядке добавления; нулевое значение to не ограничивает записи сверху
+	History(ctx context.Context, name string, from, to time.Time) ([]HistoryEntry, error)
+	// HistoryAsOf возвращает последнюю запись истории изменений счетчика name со временем
+	// изменения не позже at; если такой записи нет, возвращает ErrNotFound
+	HistoryAsOf(ctx context.Context, name string, at time.Time) (HistoryEntry, error)
+}
@@ -0,0 +1,303 @@
+package storage
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+)
+
+// Memory хранилище состояния счетчиков в памяти процесса
+// Предназначено для тестов и сервисов, которым не требуется сохранять счетчики между запусками
+// Вызов методов потокобезопасен
+type Memory struct {
+	mtx      sync.Mutex                  // мьютекс для блокировки одновременного изменения хранилища
+	counters map[string]counter.State    // снимки состояния счетчиков
+	big      map[string]counter.BigState // снимки состояния счетчиков произвольной точности
+	history  map[string][]HistoryEntry   // записи истории изменений счетчиков в порядке добавления
+	events   []Event                     // журнал событий изменения счетчиков в порядке номеров
+	snapshot *Snapshot                   // последний сохраненный снимок состояния счетчиков
+	closed   bool                        // признак закрытия хранилища
+}
+
+// Memory реализует интерфейсы хранилища Store, журнала изменений History и журнала событий EventLog
+var (
+	_ Store    = (*Memory)(nil)
+	_ History  = (*Memory)(nil)
+	_ EventLog = (*Memory)(nil)
+)
+
+// CreateMemoryStore функция создает новое пустое хранилище в памяти и возвращает указатель на него.
+func CreateMemoryStore() *Memory {
+	return &Memory{
+		counters: make(map[string]counter.State),
+		big:      make(map[string]counter.BigState),
+		history:  make(map[string][]HistoryEntry),
+	}
+}
+
+// lock метод блокирует хранилище, если контекст ctx не завершился и хранилище не закрыто
+// В случае успеха хранилище должно быть разблокировано вызывающей функцией
+func (m *Memory) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mtx.Lock()
+	if m.closed {
+		m.mtx.Unlock()
+		return ErrClosed
+	}
+	return nil
+}
+
+// Load метод загружает снимок состояния счетчика name
+func (m *Memory) Load(ctx context.Context, name string) (counter.State, error) {
+	if err := m.lock(ctx); err != nil {
+		return counter.State{}, err
+	}
+	defer m.mtx.Unlock()
+	s, ok := m.counters[name]
+	if !ok {
+		return counter.State{}, ErrNotFound
+	}
+	return s, nil
+}
+
+// Save метод сохраняет снимок состояния счетчика name, если он новее сохраненного
+// Режим синхронизации не изменяется после создания счетчика, поэтому сохраняется только при создании
+func (m *Memory) Save(ctx context.Context, name string, s counter.State) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mtx.Unlock()
+	if prev, ok := m.counters[name]; ok {
+		if prev.Version >= s.Version {
+			return nil
+		}
+		s.Mode = prev.Mode
+	}
+	m.counters[name] = s
+	return nil
+}
+
+// List метод загружает снимки состояния всех именованных счетчиков
+func (m *Memory) List(ctx context.Context) (map[string]counter.State, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mtx.Unlock()
+	states := make(map[string]counter.State, len(m.counters))
+	for name, s := range m.counters {
+		if name != "" {
+			states[name] = s
+		}
+	}
+	return states, nil
+}
+
+// Delete метод удаляет состояние счетчика name
+func (m *Memory) Delete(ctx context.Context, name string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mtx.Unlock()
+	delete(m.counters, name)
+	return nil
+}
+
+// LoadBig метод загружает снимок состояния счетчика произвольной точности name
+func (m *Memory) LoadBig(ctx context.Context, name string) (counter.BigState, error) {
+	if err := m.lock(ctx); err != nil {
+		return counter.BigState{}, err
+	}
+	defer m.mtx.Unlock()
+	s, ok := m.big[name]
+	if !ok {
+		return counter.BigState{}, ErrNotFound
+	}
+	return copyBigState(s), nil
+}
+
+// SaveBig метод сохраняет снимок состояния счетчика произвольной точности name, если он новее сохраненного
+func (m *Memory) SaveBig(ctx context.Context, name string, s counter.BigState) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mtx.Unlock()
+	if prev, ok := m.big[name]; ok && prev.Version >= s.Version {
+		return nil
+	}
+	m.big[name] = copyBigState(s)
+	return nil
+}
+
+// ListBig метод загружает снимки состояния всех счетчиков произвольной точности
+func (m *Memory) ListBig(ctx context.Context) (map[string]counter.BigState, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mtx.Unlock()
+	states := make(map[string]counter.BigState, len(m.big))
+	for name, s := range m.big {
+		states[name] = copyBigState(s)
+	}
+	return states, nil
+}
+
+// DeleteBig метод удаляет состояние счетчика произвольной точности name
+func (m *Memory) DeleteBig(ctx context.Context, name string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mtx.Unlock()
+	delete(m.big, name)
+	return nil
+}
+
+// AppendHistory метод добавляет запись в историю изменений счетчика name
+func (m *Memory) AppendHistory(ctx context.Context, name string, e HistoryEntry) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mtx.Unlock()
+	m.history[name] = append(m.history[name], e)
+	return nil
+}
+
+// History метод возвращает записи истории изменений счетчика name за период [from, to)
+func (m *Memory) History(ctx context.Context, name string, from, to time.Time) ([]HistoryEntry, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mtx.Unlock()
+	var entries []HistoryEntry
+	for _, e := range m.history[name] {
+		if !e.Time.Before(from) && (to.IsZero() || e.Time.Before(to)) {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].Time.Before(entries[b].Time)
+	})
+	return entries, nil
+}
+
+// HistoryAsOf метод возвращает последнюю запись истории изменений счетчика name не позже at
+func (m *Memory) HistoryAsOf(ctx context.Context, name string, at time.Time) (HistoryEntry, error) {
+	if err := m.lock(ctx); err != nil {
+		return HistoryEntry{}, err
+	}
+	defer m.mtx.Unlock()
+	var last HistoryEntry
+	found := false
+	// при одинаковом времени выбирается запись, добавленная последней
+	for _, e := range m.history[name] {
+		if !e.Time.After(at) && (!found || !e.Time.Before(last.Time)) {
+			last, found = e, true
+		}
+	}
+	if !found {
+		return HistoryEntry{}, ErrNotFound
+	}
+	return last, nil
+}
+
+// AppendEvent метод добавляет событие в журнал и возвращает присвоенный ему номер
+func (m *Memory) AppendEvent(ctx context.Context, e Event) (uint64, error) {
+	if err := m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer m.mtx.Unlock()
+	e.Seq = uint64(len(m.events)) + 1
+	if e.Settings != nil {
+		settings := *e.Settings
+		e.Settings = &settings
+	}
+	m.events = append(m.events, e)
+	return e.Seq, nil
+}
+
+// Events метод вызывает fn для каждого события с номером больше after в порядке номеров
+// Функция fn вызывается без блокировки хранилища
+func (m *Memory) Events(ctx context.Context, after uint64, fn func(e Event) error) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	var events []Event
+	if after < uint64(len(m.events)) {
+		events = m.events[after:len(m.events):len(m.events)]
+	}
+	m.mtx.Unlock()
+	for _, e := range events {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveSnapshot метод заменяет снимок состояния счетчиков, если он новее сохраненного
+func (m *Memory) SaveSnapshot(ctx context.Context, s Snapshot) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mtx.Unlock()
+	var seq uint64
+	if m.snapshot != nil {
+		seq = m.snapshot.Seq
+	}
+	if seq >= s.Seq {
+		return nil
+	}
+	counters := make(map[string]counter.State, len(s.Counters))
+	for name, st := range s.Counters {
+		counters[name] = st
+	}
+	m.snapshot = &Snapshot{Seq: s.Seq, Counters: counters}
+	return nil
+}
+
+// LoadSnapshot метод загружает последний сохраненный снимок состояния счетчиков
+func (m *Memory) LoadSnapshot(ctx context.Context) (Snapshot, error) {
+	if err := m.lock(ctx); err != nil {
+		return Snapshot{}, err
+	}
+	defer m.mtx.Unlock()
+	if m.snapshot == nil {
+		return Snapshot{}, ErrNotFound
+	}
+	counters := make(map[string]counter.State, len(m.snapshot.Counters))
+	for name, st := range m.snapshot.Counters {
+		counters[name] = st
+	}
+	return Snapshot{Seq: m.snapshot.Seq, Counters: counters}, nil
+}
+
+// Close метод закрывает хранилище
+func (m *Memory) Close() error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.closed = true
+	return nil
+}
+
+// copyBigState копия снимка состояния счетчика произвольной точности, не разделяющая
+// с исходным снимком значения *big.Int
+func copyBigState(s counter.BigState) counter.BigState {
+	for _, x := range []**big.Int{&s.Value, &s.Step, &s.MinValue, &s.MaxValue, &s.ResetValue} {
+		if *x != nil {
+			*x = new(big.Int).Set(*x)
+		}
+	}
+	return s
+}
@@ -0,0 +1,19 @@
+package storage_test
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"testing"
+
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/storetest"
+)
+
+// Тестирование хранилища в памяти общими тестами хранилищ
+func TestMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.CreateMemoryStore()
+	})
+}
@@ -0,0 +1,149 @@
+package sqlite
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+)
+
+// Store реализует интерфейс журнала событий storage.EventLog
+// События хранятся в таблице <tableName>_events, снимок состояния счетчиков - в таблице <tableName>_snapshot
+var _ storage.EventLog = (*Store)(nil)
+
+// AppendEvent метод добавляет событие в журнал и возвращает присвоенный ему номер
+func (s *Store) AppendEvent(ctx context.Context, e storage.Event) (uint64, error) {
+	var settings sql.NullString
+	if e.Settings != nil {
+		data, err := json.Marshal(e.Settings)
+		if err != nil {
+			return 0, err
+		}
+		settings = sql.NullString{String: string(data), Valid: true}
+	}
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s(name, time, kind, steps, set_value, settings, mode, %s)
+		VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, s.table("_events"), stateFields),
+		append([]interface{}{e.Name, e.Time.UnixNano(), e.Kind, e.Steps, e.Value, settings, e.State.Mode}, stateValues(e.State)...)...)
+	if err != nil {
+		return 0, err
+	}
+	seq, err := res.LastInsertId()
+	return uint64(seq), err
+}
+
+// Events метод вызывает fn для каждого события с номером больше after в порядке номеров
+// События читаются порциями, поэтому функция fn может обращаться к хранилищу
+func (s *Store) Events(ctx context.Context, after uint64, fn func(e storage.Event) error) error {
+	for {
+		events, err := s.readEvents(ctx, after)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		for _, e := range events {
+			if err = fn(e); err != nil {
+				return err
+			}
+			after = e.Seq
+		}
+	}
+}
+
+// eventsBatch количество событий, читаемых из журнала за один запрос
+const eventsBatch = 1000
+
+// readEvents чтение очередной порции событий с номерами больше after
+func (s *Store) readEvents(ctx context.Context, after uint64) ([]storage.Event, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT seq, name, time, kind, steps, set_value, settings, mode, %s FROM %s
+		WHERE seq > ? ORDER BY seq LIMIT ?`, stateFields, s.table("_events")), int64(after), eventsBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []storage.Event
+	for rows.Next() {
+		var e storage.Event
+		var at int64
+		var settings sql.NullString
+		var mode counter.Mode
+		e.State, err = scanState(rows, &e.Seq, &e.Name, &at, &e.Kind, &e.Steps, &e.Value, &settings, &mode)
+		if err != nil {
+			return nil, err
+		}
+		e.Time = time.Unix(0, at)
+		e.State.Mode = mode
+		if settings.Valid {
+			e.Settings = new(counter.Settings)
+			if err = json.Unmarshal([]byte(settings.String), e.Settings); err != nil {
+				return nil, fmt.Errorf("событие %d: некорректные настройки счетчика: %w", e.Seq, err)
+			}
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// SaveSnapshot метод заменяет снимок состояния счетчиков, если он новее сохраненного
+// Снимок заменяется целиком в одной транзакции
+func (s *Store) SaveSnapshot(ctx context.Context, snap storage.Snapshot) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var seq uint64
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(MAX(seq), 0) FROM %s", s.table("_snapshot"))).Scan(&seq)
+	if err != nil {
+		return err
+	}
+	// пустой снимок с нулевым номером не отличается от отсутствия снимка
+	if seq >= snap.Seq {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", s.table("_snapshot")))
+	if err != nil {
+		return err
+	}
+	for name, st := range snap.Counters {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s(name, seq, mode, %s) VALUES(?,?,?,?,?,?,?,?,?,?,?,?)", s.table("_snapshot"), stateFields),
+			append([]interface{}{name, int64(snap.Seq), st.Mode}, stateValues(st)...)...)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadSnapshot метод загружает последний сохраненный снимок состояния счетчиков
+func (s *Store) LoadSnapshot(ctx context.Context) (storage.Snapshot, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT name, seq, mode, %s FROM %s", stateFields, s.table("_snapshot")))
+	if err != nil {
+		return storage.Snapshot{}, err
+	}
+	defer rows.Close()
+	snap := storage.Snapshot{Counters: make(map[string]counter.State)}
+	for rows.Next() {
+		var name string
+		var mode counter.Mode
+		st, err := scanState(rows, &name, &snap.Seq, &mode)
+		if err != nil {
+			return storage.Snapshot{}, err
+		}
+		st.Mode = mode
+		snap.Counters[name] = st
+	}
+	if err = rows.Err(); err != nil {
+		return storage.Snapshot{}, err
+	}
+	if len(snap.Counters) == 0 {
+		return storage.Snapshot{}, storage.ErrNotFound
+	}
+	return snap, nil
+}
@@ -0,0 +1,77 @@
+package sqlite
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+)
+
+// Store реализует интерфейс журнала изменений storage.History
+// Записи истории хранятся в таблице <tableName>_history
+var _ storage.History = (*Store)(nil)
+
+// AppendHistory метод добавляет запись в историю изменений счетчика name
+func (s *Store) AppendHistory(ctx context.Context, name string, e storage.HistoryEntry) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s(name, time, operation, deleted, mode, %s)
+		VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, s.table("_history"), stateFields),
+		append([]interface{}{name, e.Time.UnixNano(), e.Operation, e.Deleted, e.State.Mode}, stateValues(e.State)...)...)
+	return err
+}
+
+// History метод возвращает записи истории изменений счетчика name за период [from, to)
+func (s *Store) History(ctx context.Context, name string, from, to time.Time) ([]storage.HistoryEntry, error) {
+	until := int64(math.MaxInt64)
+	if !to.IsZero() {
+		until = to.UnixNano()
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT time, operation, deleted, mode, %s FROM %s
+		WHERE name = ? AND time >= ? AND time < ? ORDER BY time, id`, stateFields, s.table("_history")),
+		name, from.UnixNano(), until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []storage.HistoryEntry
+	for rows.Next() {
+		e, err := scanHistoryEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// HistoryAsOf метод возвращает последнюю запись истории изменений счетчика name не позже at
+func (s *Store) HistoryAsOf(ctx context.Context, name string, at time.Time) (storage.HistoryEntry, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT time, operation, deleted, mode, %s FROM %s
+		WHERE name = ? AND time <= ? ORDER BY time DESC, id DESC LIMIT 1`, stateFields, s.table("_history")),
+		name, at.UnixNano())
+	e, err := scanHistoryEntry(row)
+	if err == sql.ErrNoRows {
+		return storage.HistoryEntry{}, storage.ErrNotFound
+	}
+	return e, err
+}
+
+// scanHistoryEntry чтение записи истории изменений счетчика из столбцов time, operation, deleted, mode и stateFields
+func scanHistoryEntry(row scanner) (e storage.HistoryEntry, err error) {
+	var at int64
+	var mode counter.Mode
+	e.State, err = scanState(row, &at, &e.Operation, &e.Deleted, &mode)
+	if err != nil {
+		return
+	}
+	e.Time = time.Unix(0, at)
+	e.State.Mode = mode
+	return
+}
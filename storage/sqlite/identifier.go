@@ -0,0 +1,121 @@
+package sqlite
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidTableName ошибка использования недопустимого имени таблицы или префикса имен таблиц
+var ErrInvalidTableName = errors.New("недопустимое имя таблицы")
+
+// maxTableNameLength наибольшая длина имени таблицы с префиксом, оставляющая место
+// для суффиксов имен служебных таблиц хранилища
+const maxTableNameLength = 48
+
+// tableSuffixes суффиксы имен служебных таблиц и индексов хранилища, добавляемые к имени таблицы
+// состояния счетчиков, включая таблицы прежних версий схемы и временные таблицы изменений схемы
+// Суффикс каждой новой таблицы или индекса хранилища добавляется в этот перечень
+var tableSuffixes = []string{"_counters", "_big_counters", "_keyed", "_migrations", "_history", "_history_name_time", "_events", "_snapshot"}
+
+// identifierPattern допустимое имя таблицы и префикс имен таблиц: латинские буквы,
+// цифры и знак подчеркивания, имя не начинается с цифры
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateTableName функция проверяет имя таблицы хранения состояния счетчиков,
+// включающее префикс имен таблиц
+// Совпадение таблиц хранилища с таблицами других хранилищ той же БД проверяется при подключении к ней
+// В случае недопустимого имени возвращает ошибку, обертывающую ErrInvalidTableName
+func ValidateTableName(name string) error {
+	if !identifierPattern.MatchString(name) {
+		return fmt.Errorf("%w %q: допускаются латинские буквы, цифры и знак подчеркивания, имя не может начинаться с цифры", ErrInvalidTableName, name)
+	}
+	if len(name) > maxTableNameLength {
+		return fmt.Errorf("%w %q: длина имени превышает %d символов", ErrInvalidTableName, name, maxTableNameLength)
+	}
+	// имена, начинающиеся с sqlite_, зарезервированы для служебных таблиц SQLite
+	if strings.HasPrefix(strings.ToLower(name), "sqlite_") {
+		return fmt.Errorf("%w %q: имя зарезервировано SQLite", ErrInvalidTableName, name)
+	}
+	return nil
+}
+
+// ValidateTablePrefix функция проверяет префикс имен таблиц; пустой префикс допустим
+// В случае недопустимого префикса возвращает ошибку, обертывающую ErrInvalidTableName
+func ValidateTablePrefix(prefix string) error {
+	if prefix != "" && !identifierPattern.MatchString(prefix) {
+		return fmt.Errorf("%w: недопустимый префикс %q: допускаются латинские буквы, цифры и знак подчеркивания, префикс не может начинаться с цифры", ErrInvalidTableName, prefix)
+	}
+	return nil
+}
+
+// quote запись имени таблицы в виде идентификатора SQL в двойных кавычках
+// Имена проверяются при подключении к БД, а кавычки исключают совпадение имени с ключевым словом SQL
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// table метод возвращает идентификатор таблицы хранилища с суффиксом suffix
+// Пустому суффиксу соответствует таблица состояния счетчиков
+func (s *Store) table(suffix string) string {
+	return quote(s.tableName + suffix)
+}
+
+// tableNames имена всех таблиц и индексов хранилища с таблицей состояния счетчиков tableName
+// в нижнем регистре, так как SQLite сравнивает имена без учета регистра
+func tableNames(tableName string) []string {
+	base := strings.ToLower(tableName)
+	names := []string{base}
+	for _, suffix := range tableSuffixes {
+		names = append(names, base+suffix)
+	}
+	return names
+}
+
+// checkTableNames метод проверяет, что таблицы хранилища не совпадают с таблицами других хранилищ той же БД
+// Другие хранилища определяются по таблицам изменений схемы. Хранилище, таблица изменений схемы
+// которого уже существует, создано прежде и не проверяется, поэтому имена таблиц уже используемых
+// хранилищ остаются допустимыми
+// В случае совпадения возвращает ошибку, обертывающую ErrInvalidTableName
+func (s *Store) checkTableNames() error {
+	rows, err := s.db.Query("SELECT lower(name) FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return err
+		}
+		existing[name] = true
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if existing[strings.ToLower(s.tableName)+"_migrations"] {
+		return nil
+	}
+	own := make(map[string]bool)
+	for _, name := range tableNames(s.tableName) {
+		own[name] = true
+	}
+	for name := range existing {
+		other, ok := strings.CutSuffix(name, "_migrations")
+		if !ok || !existing[other] {
+			continue
+		}
+		for _, table := range tableNames(other) {
+			if own[table] {
+				return fmt.Errorf("%w %q: таблица %s совпадает с таблицей хранилища %s в той же базе данных", ErrInvalidTableName, s.tableName, table, other)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package sqlite
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Тестирование проверки имен таблиц
+func TestValidateTableName(t *testing.T) {
+	for _, name := range []string{"incrementor", "_incrementor", "Service2_incrementor", "counters", "history_log", "billing_counters", "incrementor_big"} {
+		if err := ValidateTableName(name); err != nil {
+			t.Fatalf("Допустимое имя таблицы %q отклонено: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "1table", "a-b", "incrementor; DROP TABLE incrementor", `a"b`, "sqlite_master", "SQLite_stat1", strings.Repeat("a", maxTableNameLength+1)} {
+		if err := ValidateTableName(name); !errors.Is(err, ErrInvalidTableName) {
+			t.Fatalf("Недопустимое имя таблицы %q не отклонено, получено: %v", name, err)
+		}
+	}
+	if err := ValidateTablePrefix(""); err != nil {
+		t.Fatalf("Пустой префикс имен таблиц отклонен: %v", err)
+	}
+	if err := ValidateTablePrefix("a b"); !errors.Is(err, ErrInvalidTableName) {
+		t.Fatalf("Недопустимый префикс имен таблиц не отклонен, получено: %v", err)
+	}
+	if q := quote(`a"b`); q != `"a""b"` {
+		t.Fatalf("Неверная запись идентификатора в кавычках: %s", q)
+	}
+}
+
+// Тестирование использования одного файла БД хранилищами с разными префиксами имен таблиц
+func TestSharedDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "shared.db")
+	if _, err := OpenWithPrefix(dbPath, "", "incrementor; DROP TABLE x"); !errors.Is(err, ErrInvalidTableName) {
+		t.Fatalf("функция OpenWithPrefix не отклонила недопустимое имя таблицы, получено: %v", err)
+	}
+	first, err := OpenWithPrefix(dbPath, "first_", "incrementor")
+	if err != nil {
+		t.Fatalf("функция OpenWithPrefix вернула ошибку: %q", err.Error())
+	}
+	defer first.Close()
+	second, err := OpenWithPrefix(dbPath, "second_", "incrementor")
+	if err != nil {
+		t.Fatalf("функция OpenWithPrefix вернула ошибку: %q", err.Error())
+	}
+	defer second.Close()
+	ctx := context.Background()
+	for k, s := range []*Store{first, second} {
+		st, _ := s.Load(ctx, "")
+		st.Value, st.Version = int64(k+1), 1
+		if err = s.Save(ctx, "", st); err != nil {
+			t.Fatalf("метод Save вернул ошибку: %q", err.Error())
+		}
+	}
+	for k, s := range []*Store{first, second} {
+		if st, err := s.Load(ctx, ""); err != nil || st.Value != int64(k+1) {
+			t.Fatalf("Хранилища с разными префиксами не разделены: %+v, ошибка: %v", st, err)
+		}
+	}
+}
+
+// Тестирование полноты перечня суффиксов служебных таблиц хранилища
+func TestTableSuffixes(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "tables.db"), "incrementor")
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	defer s.Close()
+	rows, err := s.db.Query("SELECT name FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		t.Fatalf("Ошибка чтения перечня таблиц: %q", err.Error())
+	}
+	defer rows.Close()
+	known := map[string]bool{"incrementor": true}
+	for _, suffix := range tableSuffixes {
+		known["incrementor"+suffix] = true
+	}
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		if !known[name] {
+			t.Fatalf("Суффикс таблицы %q отсутствует в перечне tableSuffixes", name)
+		}
+	}
+}
+
+// Тестирование отклонения хранилищ, таблицы которых совпадают с таблицами другого хранилища той же БД
+func TestTableNameCollisions(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tables.db")
+	billing, err := Open(dbPath, "billing")
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	billing.Close()
+	// таблица billing_counters и ее служебные таблицы совпадают с таблицами хранилища billing,
+	// а billing_big_counters - с таблицей счетчиков произвольной точности хранилища billing
+	for _, name := range []string{"billing_counters", "Billing_Counters", "billing_big"} {
+		if _, err = Open(dbPath, name); !errors.Is(err, ErrInvalidTableName) {
+			t.Fatalf("функция Open не отклонила таблицу %s, совпадающую с таблицей хранилища billing, получено: %v", name, err)
+		}
+	}
+	if _, err = OpenWithPrefix(dbPath, "billing", "_counters"); !errors.Is(err, ErrInvalidTableName) {
+		t.Fatalf("функция OpenWithPrefix не отклонила таблицу, совпадающую с таблицей хранилища billing, получено: %v", err)
+	}
+	// в другой БД, а также для уже созданного хранилища, такие имена допустимы
+	for _, open := range []struct{ dbPath, tableName string }{
+		{filepath.Join(t.TempDir(), "other.db"), "billing_counters"},
+		{dbPath, "billing"},
+		{dbPath, "reports"},
+	} {
+		s, err := Open(open.dbPath, open.tableName)
+		if err != nil {
+			t.Fatalf("функция Open отклонила таблицу %s: %q", open.tableName, err.Error())
+		}
+		s.Close()
+	}
+	// хранилище billing не открывается в БД, где его таблицы уже заняты другим хранилищем
+	dbPath = filepath.Join(t.TempDir(), "reversed.db")
+	s, err := Open(dbPath, "billing_counters")
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	s.Close()
+	if _, err = Open(dbPath, "billing"); !errors.Is(err, ErrInvalidTableName) {
+		t.Fatalf("функция Open не отклонила хранилище, таблицы которого заняты другим хранилищем, получено: %v", err)
+	}
+}
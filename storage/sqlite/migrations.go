@@ -0,0 +1,309 @@
+package sqlite
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration изменение схемы БД, переводящее ее к следующей версии
+type migration struct {
+	description string                                   // описание изменения
+	apply       func(tx *sql.Tx, tableName string) error // применение изменения в транзакции tx
+}
+
+// migrations изменения схемы БД в порядке их применения
+// Версия схемы равна количеству примененных изменений
+// Уже выпущенные изменения не редактируются, новые добавляются в конец списка
+var migrations = []migration{
+	{"приведение таблиц версий без учета схемы к общему виду", migrateLegacy},
+	{"хранение состояния всех счетчиков в строках с ключом по имени счетчика", migrateKeyedRows},
+	{"журнал истории изменений счетчиков", migrateHistory},
+	{"журнал событий изменения счетчиков и снимок их состояния", migrateEvents},
+}
+
+// schemaVersion версия схемы БД, с которой работает хранилище
+var schemaVersion = len(migrations)
+
+// migrate перевод схемы БД к версии schemaVersion
+// Примененные изменения учитываются в таблице <tableName>_migrations, каждое изменение
+// применяется и учитывается в одной транзакции, поэтому прерванный перевод продолжается при следующем подключении
+// БД, схема которой новее версии schemaVersion, не используется
+func (s *Store) migrate() error {
+	_, err := s.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+	(
+		version     INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied     INTEGER NOT NULL
+	)`, s.table("_migrations")))
+	if err != nil {
+		return err
+	}
+	for {
+		done, err := s.migrateNext()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// checkVersion проверка того, что схема БД имеет версию schemaVersion, без ее изменения
+func (s *Store) checkVersion() error {
+	var version int
+	err := s.db.QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", s.table("_migrations"))).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения версии схемы БД: %w", err)
+	}
+	if version != schemaVersion {
+		return fmt.Errorf("версия схемы БД %d не совпадает с поддерживаемой версией %d", version, schemaVersion)
+	}
+	return nil
+}
+
+// migrateNext применение следующего изменения схемы БД
+// Возвращает true, если схема уже имеет версию schemaVersion
+func (s *Store) migrateNext() (done bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var version int
+	err = tx.QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", s.table("_migrations"))).Scan(&version)
+	if err != nil {
+		return false, err
+	}
+	if version > schemaVersion {
+		return false, fmt.Errorf("версия схемы БД %d новее поддерживаемой версии %d", version, schemaVersion)
+	}
+	if version == schemaVersion {
+		return true, nil
+	}
+	m := migrations[version]
+	err = m.apply(tx, s.tableName)
+	if err != nil {
+		return false, fmt.Errorf("ошибка перевода схемы БД к версии %d (%s): %w", version+1, m.description, err)
+	}
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s(version, description, applied) VALUES(?,?,?)", s.table("_migrations")),
+		version+1, m.description, time.Now().UnixNano())
+	if err != nil {
+		return false, err
+	}
+	return false, tx.Commit()
+}
+
+// legacyColumns столбцы таблиц хранения состояния счетчика, появившиеся
+// до учета версий схемы и отсутствующие в таблицах, созданных прежними версиями сервиса
+var legacyColumns = []struct{ name, definition string }{
+	{"min_value", "INTEGER NOT NULL DEFAULT 0"},
+	{"overflow", "INTEGER NOT NULL DEFAULT 0"},
+	{"reset_value", "INTEGER NOT NULL DEFAULT 1"},
+	{"version", "INTEGER NOT NULL DEFAULT 0"},
+	{"wraps", "INTEGER NOT NULL DEFAULT 0"},
+	{"modified", "INTEGER NOT NULL DEFAULT 0"},
+	{"mode", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// migrateLegacy создание недостающих таблиц и столбцов, которые прежние версии сервиса
+// добавляли без учета версии схемы
+// Первая версия хранила счетчик по умолчанию в таблице tableName со столбцами
+// (id, value, step, max_value), дописывая новую строку при каждом запуске
+func migrateLegacy(tx *sql.Tx, tableName string) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+	(
+		id    INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+		value INTEGER,
+		step  INTEGER,
+		max_value INTEGER
+	)`, quote(tableName)))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+	(
+		name  TEXT PRIMARY KEY,
+		value INTEGER,
+		step  INTEGER,
+		max_value INTEGER
+	)`, quote(tableName+"_counters")))
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{tableName, tableName + "_counters"} {
+		for _, column := range legacyColumns {
+			err = addColumnIfNotExists(tx, table, column.name, column.definition)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// Значения счетчиков произвольной точности хранятся в десятичной записи, отсутствующая граница диапазона - NULL
+	_, err = tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+	(
+		name        TEXT PRIMARY KEY,
+		value       TEXT NOT NULL,
+		step        TEXT NOT NULL,
+		max_value   TEXT,
+		min_value   TEXT,
+		overflow    INTEGER NOT NULL,
+		reset_value TEXT NOT NULL,
+		wraps       TEXT NOT NULL,
+		modified    INTEGER NOT NULL,
+		version     INTEGER NOT NULL
+	)`, quote(tableName+"_big_counters")))
+	return err
+}
+
+// migrateKeyedRows перенос состояния счетчика по умолчанию и именованных счетчиков в одну таблицу
+// tableName, строки которой имеют ключ по имени счетчика; счетчику по умолчанию соответствует пустое имя
+// Из таблицы счетчика по умолчанию переносится последняя строка, которую и использовали прежние версии
+func migrateKeyedRows(tx *sql.Tx, tableName string) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s
+	(
+		name        TEXT PRIMARY KEY,
+		mode        INTEGER NOT NULL,
+		value       INTEGER NOT NULL,
+		step        INTEGER NOT NULL,
+		max_value   INTEGER NOT NULL,
+		min_value   INTEGER NOT NULL,
+		overflow    INTEGER NOT NULL,
+		reset_value INTEGER NOT NULL,
+		wraps       INTEGER NOT NULL,
+		modified    INTEGER NOT NULL,
+		version     INTEGER NOT NULL
+	)`, quote(tableName+"_keyed")))
+	if err != nil {
+		return err
+	}
+	// столбцы первой версии схемы допускали NULL
+	columns := "mode, COALESCE(value, 0), COALESCE(step, 1), COALESCE(max_value, 0), min_value, overflow, reset_value, wraps, modified, version"
+	_, err = tx.Exec(fmt.Sprintf(`INSERT INTO %s(name, mode, %s)
+		SELECT '', %s FROM %s WHERE id = (SELECT MAX(id) FROM %[4]s)`, quote(tableName+"_keyed"), stateFields, columns, quote(tableName)))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf(`INSERT INTO %s(name, mode, %s)
+		SELECT name, %s FROM %s WHERE name <> ''`, quote(tableName+"_keyed"), stateFields, columns, quote(tableName+"_counters")))
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		"DROP TABLE " + quote(tableName),
+		"DROP TABLE " + quote(tableName+"_counters"),
+		"ALTER TABLE " + quote(tableName+"_keyed") + " RENAME TO " + quote(tableName),
+	} {
+		_, err = tx.Exec(query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateHistory создание таблицы <tableName>_history истории изменений счетчиков
+// Записи только добавляются; порядок записей с одинаковым временем изменения задает столбец id
+func migrateHistory(tx *sql.Tx, tableName string) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s
+	(
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		name        TEXT NOT NULL,
+		time        INTEGER NOT NULL,
+		operation   TEXT NOT NULL,
+		deleted     INTEGER NOT NULL,
+		mode        INTEGER NOT NULL,
+		value       INTEGER NOT NULL,
+		step        INTEGER NOT NULL,
+		max_value   INTEGER NOT NULL,
+		min_value   INTEGER NOT NULL,
+		overflow    INTEGER NOT NULL,
+		reset_value INTEGER NOT NULL,
+		wraps       INTEGER NOT NULL,
+		modified    INTEGER NOT NULL,
+		version     INTEGER NOT NULL
+	)`, quote(tableName+"_history")))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("CREATE INDEX %s ON %s(name, time, id)", quote(tableName+"_history_name_time"), quote(tableName+"_history")))
+	return err
+}
+
+// migrateEvents создание таблицы <tableName>_events журнала событий изменения счетчиков
+// и таблицы <tableName>_snapshot снимка состояния счетчиков, по одной строке на счетчик
+// Столбцы состояния счетчика в журнале событий заполняются только для событий создания счетчика,
+// а настройки счетчика записываются в формате JSON только для событий изменения настроек
+func migrateEvents(tx *sql.Tx, tableName string) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s
+	(
+		seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+		name        TEXT NOT NULL,
+		time        INTEGER NOT NULL,
+		kind        INTEGER NOT NULL,
+		steps       INTEGER NOT NULL,
+		set_value   INTEGER NOT NULL,
+		settings    TEXT,
+		mode        INTEGER NOT NULL,
+		value       INTEGER NOT NULL,
+		step        INTEGER NOT NULL,
+		max_value   INTEGER NOT NULL,
+		min_value   INTEGER NOT NULL,
+		overflow    INTEGER NOT NULL,
+		reset_value INTEGER NOT NULL,
+		wraps       INTEGER NOT NULL,
+		modified    INTEGER NOT NULL,
+		version     INTEGER NOT NULL
+	)`, quote(tableName+"_events")))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf(`CREATE TABLE %s
+	(
+		name        TEXT PRIMARY KEY,
+		seq         INTEGER NOT NULL,
+		mode        INTEGER NOT NULL,
+		value       INTEGER NOT NULL,
+		step        INTEGER NOT NULL,
+		max_value   INTEGER NOT NULL,
+		min_value   INTEGER NOT NULL,
+		overflow    INTEGER NOT NULL,
+		reset_value INTEGER NOT NULL,
+		wraps       INTEGER NOT NULL,
+		modified    INTEGER NOT NULL,
+		version     INTEGER NOT NULL
+	)`, quote(tableName+"_snapshot")))
+	return err
+}
+
+// addColumnIfNotExists добавление столбца в таблицу, созданную прежней версией сервиса
+// definition - тип и ограничения добавляемого столбца
+func addColumnIfNotExists(tx *sql.Tx, tableName, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", quote(tableName)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		err = rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk)
+		if err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quote(tableName), column, definition))
+	return err
+}
@@ -0,0 +1,311 @@
+// Пакет sqlite реализует хранилище состояния счетчиков storage.Store в файловой базе данных SQLite3
+package sqlite
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// stateFields столбцы таблиц хранения состояния счетчика в порядке,
+// соответствующем stateValues и scanState
+const stateFields = "value, step, max_value, min_value, overflow, reset_value, wraps, modified, version"
+
+// Store хранилище состояния счетчиков в файловой базе данных SQLite3
+// Состояние счетчика по умолчанию (с пустым именем) и именованных счетчиков хранится в таблице
+// tableName, по одной строке на счетчик, счетчиков произвольной точности - в таблице <tableName>_big_counters
+// Сохраняются согласованные снимки состояния, а условие на номер версии не позволяет
+// снимку, полученному раньше, перезаписать более новый при конкурентных изменениях
+// Вызов методов потокобезопасен
+type Store struct {
+	db        *sql.DB // подключение к БД
+	tableName string  // имя таблицы хранения состояния счетчиков, включая префикс
+}
+
+// Store реализует интерфейс хранилища storage.Store
+var _ storage.Store = (*Store)(nil)
+
+// busyTimeout время ожидания освобождения БД, заблокированной другим подключением, в миллисекундах
+// Позволяет нескольким экземплярам сервиса использовать один файл БД
+const busyTimeout = 5000
+
+// Open функция подключается к БД dbPath, переводит схему БД к версии schemaVersion
+// и возвращает указатель на хранилище.
+// Таблицы, созданные прежними версиями сервиса, переводятся к текущей схеме с сохранением состояния счетчиков
+// В случае недопустимого имени таблицы или совпадения таблиц хранилища с таблицами другого хранилища
+// той же БД возвращает ошибку, обертывающую ErrInvalidTableName
+func Open(dbPath, tableName string) (*Store, error) {
+	return OpenWithPrefix(dbPath, "", tableName)
+}
+
+// OpenWithPrefix функция аналогична Open, но имена всех таблиц хранилища начинаются с префикса prefix
+// Экземпляры сервиса с разными префиксами или именами таблиц могут использовать один файл БД
+func OpenWithPrefix(dbPath, prefix, tableName string) (*Store, error) {
+	err := ValidateTablePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	err = ValidateTableName(prefix + tableName)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", withBusyTimeout(dbPath))
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db, tableName: prefix + tableName}
+	err = s.checkTableNames()
+	if err == nil {
+		err = s.migrate()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenReadOnly функция подключается к существующей БД dbPath только для чтения, так же как OpenWithPrefix,
+// и возвращает указатель на хранилище
+// Файл БД не создается, а схема БД не изменяется, поэтому она должна иметь версию schemaVersion
+// Предназначена для чтения хранилища, которое не должно изменяться, например командой восстановления по журналу событий
+func OpenReadOnly(dbPath, prefix, tableName string) (*Store, error) {
+	err := ValidateTablePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	err = ValidateTableName(prefix + tableName)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", withBusyTimeout(readOnly(dbPath)))
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db, tableName: prefix + tableName}
+	err = s.checkVersion()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// readOnly перевод строки подключения к БД в форму URI с режимом только для чтения
+func readOnly(dsn string) string {
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "mode=ro"
+}
+
+// withBusyTimeout добавление в строку подключения к БД времени ожидания освобождения БД,
+// если оно не задано явно
+func withBusyTimeout(dsn string) string {
+	if strings.Contains(dsn, "_busy_timeout=") || strings.Contains(dsn, "_timeout=") {
+		return dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_busy_timeout=" + strconv.Itoa(busyTimeout)
+}
+
+// Close метод закрывает подключение к БД
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Load метод загружает снимок состояния счетчика name
+// Пустое имя соответствует счетчику по умолчанию
+func (s *Store) Load(ctx context.Context, name string) (counter.State, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT mode, %s FROM %s WHERE name = ?", stateFields, s.table("")), name)
+	var mode counter.Mode
+	st, err := scanState(row, &mode)
+	if err == sql.ErrNoRows {
+		return counter.State{}, storage.ErrNotFound
+	}
+	st.Mode = mode
+	return st, err
+}
+
+// Save метод сохраняет снимок состояния созданного или измененного счетчика name
+// Режим синхронизации не изменяется после создания счетчика, поэтому записывается только при вставке
+func (s *Store) Save(ctx context.Context, name string, st counter.State) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s(name, mode, %s) VALUES(?,?,?,?,?,?,?,?,?,?,?)
+			ON CONFLICT(name) DO UPDATE SET (%s) = (excluded.value, excluded.step, excluded.max_value, excluded.min_value,
+			excluded.overflow, excluded.reset_value, excluded.wraps, excluded.modified, excluded.version) WHERE excluded.version > version`, s.table(""), stateFields, stateFields),
+		append([]interface{}{name, st.Mode}, stateValues(st)...)...)
+	return err
+}
+
+// List метод загружает снимки состояния всех именованных счетчиков
+func (s *Store) List(ctx context.Context) (map[string]counter.State, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT name, mode, %s FROM %s WHERE name <> ''", stateFields, s.table("")))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	states := make(map[string]counter.State)
+	for rows.Next() {
+		var name string
+		var mode counter.Mode
+		st, err := scanState(rows, &name, &mode)
+		if err != nil {
+			return nil, err
+		}
+		st.Mode = mode
+		states[name] = st
+	}
+	return states, rows.Err()
+}
+
+// Delete метод удаляет состояние счетчика name из хранилища
+func (s *Store) Delete(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ?", s.table("")), name)
+	return err
+}
+
+// LoadBig метод загружает снимок состояния счетчика произвольной точности name
+func (s *Store) LoadBig(ctx context.Context, name string) (counter.BigState, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT name, %s FROM %s WHERE name = ?", stateFields, s.table("_big_counters")), name)
+	_, st, err := scanBigState(row)
+	if err == sql.ErrNoRows {
+		return counter.BigState{}, storage.ErrNotFound
+	}
+	return st, err
+}
+
+// ListBig метод загружает снимки состояния всех счетчиков произвольной точности
+func (s *Store) ListBig(ctx context.Context) (map[string]counter.BigState, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT name, %s FROM %s", stateFields, s.table("_big_counters")))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	states := make(map[string]counter.BigState)
+	for rows.Next() {
+		name, st, err := scanBigState(rows)
+		if err != nil {
+			return nil, err
+		}
+		states[name] = st
+	}
+	return states, rows.Err()
+}
+
+// SaveBig метод сохраняет снимок состояния созданного или измененного счетчика произвольной точности
+func (s *Store) SaveBig(ctx context.Context, name string, st counter.BigState) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s(name, %s) VALUES(?,?,?,?,?,?,?,?,?,?)
+			ON CONFLICT(name) DO UPDATE SET (%s) = (excluded.value, excluded.step, excluded.max_value, excluded.min_value,
+			excluded.overflow, excluded.reset_value, excluded.wraps, excluded.modified, excluded.version) WHERE excluded.version > version`, s.table("_big_counters"), stateFields, stateFields),
+		append([]interface{}{name}, bigStateValues(st)...)...)
+	return err
+}
+
+// DeleteBig метод удаляет состояние счетчика произвольной точности из хранилища
+func (s *Store) DeleteBig(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ?", s.table("_big_counters")), name)
+	return err
+}
+
+// scanBigState чтение имени и снимка состояния счетчика произвольной точности из столбцов name и stateFields
+func scanBigState(row scanner) (name string, st counter.BigState, err error) {
+	var text [6]sql.NullString
+	var modified int64
+	err = row.Scan(&name, &text[0], &text[1], &text[2], &text[3], &st.Overflow, &text[4], &text[5], &modified, &st.Version)
+	if err != nil {
+		return
+	}
+	var wraps *big.Int
+	for k, dest := range []**big.Int{&st.Value, &st.Step, &st.MaxValue, &st.MinValue, &st.ResetValue, &wraps} {
+		if *dest, err = parseBig(text[k]); err != nil {
+			err = fmt.Errorf("счетчик %q: %w", name, err)
+			return
+		}
+	}
+	if st.Value == nil || st.Step == nil || st.ResetValue == nil || wraps == nil || !wraps.IsUint64() {
+		err = fmt.Errorf("счетчик %q: некорректное состояние в хранилище", name)
+		return
+	}
+	st.Wraps = wraps.Uint64()
+	if modified != 0 {
+		st.Modified = time.Unix(0, modified)
+	}
+	return
+}
+
+// scanner общий для *sql.Row и *sql.Rows метод чтения строки результата запроса
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanState чтение снимка состояния счетчика из столбцов stateFields,
+// которым в строке результата предшествуют столбцы, читаемые в dest
+func scanState(row scanner, dest ...interface{}) (st counter.State, err error) {
+	var modified int64
+	err = row.Scan(append(dest, &st.Value, &st.Step, &st.MaxValue, &st.MinValue, &st.Overflow, &st.ResetValue, &st.Wraps, &modified, &st.Version)...)
+	if modified != 0 {
+		st.Modified = time.Unix(0, modified)
+	}
+	return
+}
+
+// stateValues значения полей согласованного снимка состояния счетчика для записи в хранилище
+func stateValues(s counter.State) []interface{} {
+	var modified int64
+	if !s.Modified.IsZero() {
+		modified = s.Modified.UnixNano()
+	}
+	return []interface{}{s.Value, s.Step, s.MaxValue, s.MinValue, s.Overflow, s.ResetValue, int64(s.Wraps), modified, int64(s.Version)}
+}
+
+// bigStateValues значения полей согласованного снимка состояния счетчика произвольной точности
+// для записи в хранилище в порядке stateFields
+func bigStateValues(s counter.BigState) []interface{} {
+	var modified int64
+	if !s.Modified.IsZero() {
+		modified = s.Modified.UnixNano()
+	}
+	return []interface{}{formatBig(s.Value), formatBig(s.Step), formatBig(s.MaxValue), formatBig(s.MinValue),
+		s.Overflow, formatBig(s.ResetValue), strconv.FormatUint(s.Wraps, 10), modified, int64(s.Version)}
+}
+
+// formatBig десятичная запись значения произвольной точности для записи в хранилище,
+// отсутствующее значение записывается как NULL
+func formatBig(x *big.Int) interface{} {
+	if x == nil {
+		return nil
+	}
+	return x.String()
+}
+
+// parseBig чтение значения произвольной точности из десятичной записи в хранилище
+// NULL соответствует отсутствующему значению
+func parseBig(text sql.NullString) (*big.Int, error) {
+	if !text.Valid {
+		return nil, nil
+	}
+	x, ok := new(big.Int).SetString(text.String, 10)
+	if !ok {
+		return nil, fmt.Errorf("некорректное значение %q", text.String)
+	}
+	return x, nil
+}
@@ -0,0 +1,179 @@
+package sqlite
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/storetest"
+)
+
+// Тестирование загрузки счетчика из таблицы, созданной первой версией сервиса
+func TestOpenLegacyTable(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE incrementor(id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE, value INTEGER, step INTEGER, max_value INTEGER);
+		INSERT INTO incrementor(value, step, max_value) VALUES(3, 1, 10);
+		INSERT INTO incrementor(value, step, max_value) VALUES(7, 2, 50)`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Ошибка создания таблицы первой версии: %q", err.Error())
+	}
+	s, err := Open(dbPath, "incrementor")
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	defer s.Close()
+	st, err := s.Load(context.Background(), "")
+	if err != nil {
+		t.Fatalf("метод Load вернул ошибку: %q", err.Error())
+	}
+	// переносится последняя строка, а недостающие столбцы получают значения по умолчанию
+	if st.Value != 7 || st.Step != 2 || st.MaxValue != 50 || st.MinValue != 0 || st.ResetValue != 1 || st.Overflow != counter.OverflowWrap {
+		t.Fatalf("Неверное состояние счетчика, загруженного из таблицы первой версии: %+v", st)
+	}
+	checkSchema(t, s)
+}
+
+// Тестирование перевода схемы, дополненной столбцами и таблицами до учета версий схемы
+func TestMigrateUnversioned(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "unversioned.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE incrementor(id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE, value INTEGER, step INTEGER, max_value INTEGER,
+			min_value INTEGER NOT NULL DEFAULT 0, overflow INTEGER NOT NULL DEFAULT 0, reset_value INTEGER NOT NULL DEFAULT 1,
+			version INTEGER NOT NULL DEFAULT 0, wraps INTEGER NOT NULL DEFAULT 0, modified INTEGER NOT NULL DEFAULT 0);
+		CREATE TABLE incrementor_counters(name TEXT PRIMARY KEY, value INTEGER, step INTEGER, max_value INTEGER,
+			min_value INTEGER NOT NULL DEFAULT 0, overflow INTEGER NOT NULL DEFAULT 0, reset_value INTEGER NOT NULL DEFAULT 1,
+			version INTEGER NOT NULL DEFAULT 0, wraps INTEGER NOT NULL DEFAULT 0, modified INTEGER NOT NULL DEFAULT 0,
+			mode INTEGER NOT NULL DEFAULT 0);
+		INSERT INTO incrementor(value, step, max_value, version) VALUES(5, 1, 100, 9);
+		INSERT INTO incrementor_counters(name, value, step, max_value, min_value, overflow, version, mode) VALUES('requests', 4, 3, 5, -5, 2, 7, 1)`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Ошибка создания таблиц без учета версии схемы: %q", err.Error())
+	}
+	s, err := Open(dbPath, "incrementor")
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	ctx := context.Background()
+	if st, err := s.Load(ctx, ""); err != nil || st.Value != 5 || st.Version != 9 {
+		t.Fatalf("Неверное состояние перенесенного счетчика по умолчанию: %+v, ошибка: %v", st, err)
+	}
+	states, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("метод List вернул ошибку: %q", err.Error())
+	}
+	expected := counter.State{Value: 4, Step: 3, MaxValue: 5, MinValue: -5, ResetValue: 1, Overflow: counter.OverflowReject, Mode: counter.ModeAtomic, Version: 7}
+	if len(states) != 1 || states["requests"] != expected {
+		t.Fatalf("Неверное состояние перенесенных именованных счетчиков: %+v", states)
+	}
+	checkSchema(t, s)
+	s.Close()
+	// повторное подключение не изменяет схему
+	s, err = Open(dbPath, "incrementor")
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку при повторном подключении: %q", err.Error())
+	}
+	defer s.Close()
+	if states, _ = s.List(ctx); len(states) != 1 {
+		t.Fatalf("Именованные счетчики изменены при повторном подключении: %+v", states)
+	}
+	checkSchema(t, s)
+}
+
+// Тестирование отказа от использования БД с более новой схемой
+func TestOpenNewerSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "newer.db")
+	s, err := Open(dbPath, "incrementor")
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	_, err = s.db.Exec("INSERT INTO incrementor_migrations(version, description, applied) VALUES(?, 'новая версия', 0)", schemaVersion+1)
+	s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err = Open(dbPath, "incrementor"); err == nil {
+		s.Close()
+		t.Fatal("функция Open не вернула ошибку для БД с более новой схемой")
+	}
+}
+
+// Тестирование подключения к БД только для чтения
+func TestOpenReadOnly(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "readonly.db")
+	if s, err := OpenReadOnly(dbPath, "", "incrementor"); err == nil {
+		s.Close()
+		t.Fatal("функция OpenReadOnly не вернула ошибку для несуществующей БД")
+	}
+	if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+		t.Fatalf("функция OpenReadOnly создала файл БД: %v", err)
+	}
+	s, err := Open(dbPath, "incrementor")
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	err = s.Save(context.Background(), "requests", counter.State{Value: 5, Step: 1, MaxValue: 10, Version: 1})
+	s.Close()
+	if err != nil {
+		t.Fatalf("функция Save вернула ошибку: %q", err.Error())
+	}
+	s, err = OpenReadOnly(dbPath, "", "incrementor")
+	if err != nil {
+		t.Fatalf("функция OpenReadOnly вернула ошибку: %q", err.Error())
+	}
+	defer s.Close()
+	if st, err := s.Load(context.Background(), "requests"); err != nil || st.Value != 5 {
+		t.Fatalf("Неверное состояние счетчика: %+v, ошибка: %v", st, err)
+	}
+	if err = s.Save(context.Background(), "requests", counter.State{Value: 6, Step: 1, MaxValue: 10, Version: 2}); err == nil {
+		t.Fatal("функция Save не вернула ошибку для БД, открытой только для чтения")
+	}
+	// таблицы другого хранилища не создаются
+	if other, err := OpenReadOnly(dbPath, "", "reports"); err == nil {
+		other.Close()
+		t.Fatal("функция OpenReadOnly не вернула ошибку для отсутствующего хранилища")
+	}
+}
+
+// checkSchema проверка версии схемы и отсутствия таблиц прежних версий
+func checkSchema(t *testing.T, s *Store) {
+	var version, count int
+	err := s.db.QueryRow("SELECT MAX(version), COUNT(*) FROM "+s.tableName+"_migrations").Scan(&version, &count)
+	if err != nil {
+		t.Fatalf("Ошибка чтения версии схемы: %q", err.Error())
+	}
+	if version != schemaVersion || count != schemaVersion {
+		t.Fatalf("Неверная версия схемы БД: %d, применено изменений: %d", version, count)
+	}
+	err = s.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", s.tableName+"_counters").Scan(&count)
+	if err != nil || count != 0 {
+		t.Fatalf("Таблица именованных счетчиков прежней версии не удалена: %v", err)
+	}
+}
+
+// Тестирование хранилища общими тестами хранилищ
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := Open(filepath.Join(t.TempDir(), "test.db"), "incrementor")
+		if err != nil {
+			t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+		}
+		return s
+	})
+}
@@ -0,0 +1,52 @@
+// Пакет storage определяет интерфейс хранилища состояния счетчиков Store
+// и реализует хранилище в памяти
+// Хранилище в базе данных SQLite3 реализовано в пакете storage/sqlite,
+// а общие для всех хранилищ тесты - в пакете storage/storetest
+package storage
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+)
+
+// ErrNotFound ошибка загрузки счетчика, отсутствующего в хранилище
+var ErrNotFound = errors.New("счетчик не найден в хранилище")
+
+// ErrClosed ошибка обращения к закрытому хранилищу
+var ErrClosed = errors.New("хранилище закрыто")
+
+// Store хранилище согласованных снимков состояния счетчиков
+// Счетчики типа Incrementator и BigIncrementator хранятся раздельно, поэтому
+// их имена не пересекаются; пустое имя соответствует счетчику по умолчанию
+// Снимок сохраняется, только если его номер версии больше номера версии уже сохраненного
+// снимка, поэтому снимок, полученный раньше, не перезаписывает более новый при конкурентных изменениях
+// Методы прерываются с ошибкой контекста ctx, если он завершился
+// Вызов методов потокобезопасен
+type Store interface {
+	// Load загружает снимок состояния счетчика name
+	// Если счетчика нет в хранилище, возвращает ErrNotFound
+	Load(ctx context.Context, name string) (counter.State, error)
+	// Save сохраняет снимок состояния созданного или измененного счетчика name
+	Save(ctx context.Context, name string, s counter.State) error
+	// List загружает снимки состояния всех именованных счетчиков, кроме счетчика по умолчанию
+	List(ctx context.Context) (map[string]counter.State, error)
+	// Delete удаляет состояние счетчика name; отсутствие счетчика не является ошибкой
+	Delete(ctx context.Context, name string) error
+	// LoadBig загружает снимок состояния счетчика произвольной точности name
+	// Если счетчика нет в хранилище, возвращает ErrNotFound
+	LoadBig(ctx context.Context, name string) (counter.BigState, error)
+	// SaveBig сохраняет снимок состояния созданного или измененного счетчика произвольной точности name
+	SaveBig(ctx context.Context, name string, s counter.BigState) error
+	// ListBig загружает снимки состояния всех счетчиков произвольной точности
+	ListBig(ctx context.Context) (map[string]counter.BigState, error)
+	// DeleteBig удаляет состояние счетчика произвольной точности name; отсутствие счетчика не является ошибкой
+	DeleteBig(ctx context.Context, name string) error
+	// Close закрывает хранилище, после чего остальные методы возвращают ошибку
+	Close() error
+}
@@ -0,0 +1,530 @@
+// Пакет storetest содержит общие тесты, которые должна проходить каждая реализация
+// интерфейса хранилища storage.Store, а также журнала изменений storage.History и журнала событий
+// storage.EventLog, если хранилище их реализует
+package storetest
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+)
+
+// Run выполнение общих тестов хранилища
+// create - функция создания нового пустого хранилища для каждого теста;
+// хранилище закрывается тестом
+// Тесты журнала изменений и журнала событий выполняются, если хранилище реализует
+// интерфейсы storage.History и storage.EventLog соответственно
+func Run(t *testing.T, create func(t *testing.T) storage.Store) {
+	for _, test := range []struct {
+		name string
+		run  func(t *testing.T, st storage.Store)
+	}{
+		{"SaveLoad", testSaveLoad},
+		{"DefaultCounter", testDefaultCounter},
+		{"Version", testVersion},
+		{"ListDelete", testListDelete},
+		{"Big", testBig},
+		{"Context", testContext},
+		{"Close", testClose},
+		{"History", testHistory},
+		{"HistoryAsOf", testHistoryAsOf},
+		{"Events", testEvents},
+		{"Snapshot", testSnapshot},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			st := create(t)
+			defer st.Close()
+			test.run(t, st)
+		})
+	}
+}
+
+// history журнал изменений хранилища; тест пропускается, если хранилище его не реализует
+func history(t *testing.T, st storage.Store) storage.History {
+	h, ok := st.(storage.History)
+	if !ok {
+		t.Skip("хранилище не реализует журнал изменений")
+	}
+	return h
+}
+
+// state снимок состояния счетчика с заданными значением и номером версии
+func state(value int64, version uint64) counter.State {
+	return counter.State{
+		Value:      value,
+		Step:       2,
+		MinValue:   -10,
+		MaxValue:   100,
+		ResetValue: 1,
+		Overflow:   counter.OverflowSaturate,
+		Mode:       counter.ModeAtomic,
+		Wraps:      3,
+		Modified:   time.Unix(1600000000, 123456789),
+		Version:    version,
+	}
+}
+
+// bigState снимок состояния счетчика произвольной точности с заданными значением и номером версии
+func bigState(value *big.Int, version uint64) counter.BigState {
+	return counter.BigState{
+		Value:      value,
+		Step:       big.NewInt(1),
+		MinValue:   big.NewInt(0),
+		ResetValue: big.NewInt(0),
+		Overflow:   counter.OverflowReject,
+		Wraps:      1,
+		Modified:   time.Unix(1600000000, 0),
+		Version:    version,
+	}
+}
+
+// equalState сравнение снимков состояния счетчика
+// Время изменения сравнивается без учета монотонных показаний часов
+func equalState(a, b counter.State) bool {
+	if !a.Modified.Equal(b.Modified) {
+		return false
+	}
+	a.Modified = b.Modified
+	return a == b
+}
+
+// equalBig сравнение значений произвольной точности, nil соответствует отсутствующему значению
+func equalBig(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
+
+// equalBigState сравнение снимков состояния счетчика произвольной точности
+func equalBigState(a, b counter.BigState) bool {
+	return equalBig(a.Value, b.Value) && equalBig(a.Step, b.Step) && equalBig(a.MinValue, b.MinValue) &&
+		equalBig(a.MaxValue, b.MaxValue) && equalBig(a.ResetValue, b.ResetValue) && a.Overflow == b.Overflow &&
+		a.Wraps == b.Wraps && a.Modified.Equal(b.Modified) && a.Version == b.Version
+}
+
+// Тестирование сохранения и загрузки именованного счетчика
+func testSaveLoad(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	if _, err := st.Load(ctx, "requests"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("метод Load не вернул ErrNotFound для отсутствующего счетчика, получено: %v", err)
+	}
+	expected := state(42, 1)
+	if err := st.Save(ctx, "requests", expected); err != nil {
+		t.Fatalf("метод Save вернул ошибку: %q", err.Error())
+	}
+	loaded, err := st.Load(ctx, "requests")
+	if err != nil {
+		t.Fatalf("метод Load вернул ошибку: %q", err.Error())
+	}
+	if !equalState(loaded, expected) {
+		t.Fatalf("Неверное состояние загруженного счетчика.\nОжидалось: %+v, получено: %+v", expected, loaded)
+	}
+	// режим синхронизации не изменяется после создания счетчика
+	next := state(43, 2)
+	next.Mode = counter.ModeMutex
+	if err = st.Save(ctx, "requests", next); err != nil {
+		t.Fatalf("метод Save вернул ошибку: %q", err.Error())
+	}
+	loaded, _ = st.Load(ctx, "requests")
+	next.Mode = counter.ModeAtomic
+	if !equalState(loaded, next) {
+		t.Fatalf("Неверное состояние измененного счетчика.\nОжидалось: %+v, получено: %+v", next, loaded)
+	}
+}
+
+// Тестирование хранения счетчика по умолчанию отдельно от именованных счетчиков
+func testDefaultCounter(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	if _, err := st.Load(ctx, ""); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("метод Load не вернул ErrNotFound для отсутствующего счетчика по умолчанию, получено: %v", err)
+	}
+	for version := uint64(1); version <= 2; version++ {
+		expected := state(int64(version), version)
+		if err := st.Save(ctx, "", expected); err != nil {
+			t.Fatalf("метод Save вернул ошибку: %q", err.Error())
+		}
+		loaded, err := st.Load(ctx, "")
+		if err != nil {
+			t.Fatalf("метод Load вернул ошибку: %q", err.Error())
+		}
+		if !equalState(loaded, expected) {
+			t.Fatalf("Неверное состояние счетчика по умолчанию.\nОжидалось: %+v, получено: %+v", expected, loaded)
+		}
+	}
+	states, err := st.List(ctx)
+	if err != nil {
+		t.Fatalf("метод List вернул ошибку: %q", err.Error())
+	}
+	if len(states) != 0 {
+		t.Fatalf("Счетчик по умолчанию включен в список именованных счетчиков: %v", states)
+	}
+}
+
+// Тестирование отказа от сохранения снимка, полученного раньше сохраненного
+func testVersion(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	for _, name := range []string{"", "requests"} {
+		if err := st.Save(ctx, name, state(5, 5)); err != nil {
+			t.Fatalf("метод Save вернул ошибку: %q", err.Error())
+		}
+		for _, s := range []counter.State{state(4, 4), state(6, 5)} {
+			if err := st.Save(ctx, name, s); err != nil {
+				t.Fatalf("метод Save вернул ошибку: %q", err.Error())
+			}
+		}
+		loaded, _ := st.Load(ctx, name)
+		if loaded.Value != 5 || loaded.Version != 5 {
+			t.Fatalf("Счетчик %q перезаписан снимком с меньшим или равным номером версии: %+v", name, loaded)
+		}
+	}
+	bigExpected := bigState(big.NewInt(5), 5)
+	if err := st.SaveBig(ctx, "bytes", bigExpected); err != nil {
+		t.Fatalf("метод SaveBig вернул ошибку: %q", err.Error())
+	}
+	st.SaveBig(ctx, "bytes", bigState(big.NewInt(4), 4))
+	if loaded, _ := st.LoadBig(ctx, "bytes"); !equalBigState(loaded, bigExpected) {
+		t.Fatalf("Счетчик произвольной точности перезаписан снимком с меньшим номером версии: %+v", loaded)
+	}
+}
+
+// Тестирование списка и удаления именованных счетчиков
+func testListDelete(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	expected := map[string]counter.State{"a": state(1, 1), "b": state(2, 1), "c": state(3, 1)}
+	for name, s := range expected {
+		if err := st.Save(ctx, name, s); err != nil {
+			t.Fatalf("метод Save вернул ошибку: %q", err.Error())
+		}
+	}
+	if err := st.Delete(ctx, "b"); err != nil {
+		t.Fatalf("метод Delete вернул ошибку: %q", err.Error())
+	}
+	if err := st.Delete(ctx, "missing"); err != nil {
+		t.Fatalf("метод Delete вернул ошибку при удалении отсутствующего счетчика: %q", err.Error())
+	}
+	delete(expected, "b")
+	states, err := st.List(ctx)
+	if err != nil {
+		t.Fatalf("метод List вернул ошибку: %q", err.Error())
+	}
+	if len(states) != len(expected) {
+		t.Fatalf("Неверный список счетчиков: %v", states)
+	}
+	for name, s := range expected {
+		if !equalState(states[name], s) {
+			t.Fatalf("Неверное состояние счетчика %q в списке.\nОжидалось: %+v, получено: %+v", name, s, states[name])
+		}
+	}
+	if _, err = st.Load(ctx, "b"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("метод Load не вернул ErrNotFound для удаленного счетчика, получено: %v", err)
+	}
+}
+
+// Тестирование хранения счетчиков произвольной точности отдельно от счетчиков типа Incrementator
+func testBig(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	if _, err := st.LoadBig(ctx, "bytes"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("метод LoadBig не вернул ErrNotFound для отсутствующего счетчика, получено: %v", err)
+	}
+	value := new(big.Int).Lsh(big.NewInt(1), 100)
+	expected := bigState(value, 1)
+	if err := st.SaveBig(ctx, "bytes", expected); err != nil {
+		t.Fatalf("метод SaveBig вернул ошибку: %q", err.Error())
+	}
+	// изменение сохраненного значения вызывающей стороной не влияет на хранилище
+	value.SetInt64(0)
+	expected.Value = new(big.Int).Lsh(big.NewInt(1), 100)
+	loaded, err := st.LoadBig(ctx, "bytes")
+	if err != nil {
+		t.Fatalf("метод LoadBig вернул ошибку: %q", err.Error())
+	}
+	if !equalBigState(loaded, expected) {
+		t.Fatalf("Неверное состояние загруженного счетчика произвольной точности: %+v", loaded)
+	}
+	if _, err = st.Load(ctx, "bytes"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Счетчик произвольной точности доступен методом Load: %v", err)
+	}
+	states, err := st.ListBig(ctx)
+	if err != nil {
+		t.Fatalf("метод ListBig вернул ошибку: %q", err.Error())
+	}
+	if len(states) != 1 || !equalBigState(states["bytes"], expected) {
+		t.Fatalf("Неверный список счетчиков произвольной точности: %v", states)
+	}
+	if err = st.DeleteBig(ctx, "bytes"); err != nil {
+		t.Fatalf("метод DeleteBig вернул ошибку: %q", err.Error())
+	}
+	if states, _ = st.ListBig(ctx); len(states) != 0 {
+		t.Fatalf("Счетчик произвольной точности не удален: %v", states)
+	}
+}
+
+// Тестирование прерывания методов при завершенном контексте
+func testContext(t *testing.T, st storage.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := st.Save(ctx, "requests", state(1, 1)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("метод Save не вернул ошибку завершенного контекста, получено: %v", err)
+	}
+	if _, err := st.List(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("метод List не вернул ошибку завершенного контекста, получено: %v", err)
+	}
+	if _, err := st.Load(context.Background(), "requests"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Счетчик сохранен с завершенным контекстом: %v", err)
+	}
+}
+
+// Тестирование обращения к закрытому хранилищу
+func testClose(t *testing.T, st storage.Store) {
+	if err := st.Close(); err != nil {
+		t.Fatalf("метод Close вернул ошибку: %q", err.Error())
+	}
+	ctx := context.Background()
+	if err := st.Save(ctx, "requests", state(1, 1)); err == nil {
+		t.Fatal("метод Save не вернул ошибку после закрытия хранилища")
+	}
+	if _, err := st.List(ctx); err == nil {
+		t.Fatal("метод List не вернул ошибку после закрытия хранилища")
+	}
+}
+
+// eventLog журнал событий хранилища; тест пропускается, если хранилище его не реализует
+func eventLog(t *testing.T, st storage.Store) storage.EventLog {
+	l, ok := st.(storage.EventLog)
+	if !ok {
+		t.Skip("хранилище не реализует журнал событий")
+	}
+	return l
+}
+
+// Тестирование выборки записей истории изменений счетчика за период
+func testHistory(t *testing.T, st storage.Store) {
+	h := history(t, st)
+	ctx := context.Background()
+	base := time.Unix(1600000000, 0)
+	entries := []storage.HistoryEntry{
+		{Time: base, Operation: "CreateCounter", State: state(0, 1)},
+		{Time: base.Add(2 * time.Second), Operation: "IncrementBatch", State: state(6, 3)},
+		// запись с тем же временем, добавленная позже, следует за предыдущей
+		{Time: base.Add(2 * time.Second), Operation: "SetSettings", State: state(6, 4)},
+		// запись, добавленная с опозданием, располагается по времени изменения
+		{Time: base.Add(time.Second), Operation: "IncrementNumber", State: state(2, 2)},
+		{Time: base.Add(3 * time.Second), Operation: "DeleteCounter", Deleted: true},
+	}
+	for _, e := range entries {
+		if err := h.AppendHistory(ctx, "requests", e); err != nil {
+			t.Fatalf("метод AppendHistory вернул ошибку: %q", err.Error())
+		}
+	}
+	if err := h.AppendHistory(ctx, "", storage.HistoryEntry{Time: base, Operation: "IncrementNumber", State: state(1, 1)}); err != nil {
+		t.Fatalf("метод AppendHistory вернул ошибку: %q", err.Error())
+	}
+	for _, test := range []struct {
+		from, to time.Time
+		want     []int
+	}{
+		{time.Time{}, time.Time{}, []int{0, 3, 1, 2, 4}},
+		{base.Add(time.Second), base.Add(3 * time.Second), []int{3, 1, 2}},
+		{base.Add(2 * time.Second), time.Time{}, []int{1, 2, 4}},
+		{base.Add(4 * time.Second), time.Time{}, nil},
+	} {
+		got, err := h.History(ctx, "requests", test.from, test.to)
+		if err != nil {
+			t.Fatalf("метод History вернул ошибку: %q", err.Error())
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("за период [%v, %v) получено %d записей, ожидалось %d", test.from, test.to, len(got), len(test.want))
+		}
+		for k, n := range test.want {
+			if !equalEntry(got[k], entries[n]) {
+				t.Fatalf("за период [%v, %v) запись %d: получено %+v, ожидалось %+v", test.from, test.to, k, got[k], entries[n])
+			}
+		}
+	}
+	got, err := h.History(ctx, "", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("метод History вернул ошибку: %q", err.Error())
+	}
+	if len(got) != 1 || got[0].State.Value != 1 {
+		t.Fatalf("история счетчика по умолчанию смешана с историей именованного счетчика: %+v", got)
+	}
+}
+
+// Тестирование получения записи истории изменений счетчика на заданный момент времени
+func testHistoryAsOf(t *testing.T, st storage.Store) {
+	h := history(t, st)
+	ctx := context.Background()
+	base := time.Unix(1600000000, 0)
+	if _, err := h.HistoryAsOf(ctx, "requests", base); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("для счетчика без истории не возвращена ошибка ErrNotFound, получено: %v", err)
+	}
+	entries := []storage.HistoryEntry{
+		{Time: base, Operation: "CreateCounter", State: state(0, 1)},
+		{Time: base.Add(time.Second), Operation: "IncrementNumber", State: state(2, 2)},
+		{Time: base.Add(time.Second), Operation: "IncrementNumber", State: state(4, 3)},
+		{Time: base.Add(2 * time.Second), Operation: "DeleteCounter", Deleted: true},
+	}
+	for _, e := range entries {
+		if err := h.AppendHistory(ctx, "requests", e); err != nil {
+			t.Fatalf("метод AppendHistory вернул ошибку: %q", err.Error())
+		}
+	}
+	for _, test := range []struct {
+		at   time.Time
+		want int
+	}{
+		{base, 0},
+		{base.Add(time.Second - 1), 0},
+		{base.Add(time.Second), 2},
+		{base.Add(time.Hour), 3},
+	} {
+		got, err := h.HistoryAsOf(ctx, "requests", test.at)
+		if err != nil {
+			t.Fatalf("метод HistoryAsOf вернул ошибку: %q", err.Error())
+		}
+		if !equalEntry(got, entries[test.want]) {
+			t.Fatalf("на момент %v получено %+v, ожидалось %+v", test.at, got, entries[test.want])
+		}
+	}
+	if _, err := h.HistoryAsOf(ctx, "requests", base.Add(-1)); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("для момента до создания счетчика не возвращена ошибка ErrNotFound, получено: %v", err)
+	}
+}
+
+// equalEntry сравнение записей истории изменений счетчика
+func equalEntry(a, b storage.HistoryEntry) bool {
+	return a.Time.Equal(b.Time) && a.Operation == b.Operation && a.Deleted == b.Deleted && equalState(a.State, b.State)
+}
+
+// Тестирование добавления и чтения событий журнала
+func testEvents(t *testing.T, st storage.Store) {
+	l := eventLog(t, st)
+	ctx := context.Background()
+	step, policy := int64(5), counter.OverflowWrap
+	base := time.Unix(1600000000, 0)
+	events := []storage.Event{
+		{Name: "", Time: base, Kind: storage.EventCreate, State: state(0, 1)},
+		{Name: "requests", Time: base, Kind: storage.EventCreate, State: state(1, 1)},
+		{Name: "requests", Time: base.Add(time.Second), Kind: storage.EventAdd, Steps: 3},
+		{Name: "", Time: base.Add(time.Second), Kind: storage.EventAdd, Steps: -1},
+		{Name: "requests", Time: base.Add(2 * time.Second), Kind: storage.EventSetValue, Value: -7},
+		{Name: "requests", Time: base.Add(3 * time.Second), Kind: storage.EventConfigure, Settings: &counter.Settings{Step: &step, Overflow: &policy}},
+		{Name: "requests", Time: base.Add(4 * time.Second), Kind: storage.EventDelete},
+	}
+	var last uint64
+	for k := range events {
+		seq, err := l.AppendEvent(ctx, events[k])
+		if err != nil {
+			t.Fatalf("метод AppendEvent вернул ошибку: %q", err.Error())
+		}
+		if seq <= last {
+			t.Fatalf("номер события %d не больше номера предыдущего события %d", seq, last)
+		}
+		events[k].Seq, last = seq, seq
+	}
+	var got []storage.Event
+	err := l.Events(ctx, 0, func(e storage.Event) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("метод Events вернул ошибку: %q", err.Error())
+	}
+	if len(got) != len(events) {
+		t.Fatalf("прочитано %d событий, ожидалось %d", len(got), len(events))
+	}
+	for k, e := range got {
+		if !equalEvent(e, events[k]) {
+			t.Fatalf("событие %d: получено %+v, ожидалось %+v", k, e, events[k])
+		}
+	}
+	got = nil
+	l.Events(ctx, events[4].Seq, func(e storage.Event) error {
+		got = append(got, e)
+		return nil
+	})
+	if len(got) != 2 || got[0].Seq != events[5].Seq {
+		t.Fatalf("неверные события после номера %d: %+v", events[4].Seq, got)
+	}
+	// ошибка функции прекращает перебор событий
+	stop := errors.New("остановка")
+	count := 0
+	err = l.Events(ctx, 0, func(e storage.Event) error {
+		count++
+		return stop
+	})
+	if !errors.Is(err, stop) || count != 1 {
+		t.Fatalf("перебор событий не прекращен ошибкой функции: %v, вызовов: %d", err, count)
+	}
+}
+
+// Тестирование сохранения и загрузки снимка состояния счетчиков
+func testSnapshot(t *testing.T, st storage.Store) {
+	l := eventLog(t, st)
+	ctx := context.Background()
+	if _, err := l.LoadSnapshot(ctx); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("при отсутствии снимка не возвращена ошибка ErrNotFound, получено: %v", err)
+	}
+	snap := storage.Snapshot{Seq: 10, Counters: map[string]counter.State{"": state(3, 4), "requests": state(5, 6)}}
+	if err := l.SaveSnapshot(ctx, snap); err != nil {
+		t.Fatalf("метод SaveSnapshot вернул ошибку: %q", err.Error())
+	}
+	// более старый снимок не заменяет сохраненный
+	if err := l.SaveSnapshot(ctx, storage.Snapshot{Seq: 9, Counters: map[string]counter.State{"": state(1, 1)}}); err != nil {
+		t.Fatalf("метод SaveSnapshot вернул ошибку: %q", err.Error())
+	}
+	got, err := l.LoadSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("метод LoadSnapshot вернул ошибку: %q", err.Error())
+	}
+	if got.Seq != snap.Seq || len(got.Counters) != len(snap.Counters) {
+		t.Fatalf("загружен снимок %+v, ожидался %+v", got, snap)
+	}
+	for name, s := range snap.Counters {
+		if !equalState(got.Counters[name], s) {
+			t.Fatalf("счетчик %q: загружено %+v, ожидалось %+v", name, got.Counters[name], s)
+		}
+	}
+	// новый снимок заменяет сохраненный целиком
+	if err = l.SaveSnapshot(ctx, storage.Snapshot{Seq: 12, Counters: map[string]counter.State{"": state(7, 8)}}); err != nil {
+		t.Fatalf("метод SaveSnapshot вернул ошибку: %q", err.Error())
+	}
+	got, err = l.LoadSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("метод LoadSnapshot вернул ошибку: %q", err.Error())
+	}
+	if got.Seq != 12 || len(got.Counters) != 1 || got.Counters[""].Value != 7 {
+		t.Fatalf("снимок не заменен целиком: %+v", got)
+	}
+}
+
+// equalEvent сравнение событий журнала
+func equalEvent(a, b storage.Event) bool {
+	if a.Seq != b.Seq || a.Name != b.Name || !a.Time.Equal(b.Time) || a.Kind != b.Kind || a.Steps != b.Steps || a.Value != b.Value {
+		return false
+	}
+	if a.Kind == storage.EventCreate && !equalState(a.State, b.State) {
+		return false
+	}
+	if (a.Settings == nil) != (b.Settings == nil) {
+		return false
+	}
+	return a.Settings == nil || equalInt(a.Settings.Step, b.Settings.Step) && equalInt(a.Settings.MaxValue, b.Settings.MaxValue) &&
+		equalInt(a.Settings.MinValue, b.Settings.MinValue) && equalInt(a.Settings.ResetValue, b.Settings.ResetValue) &&
+		(a.Settings.Overflow == nil) == (b.Settings.Overflow == nil) && (a.Settings.Overflow == nil || *a.Settings.Overflow == *b.Settings.Overflow)
+}
+
+// equalInt сравнение необязательных значений настроек
+func equalInt(a, b *int64) bool {
+	return a == b || a != nil && b != nil && *a == *b
+}
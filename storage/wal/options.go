@@ -0,0 +1,68 @@
+package wal
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"fmt"
+	"time"
+)
+
+// Durability политика сброса записей журнала на диск
+type Durability int
+
+// Политики сброса записей журнала на диск
+const (
+	// DurabilityAlways сброс на диск после каждой записи до возврата из метода,
+	// подтвержденные изменения сохраняются при отказе системы
+	DurabilityAlways Durability = iota
+	// DurabilityInterval сброс на диск с периодом Options.SyncInterval,
+	// при отказе системы теряются изменения за последний период
+	DurabilityInterval
+	// DurabilityNone сброс на диск только при сжатии и закрытии журнала, остальное выполняет операционная система;
+	// при завершении процесса изменения сохраняются, при отказе системы могут быть потеряны
+	DurabilityNone
+)
+
+// String метод возвращает имя политики сброса записей на диск
+func (d Durability) String() string {
+	switch d {
+	case DurabilityAlways:
+		return "always"
+	case DurabilityInterval:
+		return "interval"
+	case DurabilityNone:
+		return "none"
+	}
+	return fmt.Sprintf("Durability(%d)", int(d))
+}
+
+// ParseDurability функция возвращает политику сброса записей на диск по ее имени: always, interval или none
+func ParseDurability(name string) (Durability, error) {
+	for d := DurabilityAlways; d <= DurabilityNone; d++ {
+		if d.String() == name {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("неизвестная политика сброса записей на диск %q, допустимые значения: always, interval, none", name)
+}
+
+// Options настройки журнала
+type Options struct {
+	Durability   Durability    // политика сброса записей на диск
+	SyncInterval time.Duration // период сброса записей на диск для политики DurabilityInterval
+	// CompactMinRecords количество записей в файле, до достижения которого журнал не сжимается
+	// Журнал сжимается в отдельной горутине, когда записей в файле больше CompactMinRecords и вдвое больше,
+	// чем счетчиков; запись нового файла не блокирует сохранение изменений
+	CompactMinRecords int
+}
+
+// DefaultOptions функция возвращает настройки журнала по умолчанию
+func DefaultOptions() Options {
+	return Options{
+		Durability:        DurabilityAlways,
+		SyncInterval:      time.Second,
+		CompactMinRecords: 1000,
+	}
+}
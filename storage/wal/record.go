@@ -0,0 +1,228 @@
+package wal
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math/big"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+)
+
+// magic заголовок файла журнала, включающий версию формата записей
+const magic = "RCNTWAL1"
+
+// recordHeaderSize размер заголовка записи: длина данных и их контрольная сумма CRC-32C
+const recordHeaderSize = 8
+
+// maxRecordSize наибольший допустимый размер данных записи
+// Запись большего размера не дописывается в журнал, поэтому при чтении может быть только результатом повреждения файла
+const maxRecordSize = 1 << 20
+
+// crcTable таблица вычисления контрольной суммы CRC-32C данных записи
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errCorrupt ошибка разбора поврежденной записи журнала
+var errCorrupt = errors.New("поврежденная запись журнала")
+
+// ErrRecordTooLarge ошибка сохранения состояния счетчика, запись которого в журнале превышает наибольший
+// допустимый размер, например из-за слишком длинного имени счетчика
+var ErrRecordTooLarge = errors.New("размер записи журнала превышает допустимый")
+
+// recordKind вид записи журнала
+type recordKind byte
+
+// Виды записей журнала
+const (
+	recordState     recordKind = iota + 1 // снимок состояния счетчика
+	recordDelete                          // удаление счетчика
+	recordBigState                        // снимок состояния счетчика произвольной точности
+	recordDeleteBig                       // удаление счетчика произвольной точности
+)
+
+// record запись журнала: изменение состояния одного счетчика
+type record struct {
+	kind  recordKind       // вид записи
+	name  string           // имя счетчика, пустое имя соответствует счетчику по умолчанию
+	state counter.State    // снимок состояния для recordState
+	big   counter.BigState // снимок состояния для recordBigState
+}
+
+// encode метод добавляет в buf запись в формате журнала: длина данных (4 байта), контрольная сумма
+// CRC-32C данных (4 байта) и сами данные - вид записи, имя счетчика и поля снимка состояния в виде varint
+func (r *record) encode(buf []byte) []byte {
+	start := len(buf)
+	buf = append(buf, make([]byte, recordHeaderSize)...)
+	buf = append(buf, byte(r.kind))
+	buf = binary.AppendUvarint(buf, uint64(len(r.name)))
+	buf = append(buf, r.name...)
+	switch r.kind {
+	case recordState:
+		s := r.state
+		for _, v := range []int64{s.Value, s.Step, s.MinValue, s.MaxValue, s.ResetValue, unixNano(s.Modified)} {
+			buf = binary.AppendVarint(buf, v)
+		}
+		for _, v := range []uint64{uint64(s.Overflow), uint64(s.Mode), s.Wraps, s.Version} {
+			buf = binary.AppendUvarint(buf, v)
+		}
+	case recordBigState:
+		s := r.big
+		for _, x := range []*big.Int{s.Value, s.Step, s.MinValue, s.MaxValue, s.ResetValue} {
+			buf = appendBig(buf, x)
+		}
+		buf = binary.AppendVarint(buf, unixNano(s.Modified))
+		for _, v := range []uint64{uint64(s.Overflow), s.Wraps, s.Version} {
+			buf = binary.AppendUvarint(buf, v)
+		}
+	}
+	data := buf[start+recordHeaderSize:]
+	binary.LittleEndian.PutUint32(buf[start:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[start+4:], crc32.Checksum(data, crcTable))
+	return buf
+}
+
+// decodeRecord разбор данных записи журнала, контрольная сумма которых уже проверена
+func decodeRecord(data []byte) (r record, err error) {
+	d := &decoder{data: data}
+	r.kind = recordKind(d.byte())
+	r.name = string(d.bytes())
+	switch r.kind {
+	case recordState:
+		s := &r.state
+		for _, v := range []*int64{&s.Value, &s.Step, &s.MinValue, &s.MaxValue, &s.ResetValue} {
+			*v = d.varint()
+		}
+		s.Modified = fromUnixNano(d.varint())
+		s.Overflow = counter.OverflowPolicy(d.uvarint())
+		s.Mode = counter.Mode(d.uvarint())
+		s.Wraps = d.uvarint()
+		s.Version = d.uvarint()
+	case recordBigState:
+		s := &r.big
+		for _, x := range []**big.Int{&s.Value, &s.Step, &s.MinValue, &s.MaxValue, &s.ResetValue} {
+			*x = d.big()
+		}
+		s.Modified = fromUnixNano(d.varint())
+		s.Overflow = counter.OverflowPolicy(d.uvarint())
+		s.Wraps = d.uvarint()
+		s.Version = d.uvarint()
+	case recordDelete, recordDeleteBig:
+	default:
+		return r, errCorrupt
+	}
+	if d.err != nil || len(d.data) != 0 {
+		return r, errCorrupt
+	}
+	return r, nil
+}
+
+// appendBig добавление значения произвольной точности: признак (0 - отсутствует, 1 - неотрицательное,
+// 2 - отрицательное), длина и байты абсолютного значения
+func appendBig(buf []byte, x *big.Int) []byte {
+	if x == nil {
+		return append(buf, 0)
+	}
+	sign := byte(1)
+	if x.Sign() < 0 {
+		sign = 2
+	}
+	abs := x.Bytes()
+	buf = append(buf, sign)
+	buf = binary.AppendUvarint(buf, uint64(len(abs)))
+	return append(buf, abs...)
+}
+
+// unixNano время в наносекундах от начала эпохи Unix, нулевое время записывается как 0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano время из записи журнала, 0 соответствует нулевому времени
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// decoder последовательное чтение полей данных записи
+// После первой ошибки чтение не выполняется, а ошибка сохраняется в err
+type decoder struct {
+	data []byte // непрочитанные данные
+	err  error  // первая ошибка чтения
+}
+
+// byte чтение одного байта
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.data) == 0 {
+		d.err = errCorrupt
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+// varint чтение целого числа со знаком
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = errCorrupt
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// uvarint чтение целого числа без знака
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errCorrupt
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// bytes чтение последовательности байтов с предшествующей длиной
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil || n > uint64(len(d.data)) {
+		d.err = errCorrupt
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+// big чтение значения произвольной точности в формате appendBig
+func (d *decoder) big() *big.Int {
+	switch sign := d.byte(); sign {
+	case 0:
+		return nil
+	case 1, 2:
+		x := new(big.Int).SetBytes(d.bytes())
+		if sign == 2 {
+			x.Neg(x)
+		}
+		return x
+	}
+	d.err = errCorrupt
+	return nil
+}
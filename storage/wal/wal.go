@@ -0,0 +1,544 @@
+// Пакет wal реализует хранилище состояния счетчиков storage.Store в файле журнала упреждающей записи
+// без использования cgo
+package wal
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+)
+
+// Store хранилище состояния счетчиков в файле журнала
+// Каждое изменение дописывается в конец файла записью с контрольной суммой, а текущее состояние
+// счетчиков хранится в памяти и восстанавливается при открытии чтением всех записей
+// Последняя запись, которая была дописана не полностью или повреждена, отбрасывается при открытии
+// вместе с нулями, оставшимися после нее в конце файла, а файл усекается до последней целой записи;
+// поврежденная запись, за которой в файле есть другие данные, не может быть результатом прерванного
+// дописывания, поэтому файл не открывается
+// Когда устаревших записей становится больше, чем актуальных, файл сжимается в отдельной горутине:
+// заменяется файлом, содержащим по одной записи на счетчик
+// Файл используется одним процессом; вызов методов потокобезопасен
+type Store struct {
+	mtx      sync.Mutex                  // мьютекс для блокировки одновременного доступа к журналу
+	path     string                      // путь к файлу журнала
+	opts     Options                     // настройки журнала
+	file     *os.File                    // файл журнала, открытый для дописывания
+	size     int64                       // размер файла журнала, включающий только целые записи
+	records  int                         // количество записей в файле журнала
+	dirty    bool                        // признак записей, не сброшенных на диск
+	counters map[string]counter.State    // текущее состояние счетчиков
+	big      map[string]counter.BigState // текущее состояние счетчиков произвольной точности
+	closed   bool                        // признак закрытия хранилища
+	compactc chan struct{}               // канал запроса сжатия журнала
+	stop     chan struct{}               // канал остановки фоновых горутин
+	wg       sync.WaitGroup              // ожидание завершения фоновых горутин
+	buf      []byte                      // буфер кодирования записей
+}
+
+// Store реализует интерфейс хранилища storage.Store
+var _ storage.Store = (*Store)(nil)
+
+// Open функция открывает файл журнала path, создавая его при отсутствии, восстанавливает
+// состояние счетчиков и возвращает указатель на хранилище
+// Если в конце файла есть неполная или поврежденная запись, файл усекается до последней целой записи,
+// а смещение записи и количество отброшенных байт выводятся в лог
+// Возвращает ошибку, если файл не является журналом хранилища или поврежден не в конце
+func Open(path string, opts Options) (*Store, error) {
+	if opts.Durability < DurabilityAlways || opts.Durability > DurabilityNone {
+		return nil, fmt.Errorf("недопустимая политика сброса записей на диск %s", opts.Durability)
+	}
+	if opts.Durability == DurabilityInterval && opts.SyncInterval <= 0 {
+		return nil, fmt.Errorf("недопустимый период сброса записей на диск %s", opts.SyncInterval)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		path:     path,
+		opts:     opts,
+		file:     f,
+		counters: make(map[string]counter.State),
+		big:      make(map[string]counter.BigState),
+		compactc: make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	err = s.recover()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.compactRequested()
+	if opts.Durability == DurabilityInterval {
+		s.wg.Add(1)
+		go s.syncPeriodically()
+	}
+	return s, nil
+}
+
+// recover чтение всех целых записей журнала и усечение файла после последней из них
+// Пустой файл или файл с неполным заголовком инициализируется заголовком
+func (s *Store) recover() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(s.file)
+	header := make([]byte, len(magic))
+	n, err := io.ReadFull(r, header)
+	switch {
+	case err == nil && string(header) == magic:
+	case (err == io.EOF || err == io.ErrUnexpectedEOF) && string(header[:n]) == magic[:n]:
+		// файл создан, но заголовок не был записан полностью
+		return s.reset()
+	case err == nil || err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("файл %s не является журналом хранилища счетчиков", s.path)
+	default:
+		return err
+	}
+	s.size = int64(len(magic))
+	head := make([]byte, recordHeaderSize)
+	for {
+		data, err := readRecord(r, head)
+		if err == io.EOF {
+			break
+		}
+		var rec record
+		if err == nil {
+			rec, err = decodeRecord(data)
+		}
+		if err == errCorrupt {
+			// поврежденная запись, которая не доходит до конца файла, не может быть дописана не полностью,
+			// если только после нее в файле нет одних нулей: файловая система может выделить место
+			// под дописываемые данные до их записи, и после аварийной остановки в нем остаются нули
+			if end := s.size + recordHeaderSize + int64(binary.LittleEndian.Uint32(head)); end < info.Size() {
+				zero, e := s.zeroTail(end, info.Size())
+				if e != nil {
+					return e
+				}
+				if !zero {
+					return fmt.Errorf("файл журнала %s поврежден: запись по смещению %d, после нее %d байт: %w",
+						s.path, s.size, info.Size()-end, err)
+				}
+			}
+		}
+		if err == io.ErrUnexpectedEOF || err == errCorrupt {
+			log.Printf("Журнал %s: отброшена неполная или поврежденная последняя запись по смещению %d, %d байт",
+				s.path, s.size, info.Size()-s.size)
+			break
+		}
+		if err != nil {
+			return err
+		}
+		s.apply(rec)
+		s.size += int64(recordHeaderSize + len(data))
+		s.records++
+	}
+	err = s.file.Truncate(s.size)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Seek(s.size, io.SeekStart)
+	return err
+}
+
+// readRecord чтение данных очередной записи журнала с проверкой длины и контрольной суммы
+// head - буфер для заголовка записи
+func readRecord(r io.Reader, head []byte) ([]byte, error) {
+	_, err := io.ReadFull(r, head)
+	if err != nil {
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(head)
+	if size == 0 || size > maxRecordSize {
+		return nil, errCorrupt
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(data, crcTable) != binary.LittleEndian.Uint32(head[4:]) {
+		return nil, errCorrupt
+	}
+	return data, nil
+}
+
+// zeroTail проверка того, что файл журнала от смещения offset до смещения size заполнен нулями
+func (s *Store) zeroTail(offset, size int64) (bool, error) {
+	buf := make([]byte, 32<<10)
+	for offset < size {
+		n, err := s.file.ReadAt(buf[:min(int64(len(buf)), size-offset)], offset)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false, nil
+			}
+		}
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		offset += int64(n)
+	}
+	return true, nil
+}
+
+// reset запись заголовка в начало пустого файла журнала
+func (s *Store) reset() error {
+	err := s.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.WriteAt([]byte(magic), 0)
+	if err != nil {
+		return err
+	}
+	err = s.file.Sync()
+	if err != nil {
+		return err
+	}
+	s.size = int64(len(magic))
+	_, err = s.file.Seek(s.size, io.SeekStart)
+	return err
+}
+
+// apply применение записи журнала к текущему состоянию счетчиков
+func (s *Store) apply(r record) {
+	switch r.kind {
+	case recordState:
+		s.counters[r.name] = r.state
+	case recordDelete:
+		delete(s.counters, r.name)
+	case recordBigState:
+		s.big[r.name] = r.big
+	case recordDeleteBig:
+		delete(s.big, r.name)
+	}
+}
+
+// lock метод блокирует хранилище, если контекст ctx не завершился и хранилище не закрыто
+// В случае успеха хранилище должно быть разблокировано вызывающей функцией
+func (s *Store) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		return storage.ErrClosed
+	}
+	return nil
+}
+
+// write дописывание записи в журнал, сброс ее на диск согласно политике сброса,
+// применение к текущему состоянию счетчиков и запрос сжатия журнала при необходимости
+// Если запись не удалось дописать, файл усекается до прежнего размера, а состояние не изменяется
+// Запись, данные которой больше maxRecordSize, не дописывается, так как при открытии была бы отброшена
+func (s *Store) write(r record) error {
+	s.buf = r.encode(s.buf[:0])
+	if len(s.buf)-recordHeaderSize > maxRecordSize {
+		return fmt.Errorf("%w: %d байт", ErrRecordTooLarge, len(s.buf)-recordHeaderSize)
+	}
+	_, err := s.file.Write(s.buf)
+	if err == nil && s.opts.Durability == DurabilityAlways {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		// на случай частично дописанной записи
+		s.file.Truncate(s.size)
+		s.file.Seek(s.size, io.SeekStart)
+		return err
+	}
+	s.size += int64(len(s.buf))
+	s.records++
+	s.dirty = s.opts.Durability != DurabilityAlways
+	s.apply(r)
+	if s.needsCompaction() {
+		// сжатие не задерживает сохранение записи; повторный запрос до начала сжатия не ставится в очередь
+		select {
+		case s.compactc <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// needsCompaction признак журнала, в котором устаревших записей больше, чем актуальных
+// Вызывается при заблокированном хранилище
+func (s *Store) needsCompaction() bool {
+	return s.records > s.opts.CompactMinRecords && s.records > 2*(len(s.counters)+len(s.big))
+}
+
+// Compact метод сжимает журнал: записывает текущее состояние всех счетчиков в новый файл
+// и заменяет им файл журнала
+// Вызывается автоматически в отдельной горутине, когда устаревших записей становится больше, чем актуальных
+func (s *Store) Compact(ctx context.Context) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mtx.Unlock()
+	return s.compact(false)
+}
+
+// compactRequested сжатие журнала по запросам write
+// Ошибка сжатия не отменяет уже сохраненные записи, поэтому только выводится в лог,
+// а сжатие повторяется после следующей записи
+func (s *Store) compactRequested() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.compactc:
+			s.mtx.Lock()
+			if !s.closed && s.needsCompaction() {
+				if err := s.compact(true); err != nil {
+					log.Printf("Журнал %s: ошибка сжатия: %v", s.path, err)
+				}
+			}
+			s.mtx.Unlock()
+		}
+	}
+}
+
+// compact сжатие журнала при заблокированном хранилище
+// Новый файл сбрасывается на диск и атомарно заменяет прежний, поэтому при отказе
+// во время сжатия сохраняется один из двух целых файлов
+// Если unlocked, хранилище разблокируется на время записи нового файла, а записи, дописанные
+// в журнал за это время, затем переносятся в новый файл; если за это время журнал был сжат
+// или хранилище закрыто, новый файл отбрасывается
+func (s *Store) compact(unlocked bool) error {
+	buf := []byte(magic)
+	for name, st := range s.counters {
+		buf = (&record{kind: recordState, name: name, state: st}).encode(buf)
+	}
+	for name, st := range s.big {
+		buf = (&record{kind: recordBigState, name: name, big: st}).encode(buf)
+	}
+	file, from, records, live := s.file, s.size, s.records, len(s.counters)+len(s.big)
+	if unlocked {
+		s.mtx.Unlock()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".compact-*")
+	if err == nil {
+		defer os.Remove(tmp.Name())
+		_, err = tmp.Write(buf)
+		if err == nil {
+			err = tmp.Sync()
+		}
+		if err == nil {
+			err = tmp.Chmod(0600)
+		}
+	}
+	if unlocked {
+		s.mtx.Lock()
+	}
+	if err == nil && (s.closed || s.file != file) {
+		tmp.Close()
+		return nil
+	}
+	if err == nil && s.size > from {
+		_, err = tmp.ReadFrom(io.NewSectionReader(s.file, from, s.size-from))
+		if err == nil {
+			err = tmp.Sync()
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		if tmp != nil {
+			tmp.Close()
+		}
+		return err
+	}
+	syncDir(filepath.Dir(s.path))
+	s.file.Close()
+	s.file = tmp
+	s.size = int64(len(buf)) + s.size - from
+	s.records = live + s.records - records
+	s.dirty = false
+	return nil
+}
+
+// syncDir сброс на диск каталога dir после замены файла журнала
+// Ошибка не возвращается, так как не все файловые системы поддерживают сброс каталогов
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// syncPeriodically периодический сброс записей на диск для политики DurabilityInterval
+func (s *Store) syncPeriodically() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mtx.Lock()
+			if s.dirty && s.file.Sync() == nil {
+				s.dirty = false
+			}
+			s.mtx.Unlock()
+		}
+	}
+}
+
+// Close метод сбрасывает записи на диск и закрывает файл журнала
+func (s *Store) Close() error {
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		return storage.ErrClosed
+	}
+	s.closed = true
+	s.mtx.Unlock()
+	close(s.stop)
+	s.wg.Wait()
+	err := s.file.Sync()
+	return errors.Join(err, s.file.Close())
+}
+
+// Load метод загружает снимок состояния счетчика name
+// Пустое имя соответствует счетчику по умолчанию
+func (s *Store) Load(ctx context.Context, name string) (counter.State, error) {
+	if err := s.lock(ctx); err != nil {
+		return counter.State{}, err
+	}
+	defer s.mtx.Unlock()
+	st, ok := s.counters[name]
+	if !ok {
+		return counter.State{}, storage.ErrNotFound
+	}
+	return st, nil
+}
+
+// Save метод сохраняет снимок состояния счетчика name, если он новее сохраненного
+// Режим синхронизации не изменяется после создания счетчика, поэтому сохраняется только при создании
+func (s *Store) Save(ctx context.Context, name string, st counter.State) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mtx.Unlock()
+	if prev, ok := s.counters[name]; ok {
+		if prev.Version >= st.Version {
+			return nil
+		}
+		st.Mode = prev.Mode
+	}
+	return s.write(record{kind: recordState, name: name, state: st})
+}
+
+// List метод загружает снимки состояния всех именованных счетчиков
+func (s *Store) List(ctx context.Context) (map[string]counter.State, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mtx.Unlock()
+	states := make(map[string]counter.State, len(s.counters))
+	for name, st := range s.counters {
+		if name != "" {
+			states[name] = st
+		}
+	}
+	return states, nil
+}
+
+// Delete метод удаляет состояние счетчика name из хранилища
+func (s *Store) Delete(ctx context.Context, name string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mtx.Unlock()
+	if _, ok := s.counters[name]; !ok {
+		return nil
+	}
+	return s.write(record{kind: recordDelete, name: name})
+}
+
+// LoadBig метод загружает снимок состояния счетчика произвольной точности name
+func (s *Store) LoadBig(ctx context.Context, name string) (counter.BigState, error) {
+	if err := s.lock(ctx); err != nil {
+		return counter.BigState{}, err
+	}
+	defer s.mtx.Unlock()
+	st, ok := s.big[name]
+	if !ok {
+		return counter.BigState{}, storage.ErrNotFound
+	}
+	return copyBigState(st), nil
+}
+
+// SaveBig метод сохраняет снимок состояния счетчика произвольной точности name, если он новее сохраненного
+func (s *Store) SaveBig(ctx context.Context, name string, st counter.BigState) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mtx.Unlock()
+	if prev, ok := s.big[name]; ok && prev.Version >= st.Version {
+		return nil
+	}
+	return s.write(record{kind: recordBigState, name: name, big: copyBigState(st)})
+}
+
+// ListBig метод загружает снимки состояния всех счетчиков произвольной точности
+func (s *Store) ListBig(ctx context.Context) (map[string]counter.BigState, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mtx.Unlock()
+	states := make(map[string]counter.BigState, len(s.big))
+	for name, st := range s.big {
+		states[name] = copyBigState(st)
+	}
+	return states, nil
+}
+
+// DeleteBig метод удаляет состояние счетчика произвольной точности name из хранилища
+func (s *Store) DeleteBig(ctx context.Context, name string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mtx.Unlock()
+	if _, ok := s.big[name]; !ok {
+		return nil
+	}
+	return s.write(record{kind: recordDeleteBig, name: name})
+}
+
+// copyBigState копия снимка состояния счетчика произвольной точности, не разделяющая с ним значения
+func copyBigState(s counter.BigState) counter.BigState {
+	for _, x := range []**big.Int{&s.Value, &s.Step, &s.MinValue, &s.MaxValue, &s.ResetValue} {
+		if *x != nil {
+			*x = new(big.Int).Set(*x)
+		}
+	}
+	return s
+}
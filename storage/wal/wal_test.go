@@ -0,0 +1,354 @@
+package wal
+
+// 2020 Sergey Sidorenko.
+// Пакет с реализацией RPC сервера работы со счетчиком
+// Сведения о лицензии отсутствуют
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SergeyASidorenko/ResourceCounter/counter"
+	"github.com/SergeyASidorenko/ResourceCounter/storage"
+	"github.com/SergeyASidorenko/ResourceCounter/storage/storetest"
+)
+
+// Тестирование соответствия хранилища общим тестам для всех политик сброса записей на диск
+func TestStore(t *testing.T) {
+	for _, d := range []Durability{DurabilityAlways, DurabilityInterval, DurabilityNone} {
+		t.Run(d.String(), func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T) storage.Store {
+				opts := DefaultOptions()
+				opts.Durability, opts.SyncInterval = d, time.Millisecond
+				s, err := Open(filepath.Join(t.TempDir(), "counters.wal"), opts)
+				if err != nil {
+					t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+				}
+				return s
+			})
+		})
+	}
+}
+
+// open открытие журнала с настройками по умолчанию
+func open(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := Open(path, DefaultOptions())
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	return s
+}
+
+// Тестирование восстановления состояния счетчиков после повторного открытия журнала
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "counters.wal")
+	s := open(t, path)
+	for k := uint64(1); k <= 3; k++ {
+		if err := s.Save(ctx, "", counter.State{Value: int64(k), Step: 1, Version: k, Modified: time.Unix(0, int64(k))}); err != nil {
+			t.Fatalf("метод Save вернул ошибку: %q", err.Error())
+		}
+	}
+	s.Save(ctx, "requests", counter.State{Value: -5, Step: 2, Mode: counter.ModeStriped, Version: 1})
+	s.Save(ctx, "removed", counter.State{Version: 1})
+	s.Delete(ctx, "removed")
+	s.SaveBig(ctx, "big", counter.BigState{Value: new(big.Int).Lsh(big.NewInt(-1), 100), Step: big.NewInt(1), ResetValue: big.NewInt(0), Version: 1})
+	if err := s.Close(); err != nil {
+		t.Fatalf("метод Close вернул ошибку: %q", err.Error())
+	}
+	s = open(t, path)
+	defer s.Close()
+	if st, err := s.Load(ctx, ""); err != nil || st.Value != 3 || st.Version != 3 || !st.Modified.Equal(time.Unix(0, 3)) {
+		t.Fatalf("Неверное восстановленное состояние счетчика по умолчанию: %+v, ошибка: %v", st, err)
+	}
+	states, _ := s.List(ctx)
+	if st, ok := states["requests"]; len(states) != 1 || !ok || st.Value != -5 || st.Mode != counter.ModeStriped {
+		t.Fatalf("Неверные восстановленные счетчики: %+v", states)
+	}
+	if st, err := s.LoadBig(ctx, "big"); err != nil || st.Value.Cmp(new(big.Int).Lsh(big.NewInt(-1), 100)) != 0 || st.MaxValue != nil {
+		t.Fatalf("Неверное восстановленное состояние счетчика произвольной точности: %+v, ошибка: %v", st, err)
+	}
+}
+
+// Тестирование отбрасывания неполной и поврежденной последней записи журнала
+func TestRecoverTornTail(t *testing.T) {
+	ctx := context.Background()
+	// файловая система может выделить место под дописываемые данные до их записи,
+	// поэтому после аварийной остановки в конце файла могут остаться нули
+	zeros := make([]byte, 4096)
+	for _, test := range []struct {
+		name   string
+		damage func(data []byte, last int) []byte
+		want   int64 // значение счетчика после восстановления
+	}{
+		{"неполная запись", func(data []byte, last int) []byte { return data[:len(data)-3] }, 1},
+		{"неполный заголовок записи", func(data []byte, last int) []byte { return data[:last+5] }, 1},
+		{"контрольная сумма", func(data []byte, last int) []byte {
+			data[len(data)-1] ^= 0xff
+			return data
+		}, 1},
+		{"длина записи", func(data []byte, last int) []byte {
+			data[last+3] = 0xff
+			return data
+		}, 1},
+		{"мусор после записей", func(data []byte, last int) []byte { return append(data, 1, 2, 3) }, 2},
+		{"нули после записей", func(data []byte, last int) []byte { return append(data, zeros...) }, 2},
+		{"нулевой заголовок записи", func(data []byte, last int) []byte {
+			clear(data[last:])
+			return append(data, zeros...)
+		}, 1},
+		{"неполная запись и нули", func(data []byte, last int) []byte { return append(data[:len(data)-3], zeros...) }, 1},
+		{"контрольная сумма и нули", func(data []byte, last int) []byte {
+			data[len(data)-1] ^= 0xff
+			return append(data, zeros...)
+		}, 1},
+	} {
+		path := filepath.Join(t.TempDir(), "counters.wal")
+		s := open(t, path)
+		s.Save(ctx, "requests", counter.State{Value: 1, Version: 1})
+		s.Close()
+		info, _ := os.Stat(path)
+		last := int(info.Size())
+		s = open(t, path)
+		s.Save(ctx, "requests", counter.State{Value: 2, Version: 2})
+		s.Close()
+		data, _ := os.ReadFile(path)
+		damaged := test.damage(data, last)
+		if err := os.WriteFile(path, damaged, 0600); err != nil {
+			t.Fatalf("Ошибка записи файла журнала: %q", err.Error())
+		}
+		want := test.want
+		s = open(t, path)
+		st, err := s.Load(ctx, "requests")
+		if err != nil || st.Value != want {
+			t.Fatalf("%s: неверное восстановленное состояние %+v, ожидалось значение %d, ошибка: %v", test.name, st, want, err)
+		}
+		// журнал усечен до последней целой записи, и новые записи читаются после повторного открытия
+		if err = s.Save(ctx, "requests", counter.State{Value: 10, Version: 10}); err != nil {
+			t.Fatalf("метод Save вернул ошибку: %q", err.Error())
+		}
+		s.Close()
+		s = open(t, path)
+		if st, err = s.Load(ctx, "requests"); err != nil || st.Value != 10 {
+			t.Fatalf("%s: запись после восстановления не прочитана: %+v, ошибка: %v", test.name, st, err)
+		}
+		s.Close()
+	}
+}
+
+// Тестирование отказа в открытии журнала, поврежденного не в конце файла
+func TestRecoverCorruptMiddle(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		name   string
+		damage func(data []byte, first int)
+	}{
+		{"контрольная сумма", func(data []byte, first int) { data[first+recordHeaderSize] ^= 0xff }},
+		{"нулевая длина записи", func(data []byte, first int) { copy(data[first:], []byte{0, 0, 0, 0}) }},
+	} {
+		path := filepath.Join(t.TempDir(), "counters.wal")
+		s := open(t, path)
+		for k := uint64(1); k <= 3; k++ {
+			s.Save(ctx, "requests", counter.State{Value: int64(k), Version: k})
+		}
+		s.Close()
+		data, _ := os.ReadFile(path)
+		test.damage(data, len(magic))
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("Ошибка записи файла журнала: %q", err.Error())
+		}
+		if _, err := Open(path, DefaultOptions()); !errors.Is(err, errCorrupt) {
+			t.Fatalf("%s: функция Open не вернула ошибку поврежденного журнала, получено: %v", test.name, err)
+		}
+		// записи после поврежденной не отбрасываются
+		if damaged, _ := os.ReadFile(path); !bytes.Equal(damaged, data) {
+			t.Fatalf("%s: поврежденный журнал изменен при открытии", test.name)
+		}
+	}
+}
+
+// Тестирование отказа в сохранении записи, превышающей наибольший допустимый размер
+func TestRecordTooLarge(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "counters.wal")
+	s := open(t, path)
+	name := strings.Repeat("x", 2<<20)
+	if err := s.Save(ctx, name, counter.State{Value: 1, Version: 1}); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("метод Save не вернул ошибку ErrRecordTooLarge, получено: %v", err)
+	}
+	if err := s.SaveBig(ctx, name, counter.BigState{Value: big.NewInt(1), Version: 1}); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("метод SaveBig не вернул ошибку ErrRecordTooLarge, получено: %v", err)
+	}
+	if _, err := s.Load(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Несохраненный счетчик загружен: %v", err)
+	}
+	// записи после отклоненной сохраняются и читаются после повторного открытия
+	if err := s.Save(ctx, "requests", counter.State{Value: 2, Version: 1}); err != nil {
+		t.Fatalf("метод Save вернул ошибку: %q", err.Error())
+	}
+	s.Close()
+	s = open(t, path)
+	defer s.Close()
+	if st, err := s.Load(ctx, "requests"); err != nil || st.Value != 2 {
+		t.Fatalf("Неверное состояние после повторного открытия: %+v, ошибка: %v", st, err)
+	}
+}
+
+// Тестирование открытия файла, не являющегося журналом, и файла с неполным заголовком
+func TestOpenHeader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "other.db")
+	os.WriteFile(path, []byte("SQLite format 3\x00"), 0600)
+	if _, err := Open(path, DefaultOptions()); err == nil {
+		t.Fatal("функция Open не вернула ошибку для файла, не являющегося журналом")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "SQLite format 3\x00" {
+		t.Fatalf("Файл, не являющийся журналом, изменен: %q", data)
+	}
+	path = filepath.Join(dir, "torn.wal")
+	os.WriteFile(path, []byte(magic[:3]), 0600)
+	s, err := Open(path, DefaultOptions())
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку для файла с неполным заголовком: %q", err.Error())
+	}
+	s.Close()
+	if data, _ := os.ReadFile(path); string(data) != magic {
+		t.Fatalf("Заголовок журнала не восстановлен: %q", data)
+	}
+	if _, err = Open(path, Options{Durability: DurabilityInterval}); err == nil {
+		t.Fatal("функция Open не вернула ошибку для недопустимого периода сброса записей")
+	}
+}
+
+// Тестирование сжатия журнала
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "counters.wal")
+	opts := DefaultOptions()
+	opts.CompactMinRecords = 10
+	s, err := Open(path, opts)
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	for k := uint64(1); k <= 100; k++ {
+		for _, name := range []string{"", "requests"} {
+			if err = s.Save(ctx, name, counter.State{Value: int64(k), Version: k}); err != nil {
+				t.Fatalf("метод Save вернул ошибку: %q", err.Error())
+			}
+		}
+	}
+	s.Save(ctx, "removed", counter.State{Version: 1})
+	s.Delete(ctx, "removed")
+	// журнал сжимается в отдельной горутине
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		s.mtx.Lock()
+		records := s.records
+		s.mtx.Unlock()
+		if records <= opts.CompactMinRecords+1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			s.Close()
+			t.Fatalf("Журнал не сжат, записей в файле: %d", records)
+		}
+	}
+	if err = s.Compact(ctx); err != nil {
+		t.Fatalf("метод Compact вернул ошибку: %q", err.Error())
+	}
+	if s.records != 2 {
+		t.Fatalf("После сжатия в журнале %d записей, ожидалось 2", s.records)
+	}
+	s.Save(ctx, "", counter.State{Value: 101, Version: 101})
+	s.Close()
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("После сжатия остались временные файлы: %v", entries)
+	}
+	s = open(t, path)
+	defer s.Close()
+	if st, err := s.Load(ctx, ""); err != nil || st.Value != 101 {
+		t.Fatalf("Неверное состояние после сжатия: %+v, ошибка: %v", st, err)
+	}
+	if st, err := s.Load(ctx, "requests"); err != nil || st.Value != 100 {
+		t.Fatalf("Неверное состояние после сжатия: %+v, ошибка: %v", st, err)
+	}
+	if _, err := s.Load(ctx, "removed"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Удаленный счетчик восстановлен после сжатия: %v", err)
+	}
+}
+
+// Тестирование сохранения записей, дописанных в журнал во время его сжатия
+func TestCompactConcurrent(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "counters.wal")
+	opts := DefaultOptions()
+	opts.Durability, opts.CompactMinRecords = DurabilityNone, 10
+	s, err := Open(path, opts)
+	if err != nil {
+		t.Fatalf("функция Open вернула ошибку: %q", err.Error())
+	}
+	const writers, minVersions = 4, 500
+	// запись продолжается, пока журнал не будет сжат хотя бы раз
+	var compacted atomic.Bool
+	versions := make([]uint64, writers)
+	var w sync.WaitGroup
+	w.Add(writers)
+	for g := 0; g < writers; g++ {
+		go func(g int) {
+			defer w.Done()
+			for k := uint64(1); k <= minVersions || !compacted.Load(); k++ {
+				if err := s.Save(ctx, fmt.Sprint(g), counter.State{Value: int64(k), Version: k}); err != nil {
+					return
+				}
+				versions[g] = k
+			}
+		}(g)
+	}
+	// сжатый журнал записывается в новый файл
+	file := s.file
+	for deadline := time.Now().Add(5 * time.Second); !compacted.Load(); time.Sleep(time.Millisecond) {
+		s.mtx.Lock()
+		compacted.Store(s.file != file)
+		s.mtx.Unlock()
+		if time.Now().After(deadline) {
+			compacted.Store(true)
+			w.Wait()
+			s.Close()
+			t.Fatal("Журнал не сжат во время записи")
+		}
+	}
+	w.Wait()
+	if err = s.Close(); err != nil {
+		t.Fatalf("метод Close вернул ошибку: %q", err.Error())
+	}
+	s = open(t, path)
+	defer s.Close()
+	for g := 0; g < writers; g++ {
+		if st, err := s.Load(ctx, fmt.Sprint(g)); err != nil || st.Version != versions[g] || st.Value != int64(versions[g]) {
+			t.Fatalf("Неверное состояние счетчика %d после сжатия, ожидалась версия %d: %+v, ошибка: %v", g, versions[g], st, err)
+		}
+	}
+}
+
+// Тестирование разбора политики сброса записей на диск
+func TestParseDurability(t *testing.T) {
+	for _, d := range []Durability{DurabilityAlways, DurabilityInterval, DurabilityNone} {
+		if parsed, err := ParseDurability(d.String()); err != nil || parsed != d {
+			t.Fatalf("Неверный разбор политики %s: %s, ошибка: %v", d, parsed, err)
+		}
+	}
+	if _, err := ParseDurability("fsync"); err == nil {
+		t.Fatal("функция ParseDurability не вернула ошибку для неизвестной политики")
+	}
+}